@@ -2,14 +2,21 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"tlcrazy-backend/internal/config"
 	"tlcrazy-backend/internal/server"
 )
 
 func main() {
 
-	server := server.NewServer()
+	cfg, err := config.Load(os.Args[1:], os.Getenv)
+	if err != nil {
+		panic(fmt.Sprintf("cannot load config: %s", err))
+	}
+
+	server := server.NewServer(cfg)
 
-	err := server.ListenAndServe()
+	err = server.ListenAndServe()
 	if err != nil {
 		panic(fmt.Sprintf("cannot start server: %s", err))
 	}
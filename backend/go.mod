@@ -4,10 +4,8 @@ go 1.22.6
 
 require (
 	github.com/go-chi/chi/v5 v5.1.0
+	github.com/go-chi/cors v1.2.1
 	github.com/joho/godotenv v1.5.1
-)
-
-require (
-	github.com/go-chi/cors v1.2.1 // indirect
-	github.com/liushuangls/go-anthropic/v2 v2.4.1 // indirect
+	github.com/liushuangls/go-anthropic/v2 v2.4.1
+	github.com/mattn/go-sqlite3 v1.14.33
 )
@@ -0,0 +1,117 @@
+package ai
+
+import (
+	"context"
+	"strings"
+
+	"github.com/liushuangls/go-anthropic/v2"
+)
+
+const defaultAnthropicModel = anthropic.ModelClaude3Dot5Sonnet20240620
+
+type AnthropicProvider struct {
+	client *anthropic.Client
+	model  string
+}
+
+func NewAnthropicProvider(apiKey, model string) *AnthropicProvider {
+	if model == "" {
+		model = defaultAnthropicModel
+	}
+
+	return &AnthropicProvider{
+		client: anthropic.NewClient(apiKey),
+		model:  model,
+	}
+}
+
+func (p *AnthropicProvider) ModelName() string {
+	return p.model
+}
+
+func (p *AnthropicProvider) Prefill() bool {
+	return true
+}
+
+func (p *AnthropicProvider) Complete(ctx context.Context, req CompletionRequest) (CompletionResponse, error) {
+	messages := make([]anthropic.Message, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		if msg.Role == RoleAssistant {
+			messages = append(messages, anthropic.NewAssistantTextMessage(msg.Content))
+		} else {
+			messages = append(messages, anthropic.NewUserTextMessage(msg.Content))
+		}
+	}
+
+	request := anthropic.MessagesRequest{
+		Model:     p.model,
+		MaxTokens: req.MaxTokens,
+		Messages:  messages,
+		System:    req.System,
+	}
+	for _, tool := range req.Tools {
+		request.Tools = append(request.Tools, anthropic.ToolDefinition{
+			Name:        tool.Name,
+			Description: tool.Description,
+			InputSchema: tool.InputSchema,
+		})
+	}
+	if req.ToolChoice != "" {
+		request.ToolChoice = &anthropic.ToolChoice{Type: "tool", Name: req.ToolChoice}
+	}
+
+	var resp anthropic.MessagesResponse
+	var err error
+	if req.OnDelta != nil && len(req.Tools) == 0 {
+		resp, err = p.client.CreateMessagesStream(ctx, anthropic.MessagesStreamRequest{
+			MessagesRequest: request,
+			OnContentBlockDelta: func(data anthropic.MessagesEventContentBlockDeltaData) {
+				if data.Delta.Type == anthropic.MessagesContentTypeTextDelta && data.Delta.Text != nil {
+					req.OnDelta(*data.Delta.Text)
+				}
+			},
+		})
+	} else {
+		resp, err = p.client.CreateMessages(ctx, request)
+	}
+	if err != nil {
+		return CompletionResponse{}, err
+	}
+
+	var text strings.Builder
+	var toolCalls []ToolCall
+	for _, content := range resp.Content {
+		switch content.Type {
+		case anthropic.MessagesContentTypeText, anthropic.MessagesContentTypeTextDelta:
+			text.WriteString(content.GetText())
+		case anthropic.MessagesContentTypeToolUse:
+			toolCalls = append(toolCalls, ToolCall{
+				Name:  content.MessageContentToolUse.Name,
+				Input: content.MessageContentToolUse.Input,
+			})
+		}
+	}
+
+	return CompletionResponse{
+		Text:      text.String(),
+		ToolCalls: toolCalls,
+		Usage: Usage{
+			InputTokens:  resp.Usage.InputTokens,
+			OutputTokens: resp.Usage.OutputTokens,
+		},
+		StopReason: anthropicStopReason(resp.StopReason),
+	}, nil
+}
+
+func anthropicStopReason(reason anthropic.MessagesStopReason) StopReason {
+	switch reason {
+	case anthropic.MessagesStopReasonEndTurn:
+		return StopReasonEndTurn
+	case anthropic.MessagesStopReasonMaxTokens:
+		return StopReasonMaxTokens
+	case anthropic.MessagesStopReasonToolUse:
+		return StopReasonToolUse
+	default:
+		return StopReasonOther
+	}
+}
@@ -0,0 +1,124 @@
+package ai
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const defaultAuditLog = ".tlcrazy/audit.jsonl"
+
+// AuditEntry records the policy verdict for one generated or refined tool.
+type AuditEntry struct {
+	Time      time.Time     `json:"time"`
+	Action    string        `json:"action"`
+	Workspace string        `json:"workspace,omitempty"`
+	ToolId    string        `json:"toolId"`
+	Query     string        `json:"query"`
+	Written   bool          `json:"written"`
+	Verdict   PolicyVerdict `json:"verdict"`
+}
+
+// AuditLog appends entries to a JSON Lines file at Path.
+type AuditLog struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func NewAuditLog(path string) *AuditLog {
+	return &AuditLog{Path: path}
+}
+
+func (a *AuditLog) Record(entry AuditEntry) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := ensureDirectoryExists(filepath.Dir(a.Path)); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(a.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Entries reads the whole log, oldest first.
+func (a *AuditLog) Entries() ([]AuditEntry, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entries := []AuditEntry{}
+
+	f, err := os.Open(a.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse audit log line %d: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
+
+// scanPolicy checks the tool against g.Policy and records the verdict. It
+// returns nil when there is no policy.
+func (g *Generator) scanPolicy(action, query string, tool TldrawToolOutput) *PolicyVerdict {
+	if g.Policy == nil {
+		return nil
+	}
+
+	verdict := g.Policy.Scan(tool)
+	for _, finding := range verdict.Findings {
+		log.Printf("Policy %s in %s: %s", finding.Action, tool.Id, finding)
+	}
+
+	if g.Audit != nil {
+		err := g.Audit.Record(AuditEntry{
+			Action:    action,
+			Workspace: g.Workspace.Name,
+			ToolId:    tool.Id,
+			Query:     query,
+			Written:   !verdict.Blocked,
+			Verdict:   verdict,
+		})
+		if err != nil {
+			log.Printf("Error writing audit log for %s: %s", tool.Id, err)
+		}
+	}
+
+	return &verdict
+}
@@ -0,0 +1,147 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"tlcrazy-backend/internal/validator"
+)
+
+const (
+	defaultMaxCandidates  = 5
+	defaultMaxConcurrency = 3
+)
+
+type GenerateOptions struct {
+	// Candidates is how many tools to sample. All of them are parsed and
+	// scored, and only the best one is written.
+	Candidates int `json:"candidates"`
+
+	// Mode selects between the XML and tool-use output formats.
+	Mode GenerationMode `json:"mode"`
+
+	// DisableCodemods writes the model output without the automatic style
+	// fixes. Ids that disagree with the tool id are still aligned.
+	DisableCodemods bool `json:"disableCodemods"`
+
+	// SkipTypeCheck writes the tool without compiling it first.
+	SkipTypeCheck bool `json:"skipTypeCheck"`
+}
+
+type CandidateResult struct {
+	Index       int                    `json:"index"`
+	Score       int                    `json:"score"`
+	Diagnostics []validator.Diagnostic `json:"diagnostics,omitempty"`
+	Attempts    int                    `json:"attempts"`
+	Blocked     bool                   `json:"blocked,omitempty"`
+	Error       string                 `json:"error,omitempty"`
+	Selected    bool                   `json:"selected"`
+}
+
+type candidate struct {
+	out      GenerateOutput
+	messages []ChatMessage
+	err      error
+}
+
+// generateCandidates samples n tools with at most g.MaxConcurrency upstream
+// generations in flight and returns the best scoring one. Candidates the
+// security policy blocks only win when every candidate is blocked.
+func (g *Generator) generateCandidates(ctx context.Context, query string, mode GenerationMode, n int, opts GenerateOptions) (GenerateOutput, []ChatMessage, error) {
+	if g.MaxCandidates > 0 && n > g.MaxCandidates {
+		return GenerateOutput{}, nil, fmt.Errorf("%w: at most %d candidates allowed", ErrInvalidOptions, g.MaxCandidates)
+	}
+
+	concurrency := g.MaxConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	candidates := make([]candidate, n)
+	sem := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				candidates[i].err = ctx.Err()
+				return
+			}
+			defer func() { <-sem }()
+
+			out, messages, err := g.generateCandidate(ctx, query, mode, nil)
+			if err == nil {
+				g.applyCodemods(&out, opts)
+			}
+			candidates[i] = candidate{out, messages, err}
+		}()
+	}
+	wg.Wait()
+
+	results := make([]CandidateResult, n)
+	best := -1
+	for i, cand := range candidates {
+		results[i] = CandidateResult{Index: i, Attempts: len(cand.out.Attempts)}
+		if cand.err != nil {
+			results[i].Error = cand.err.Error()
+			continue
+		}
+
+		results[i].Diagnostics = g.checkTool(cand.out.TldrawToolOutput)
+		results[i].Score = scoreCandidate(cand.out, results[i].Diagnostics)
+		if g.Policy != nil {
+			results[i].Blocked = g.Policy.Scan(cand.out.TldrawToolOutput).Blocked
+		}
+		if best == -1 || betterCandidate(results[i], results[best]) {
+			best = i
+		}
+	}
+
+	if best == -1 {
+		return GenerateOutput{}, nil, fmt.Errorf("all %d candidates failed: %w", n, candidates[0].err)
+	}
+
+	log.Printf("Selected candidate %d of %d with score %d", best, n, results[best].Score)
+
+	results[best].Selected = true
+	winner := candidates[best]
+	winner.out.Candidates = results
+
+	return winner.out, winner.messages, nil
+}
+
+func betterCandidate(a, b CandidateResult) bool {
+	if a.Blocked != b.Blocked {
+		return !a.Blocked
+	}
+
+	return a.Score > b.Score
+}
+
+// scoreCandidate starts at 100 and deducts points for every validator error
+// and warning and for every repair the tool needed.
+func scoreCandidate(out GenerateOutput, diagnostics []validator.Diagnostic) int {
+	score := 100
+
+	for _, d := range diagnostics {
+		switch d.Severity {
+		case validator.SeverityError:
+			score -= 20
+		case validator.SeverityWarning:
+			score -= 10
+		}
+	}
+
+	if len(out.Attempts) > 1 {
+		score -= 5 * (len(out.Attempts) - 1)
+	}
+
+	return score
+}
@@ -0,0 +1,131 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingProvider tracks how many requests are in flight at once.
+type countingProvider struct {
+	*FakeProvider
+	inFlight atomic.Int32
+	peak     atomic.Int32
+}
+
+func (p *countingProvider) Complete(ctx context.Context, req CompletionRequest) (CompletionResponse, error) {
+	n := p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+
+	for {
+		peak := p.peak.Load()
+		if n <= peak || p.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	return p.FakeProvider.Complete(ctx, req)
+}
+
+func TestGenerateCandidates(t *testing.T) {
+	bad := strings.NewReplacer(
+		"from 'tldraw'", "from '@tldraw/tldraw'",
+		"export default class", "export class",
+	).Replace(fakeToolOutput)
+
+	provider := &countingProvider{FakeProvider: NewFakeProvider(bad, bad, fakeToolOutput, bad)}
+	generator := newTestGenerator(t, provider)
+	generator.MaxConcurrency = 2
+
+	// The bad candidates are scored as generated, not as the codemods would fix them
+	out, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{Candidates: 4, DisableCodemods: true})
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+
+	want, _ := parseTldrawToolXML(fakeToolOutput)
+	if !reflect.DeepEqual(out.TldrawToolOutput, want) {
+		t.Error("Expected the candidate without violations to win")
+	}
+
+	if len(out.Candidates) != 4 {
+		t.Fatalf("Expected 4 candidate results but got %d", len(out.Candidates))
+	}
+	selected := 0
+	for _, result := range out.Candidates {
+		if result.Selected {
+			selected++
+			if result.Score != 100 || len(result.Diagnostics) != 0 {
+				t.Errorf("Expected the winner to have a perfect score but got %+v", result)
+			}
+		} else if len(result.Diagnostics) == 0 {
+			t.Errorf("Expected losing candidates to have diagnostics but got %+v", result)
+		}
+	}
+	if selected != 1 {
+		t.Errorf("Expected exactly 1 selected candidate but got %d", selected)
+	}
+
+	if peak := provider.peak.Load(); peak > 2 {
+		t.Errorf("Expected at most 2 concurrent requests but got %d", peak)
+	}
+
+	t.Run("Blocked candidates lose", func(t *testing.T) {
+		blocked := strings.Replace(fakeToolOutput, "count: 0", "count: eval('0')", 1)
+		generator := newTestGenerator(t, NewFakeProvider(blocked, bad))
+
+		out, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{Candidates: 2, DisableCodemods: true})
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		// Candidates run concurrently, so either one may be blocked
+		blockedResult, cleanResult := out.Candidates[0], out.Candidates[1]
+		if cleanResult.Blocked {
+			blockedResult, cleanResult = cleanResult, blockedResult
+		}
+		if !blockedResult.Blocked || blockedResult.Selected || !cleanResult.Selected {
+			t.Errorf("Expected the clean candidate to win over the blocked one but got %+v", out.Candidates)
+		}
+		if blockedResult.Score <= cleanResult.Score {
+			t.Errorf("Expected the blocked candidate to score higher on diagnostics alone but got %+v", out.Candidates)
+		}
+	})
+
+	t.Run("Streams the winner", func(t *testing.T) {
+		generator := newTestGenerator(t, NewFakeProvider(fakeToolOutput))
+
+		var events []StreamEventType
+		_, err := generator.GenTldrawToolStream(context.Background(), "a counter button", GenerateOptions{Candidates: 2}, func(event StreamEvent) {
+			events = append(events, event.Type)
+		})
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		want := []StreamEventType{
+			StreamEventTool,
+			StreamEventFile,
+			StreamEventFile,
+			StreamEventFile,
+			StreamEventValidation,
+			StreamEventDone,
+		}
+		if !reflect.DeepEqual(events, want) {
+			t.Errorf("Expected events %q\nbut got %q", want, events)
+		}
+	})
+
+	t.Run("Candidate cap", func(t *testing.T) {
+		generator.MaxCandidates = 3
+		_, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{Candidates: 4})
+		if !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("Expected ErrInvalidOptions but got %v", err)
+		}
+	})
+}
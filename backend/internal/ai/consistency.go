@@ -0,0 +1,152 @@
+package ai
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"tlcrazy-backend/internal/codemod"
+	"tlcrazy-backend/internal/validator"
+)
+
+const consistencyRule = "consistent-ids"
+
+// idDeclaration is a place where a tool names its id or shape type. tldraw
+// needs the tool id, the tool's shapeType and the util's type to agree, and
+// the frontend registers the tool under the <tool> id.
+type idDeclaration struct {
+	what    string
+	file    string
+	pattern *regexp.Regexp
+}
+
+var idDeclarations = []idDeclaration{
+	{"tool id", "tool.ts", regexp.MustCompile(`static\s+(?:override\s+)?id\s*=\s*(['"])([^'"\n]*)['"]`)},
+	{"shape type", "tool.ts", regexp.MustCompile(`(?:override\s+)?shapeType\s*=\s*(['"])([^'"\n]*)['"]`)},
+	{"util type", "util.tsx", regexp.MustCompile(`static\s+(?:override\s+)?type\s*=\s*(['"])([^'"\n]*)['"]`)},
+}
+
+// idReferences are other spots that repeat the shape type, such as shape
+// interfaces and updateShape calls. They are only corrected, never required.
+var idReferences = []*regexp.Regexp{
+	regexp.MustCompile(`TLBaseShape<\s*(['"])([^'"\n]*)['"]`),
+	regexp.MustCompile(`\btype\s*:\s*(['"])([^'"\n]*)['"]`),
+}
+
+type idMismatch struct {
+	what  string
+	file  string
+	line  int
+	found string
+}
+
+// findIdMismatches compares the ids declared in the sources with tool.Id.
+// Missing declarations are reported with an empty found value.
+func findIdMismatches(tool TldrawToolOutput) []idMismatch {
+	mismatches := []idMismatch{}
+
+	for _, decl := range idDeclarations {
+		content, _ := tool.file(decl.file)
+		if content == "" {
+			continue
+		}
+
+		m := decl.pattern.FindStringSubmatchIndex(content)
+		if m == nil {
+			mismatches = append(mismatches, idMismatch{what: decl.what, file: decl.file})
+			continue
+		}
+
+		if found := content[m[4]:m[5]]; found != tool.Id {
+			mismatches = append(mismatches, idMismatch{
+				what:  decl.what,
+				file:  decl.file,
+				line:  strings.Count(content[:m[0]], "\n") + 1,
+				found: found,
+			})
+		}
+	}
+
+	return mismatches
+}
+
+func (m idMismatch) String(toolId string) string {
+	if m.found == "" {
+		return fmt.Sprintf("%s does not declare the %s, expected %q", m.file, m.what, toolId)
+	}
+
+	return fmt.Sprintf("%s is %q in %s but the tool id is %q", m.what, m.found, m.file, toolId)
+}
+
+// fixIdMismatches rewrites every declaration and reference of a mismatched id
+// to tool.Id. Missing declarations are left for the diagnostics.
+func fixIdMismatches(tool *TldrawToolOutput) []codemod.Change {
+	wrong := map[string]bool{}
+	for _, m := range findIdMismatches(*tool) {
+		if m.found != "" {
+			wrong[m.found] = true
+		}
+	}
+	if len(wrong) == 0 {
+		return nil
+	}
+
+	patterns := idReferences
+	for _, decl := range idDeclarations {
+		patterns = append(patterns, decl.pattern)
+	}
+
+	changes := []codemod.Change{}
+	for _, file := range tool.AllFiles() {
+		if file.Kind == FileKindIcon || file.Kind == FileKindStyles {
+			continue
+		}
+
+		content := file.Content
+		for _, pattern := range patterns {
+			var b strings.Builder
+			last := 0
+			for _, m := range pattern.FindAllStringSubmatchIndex(content, -1) {
+				found := content[m[4]:m[5]]
+				if !wrong[found] {
+					continue
+				}
+
+				b.WriteString(content[last:m[4]])
+				b.WriteString(tool.Id)
+				last = m[5]
+
+				changes = append(changes, codemod.Change{
+					Codemod:     consistencyRule,
+					File:        file.Name,
+					Line:        strings.Count(content[:m[0]], "\n") + 1,
+					Description: fmt.Sprintf("renamed %q to the tool id %q", found, tool.Id),
+				})
+			}
+			b.WriteString(content[last:])
+			content = b.String()
+		}
+
+		if content != file.Content {
+			tool.setFile(file.Name, content)
+		}
+	}
+
+	return changes
+}
+
+// consistencyDiagnostics reports the id mismatches that are left.
+func consistencyDiagnostics(tool TldrawToolOutput) []validator.Diagnostic {
+	diagnostics := []validator.Diagnostic{}
+	for _, m := range findIdMismatches(tool) {
+		diagnostics = append(diagnostics, validator.Diagnostic{
+			Rule:     consistencyRule,
+			Severity: validator.SeverityError,
+			Message:  m.String(tool.Id),
+			File:     m.file,
+			Line:     m.line,
+		})
+	}
+
+	return diagnostics
+}
@@ -0,0 +1,114 @@
+package ai
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestIdConsistency(t *testing.T) {
+	tool, err := parseTldrawToolXML(fakeToolOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Consistent tool", func(t *testing.T) {
+		if diagnostics := consistencyDiagnostics(tool); len(diagnostics) != 0 {
+			t.Errorf("Expected no diagnostics but got %+v", diagnostics)
+		}
+		if changes := fixIdMismatches(&tool); len(changes) != 0 {
+			t.Errorf("Expected no changes but got %+v", changes)
+		}
+	})
+
+	t.Run("Renames a mismatched shape type", func(t *testing.T) {
+		renamed := tool
+		renamed.Id = "click-counter"
+
+		diagnostics := consistencyDiagnostics(renamed)
+		if len(diagnostics) != 3 {
+			t.Fatalf("Expected 3 diagnostics but got %+v", diagnostics)
+		}
+		expected := `tool id is "counter" in tool.ts but the tool id is "click-counter"`
+		if diagnostics[0].Message != expected {
+			t.Errorf("Expected %q\nbut got %q", expected, diagnostics[0].Message)
+		}
+
+		changes := fixIdMismatches(&renamed)
+		if len(changes) == 0 {
+			t.Fatal("Expected changes")
+		}
+		if diagnostics := consistencyDiagnostics(renamed); len(diagnostics) != 0 {
+			t.Errorf("Expected no diagnostics after fixing but got %+v", diagnostics)
+		}
+		if strings.Contains(renamed.Tool+renamed.Util, "'counter'") {
+			t.Error("Expected every reference to the old type to be renamed")
+		}
+	})
+
+	t.Run("Reports missing declarations", func(t *testing.T) {
+		missing := tool
+		missing.Util = strings.Replace(missing.Util, "static override type", "static override kind", 1)
+
+		diagnostics := consistencyDiagnostics(missing)
+		if len(diagnostics) != 1 || diagnostics[0].File != "util.tsx" {
+			t.Fatalf("Expected a diagnostic for util.tsx but got %+v", diagnostics)
+		}
+		if changes := fixIdMismatches(&missing); len(changes) != 0 {
+			t.Errorf("Expected no changes but got %+v", changes)
+		}
+	})
+}
+
+func TestGenTldrawToolAlignsIds(t *testing.T) {
+	output := strings.Replace(fakeToolOutput, `<tool id="counter"`, `<tool id="click-counter"`, 1)
+	if output == fakeToolOutput {
+		t.Fatal("Expected the fake output to have a counter tool tag")
+	}
+
+	t.Run("Fixed before writing", func(t *testing.T) {
+		generator := newTestGenerator(t, NewFakeProvider(output))
+
+		out, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{})
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		fixed := 0
+		for _, change := range out.Codemods {
+			if change.Codemod == consistencyRule {
+				fixed++
+			}
+		}
+		if fixed == 0 {
+			t.Errorf("Expected the ids to be aligned but got %+v", out.Codemods)
+		}
+
+		written, err := os.ReadFile(newToolPaths(generator.Workspace, "click-counter").Util)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(written), "static override type = 'click-counter'") {
+			t.Error("Expected the written util.tsx to use the tool id")
+		}
+	})
+
+	t.Run("Fixed when codemods are disabled", func(t *testing.T) {
+		generator := newTestGenerator(t, NewFakeProvider(output))
+
+		out, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{DisableCodemods: true})
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		for _, change := range out.Codemods {
+			if change.Codemod != consistencyRule {
+				t.Errorf("Expected only the ids to be aligned but got %+v", change)
+			}
+		}
+		if len(out.Codemods) == 0 || len(out.Diagnostics) != 0 {
+			t.Errorf("Expected the ids to be aligned but got %+v %+v", out.Codemods, out.Diagnostics)
+		}
+	})
+}
@@ -0,0 +1,147 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type blockingProvider struct{}
+
+func (blockingProvider) Complete(ctx context.Context, req CompletionRequest) (CompletionResponse, error) {
+	<-ctx.Done()
+	return CompletionResponse{}, ctx.Err()
+}
+
+// cancelAfterContext reports itself as cancelled once Err has been called
+// more than `after` times, to simulate a client going away mid-write.
+type cancelAfterContext struct {
+	context.Context
+	calls atomic.Int32
+	after int32
+}
+
+func (c *cancelAfterContext) Err() error {
+	if c.calls.Add(1) > c.after {
+		return context.Canceled
+	}
+	return nil
+}
+
+// cancellingStore cancels the request as soon as an install has finished.
+type cancellingStore struct {
+	ToolStore
+	cancel context.CancelFunc
+}
+
+func (s cancellingStore) Install(ctx context.Context, tool TldrawToolOutput, entry ToolEntry) (ToolEntry, error) {
+	defer s.cancel()
+	return s.ToolStore.Install(ctx, tool, entry)
+}
+
+func TestGenerationContext(t *testing.T) {
+	t.Run("Generate timeout", func(t *testing.T) {
+		generator := newTestGenerator(t, blockingProvider{})
+		generator.Timeouts.Generate = 10 * time.Millisecond
+
+		_, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected a deadline exceeded error but got %v", err)
+		}
+	})
+
+	t.Run("Cancelled request", func(t *testing.T) {
+		generator := newTestGenerator(t, blockingProvider{})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+
+		_, err := generator.GenTldrawTool(ctx, "a counter button", GenerateOptions{})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected a cancelled error but got %v", err)
+		}
+		if _, err := os.Stat(newToolPaths(generator.Workspace, "counter").Folder); !os.IsNotExist(err) {
+			t.Error("Expected no tool folder to be created")
+		}
+	})
+
+	t.Run("Cancellation during writes rolls back", func(t *testing.T) {
+		tool, err := parseTldrawToolXML(fakeToolOutput)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		workspace := newTestApp(t)
+		paths := newToolPaths(workspace, tool.Id)
+
+		// One check up front and one per install step, the manifest step fails
+		ctx := &cancelAfterContext{Context: context.Background(), after: 5}
+		if _, err := NewFileToolStore(workspace).Install(ctx, tool, ToolEntry{}); err == nil {
+			t.Fatal("Expected the write to fail")
+		}
+
+		if _, err := os.Stat(paths.Folder); !os.IsNotExist(err) {
+			t.Error("Expected the tool folder to be removed")
+		}
+		if _, err := os.Stat(paths.Icon); !os.IsNotExist(err) {
+			t.Error("Expected the icon to be removed")
+		}
+
+		toolsJSON, err := os.ReadFile(paths.ToolsJSON)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(toolsJSON) != `{"ids":[]}` {
+			t.Errorf("Expected tools.json to be restored but got %s", toolsJSON)
+		}
+	})
+
+	t.Run("Write errors roll back", func(t *testing.T) {
+		generator := newTestGenerator(t, NewFakeProvider(fakeToolOutput))
+		paths := newToolPaths(generator.Workspace, "counter")
+
+		generator.Store = &FileToolStore{Workspace: generator.Workspace, fault: failAt(installIcon, errors.New("disk full"))}
+
+		_, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{})
+		if !errors.Is(err, ErrWriteFailed) {
+			t.Fatalf("Expected ErrWriteFailed but got %v", err)
+		}
+
+		if _, err := os.Stat(paths.Folder); !os.IsNotExist(err) {
+			t.Error("Expected the tool folder to be removed")
+		}
+		session, err := generator.Sessions.Load("counter")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(session.Messages) != 0 {
+			t.Error("Expected no session for a tool that was not installed")
+		}
+	})
+
+	t.Run("Cancellation after the write succeeds", func(t *testing.T) {
+		generator := newTestGenerator(t, NewFakeProvider(fakeToolOutput))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		generator.Store = cancellingStore{ToolStore: NewFileToolStore(generator.Workspace), cancel: cancel}
+
+		if _, err := generator.GenTldrawTool(ctx, "a counter button", GenerateOptions{}); err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		if _, err := os.Stat(newToolPaths(generator.Workspace, "counter").Util); err != nil {
+			t.Error("Expected the tool to be installed", err)
+		}
+		session, err := generator.Sessions.Load("counter")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(session.Messages) == 0 {
+			t.Error("Expected the session of the installed tool to be saved")
+		}
+	})
+}
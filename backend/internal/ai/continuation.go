@@ -0,0 +1,106 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+const defaultMaxContinuations = 3
+
+// continueTailLength is how much of a cut off answer is quoted back to
+// providers that cannot resume it.
+const continueTailLength = 200
+
+// complete sends req with the generator's token ceiling and, when the model
+// stops because it hit max_tokens, asks it to continue from the partial output
+// up to g.MaxContinuations times. The returned text is the stitched result,
+// which is exactly the text streamed through req.OnDelta.
+func (g *Generator) complete(ctx context.Context, req CompletionRequest) (CompletionResponse, error) {
+	req.MaxTokens = g.MaxTokens
+	if req.MaxTokens <= 0 {
+		req.MaxTokens = defaultMaxTokens
+	}
+
+	resp, err := g.Provider.Complete(ctx, req)
+	if err != nil {
+		return CompletionResponse{}, err
+	}
+
+	prefiller, ok := g.Provider.(Prefiller)
+	prefill := ok && prefiller.Prefill()
+
+	// A truncated tool call cannot be continued, the repair loop handles it
+	for i := 0; resp.StopReason == StopReasonMaxTokens && len(req.Tools) == 0 && i < g.MaxContinuations; i++ {
+		// The APIs reject a final assistant turn that ends in whitespace, so
+		// the model may repeat the whitespace cut off here
+		partial := strings.TrimRight(resp.Text, " \t\r\n")
+		log.Printf("Output hit max_tokens after %d chars, requesting continuation %d", len(resp.Text), i+1)
+
+		cont := req
+		cont.Messages = append(slices.Clone(req.Messages), ChatMessage{
+			Role:    RoleAssistant,
+			Content: nonEmpty(partial),
+		})
+		if !prefill {
+			start := max(0, len(partial)-continueTailLength)
+			for start < len(partial) && !utf8.RuneStart(partial[start]) {
+				start++
+			}
+			cont.Messages = append(cont.Messages, ChatMessage{
+				Role:    RoleUser,
+				Content: fmt.Sprintf(PromptContinue, partial[start:]),
+			})
+		}
+
+		trailing := resp.Text[len(partial):]
+		if req.OnDelta != nil {
+			deltas := overlapTrimmer{skip: trailing}
+			cont.OnDelta = func(text string) {
+				if text = deltas.trim(text); text != "" {
+					req.OnDelta(text)
+				}
+			}
+		}
+
+		next, err := g.Provider.Complete(ctx, cont)
+		if err != nil {
+			return CompletionResponse{}, err
+		}
+
+		text := overlapTrimmer{skip: trailing}
+		resp = CompletionResponse{
+			Text:      resp.Text + text.trim(next.Text),
+			ToolCalls: next.ToolCalls,
+			Usage: Usage{
+				InputTokens:  resp.Usage.InputTokens + next.Usage.InputTokens,
+				OutputTokens: resp.Usage.OutputTokens + next.Usage.OutputTokens,
+			},
+			StopReason: next.StopReason,
+		}
+	}
+
+	return resp, nil
+}
+
+// overlapTrimmer drops the whitespace a continuation repeats from the end of
+// the text it continues. Chunks are trimmed as they arrive, so the streamed
+// and the stitched text stay the same.
+type overlapTrimmer struct {
+	skip string
+}
+
+func (o *overlapTrimmer) trim(text string) string {
+	for o.skip != "" && text != "" {
+		if text[0] != o.skip[0] {
+			o.skip = ""
+			break
+		}
+		text, o.skip = text[1:], o.skip[1:]
+	}
+
+	return text
+}
@@ -0,0 +1,125 @@
+package ai
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestContinuation(t *testing.T) {
+	cut := strings.Index(fakeToolOutput, "getGeometry")
+	first := fakeToolOutput[:cut] + "  \n"
+	rest := fakeToolOutput[cut:]
+
+	t.Run("Stitches continuations before parsing", func(t *testing.T) {
+		provider := NewFakeProviderWithResponses(
+			CompletionResponse{Text: first, StopReason: StopReasonMaxTokens, Usage: Usage{InputTokens: 10, OutputTokens: 20}},
+			CompletionResponse{Text: rest, StopReason: StopReasonEndTurn, Usage: Usage{InputTokens: 30, OutputTokens: 5}},
+		)
+		generator := newTestGenerator(t, provider)
+		generator.MaxTokens = 1234
+
+		out, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{})
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		want, _ := parseTldrawToolXML(first + rest)
+		if !reflect.DeepEqual(out.TldrawToolOutput, want) {
+			t.Error("Expected the stitched output to be parsed")
+		}
+		if len(out.Attempts) != 1 || out.Attempts[0].Usage != (Usage{InputTokens: 40, OutputTokens: 25}) {
+			t.Errorf("Expected a single attempt with summed usage but got %+v", out.Attempts)
+		}
+
+		requests := provider.Requests()
+		if len(requests) != 2 {
+			t.Fatalf("Expected 2 requests but got %d", len(requests))
+		}
+		if requests[0].MaxTokens != 1234 {
+			t.Errorf("Expected the configured token ceiling but got %d", requests[0].MaxTokens)
+		}
+
+		prefill := requests[1].Messages[len(requests[1].Messages)-1]
+		if prefill.Role != RoleAssistant || prefill.Content != strings.TrimRight(first, " \t\n") {
+			t.Error("Expected the partial output to be sent back without trailing whitespace")
+		}
+	})
+
+	t.Run("Cut right after a newline", func(t *testing.T) {
+		for _, next := range []string{"\nconst b = 2\n", "const b = 2\n"} {
+			provider := NewFakeProviderWithResponses(
+				CompletionResponse{Text: "const a = 1\n", StopReason: StopReasonMaxTokens},
+				CompletionResponse{Text: next, StopReason: StopReasonEndTurn},
+			)
+			generator := newTestGenerator(t, provider)
+
+			streamed := ""
+			resp, err := generator.complete(context.Background(), CompletionRequest{
+				Messages: []ChatMessage{{Role: RoleUser, Content: "two constants"}},
+				OnDelta:  func(text string) { streamed += text },
+			})
+			if err != nil {
+				t.Fatal("Got an error but didn't expect one", err)
+			}
+
+			if want := "const a = 1\nconst b = 2\n"; resp.Text != want {
+				t.Errorf("Expected %q\nbut got %q", want, resp.Text)
+			}
+			if streamed != resp.Text {
+				t.Errorf("Expected the streamed text %q to match the stitched text %q", streamed, resp.Text)
+			}
+		}
+	})
+
+	t.Run("Asks providers without prefill to continue", func(t *testing.T) {
+		provider := NewFakeProviderWithResponses(
+			CompletionResponse{Text: first, StopReason: StopReasonMaxTokens},
+			CompletionResponse{Text: rest, StopReason: StopReasonEndTurn},
+		)
+		provider.NoPrefill = true
+		generator := newTestGenerator(t, provider)
+
+		resp, err := generator.complete(context.Background(), CompletionRequest{
+			Messages: []ChatMessage{{Role: RoleUser, Content: "a counter button"}},
+		})
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		if resp.Text != first+rest {
+			t.Error("Expected the continuation to be appended to the partial output")
+		}
+
+		messages := provider.Requests()[1].Messages
+		last := messages[len(messages)-1]
+		if last.Role != RoleUser || !strings.Contains(last.Content, "Continue exactly") || !strings.Contains(last.Content, "return { w: 160, h: 80, count: 0 }") {
+			t.Errorf("Expected a user turn quoting the end of the partial output but got %+v", last)
+		}
+		if messages[len(messages)-2].Role != RoleAssistant {
+			t.Error("Expected the partial output before the continue request")
+		}
+	})
+
+	t.Run("Stops after the continuation budget", func(t *testing.T) {
+		provider := NewFakeProviderWithResponses(
+			CompletionResponse{Text: "<tool id=\"counter\">", StopReason: StopReasonMaxTokens},
+		)
+		generator := newTestGenerator(t, provider)
+		generator.MaxContinuations = 2
+
+		resp, err := generator.complete(context.Background(), CompletionRequest{
+			Messages: []ChatMessage{{Role: RoleUser, Content: "a counter button"}},
+		})
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		if got := len(provider.Requests()); got != 3 {
+			t.Errorf("Expected 1 request and 2 continuations but got %d", got)
+		}
+		if resp.StopReason != StopReasonMaxTokens {
+			t.Errorf("Expected the output to still be truncated but got %q", resp.StopReason)
+		}
+	})
+}
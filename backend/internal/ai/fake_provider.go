@@ -0,0 +1,157 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// FakeProvider replays canned responses in order, repeating the last one once
+// they run out. It never touches the network, which makes it useful for tests
+// and offline development.
+type FakeProvider struct {
+	// NoPrefill makes the provider behave like one that cannot resume a
+	// prefilled assistant message.
+	NoPrefill bool
+
+	mu        sync.Mutex
+	responses []CompletionResponse
+	requests  []CompletionRequest
+}
+
+func NewFakeProvider(outputs ...string) *FakeProvider {
+	responses := make([]CompletionResponse, 0, len(outputs))
+	for _, output := range outputs {
+		responses = append(responses, CompletionResponse{
+			Text:       output,
+			StopReason: StopReasonEndTurn,
+		})
+	}
+
+	return NewFakeProviderWithResponses(responses...)
+}
+
+func NewFakeProviderWithResponses(responses ...CompletionResponse) *FakeProvider {
+	return &FakeProvider{responses: responses}
+}
+
+func (p *FakeProvider) ModelName() string {
+	return "fake"
+}
+
+func (p *FakeProvider) Prefill() bool {
+	return !p.NoPrefill
+}
+
+func (p *FakeProvider) Complete(ctx context.Context, req CompletionRequest) (CompletionResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return CompletionResponse{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.responses) == 0 {
+		return CompletionResponse{}, errors.New("fake provider has no responses")
+	}
+
+	idx := min(len(p.requests), len(p.responses)-1)
+	p.requests = append(p.requests, req)
+	resp := p.responses[idx]
+
+	// Stream line by line so callers see the same chunking on every run
+	if req.OnDelta != nil && len(req.Tools) == 0 {
+		for _, line := range strings.SplitAfter(resp.Text, "\n") {
+			if line != "" {
+				req.OnDelta(line)
+			}
+		}
+	}
+
+	return resp, nil
+}
+
+// Requests returns a copy of every request the provider has received.
+func (p *FakeProvider) Requests() []CompletionRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]CompletionRequest(nil), p.requests...)
+}
+
+const fakeToolOutput = `
+<tool id="counter">
+<file name="tool.ts">
+import { BaseBoxShapeTool } from 'tldraw'
+
+export default class CounterTool extends BaseBoxShapeTool {
+	static override id = 'counter'
+	static override initial = 'idle'
+	override shapeType = 'counter'
+}
+</file>
+
+<file name="util.tsx">
+import { HTMLContainer, Rectangle2d, ShapeUtil, TLOnResizeHandler, resizeBox } from 'tldraw'
+
+interface CounterShape {
+	type: 'counter'
+	props: {
+		w: number
+		h: number
+		count: number
+	}
+}
+
+export default class CounterUtil extends ShapeUtil<CounterShape> {
+	static override type = 'counter' as const
+
+	getDefaultProps(): CounterShape['props'] {
+		return { w: 160, h: 80, count: 0 }
+	}
+
+	getGeometry(shape: CounterShape) {
+		return new Rectangle2d({ width: shape.props.w, height: shape.props.h, isFilled: true })
+	}
+
+	component(shape: CounterShape) {
+		return (
+			<HTMLContainer
+				className="flex items-center justify-center rounded border border-black bg-white"
+				style={{ pointerEvents: 'all' }}
+			>
+				<button
+					className="px-2 py-1"
+					onPointerDown={(e) => e.stopPropagation()}
+					onClick={() =>
+						this.editor.updateShape<CounterShape>({
+							id: shape.id,
+							type: 'counter',
+							props: { count: shape.props.count + 1 },
+						})
+					}
+				>
+					Clicks: {shape.props.count}
+				</button>
+			</HTMLContainer>
+		)
+	}
+
+	indicator(shape: CounterShape) {
+		return <rect width={shape.props.w} height={shape.props.h} />
+	}
+
+	override onResize: TLOnResizeHandler<CounterShape> = (shape, info) => {
+		return resizeBox(shape, info)
+	}
+}
+</file>
+
+<file name="icon.svg"><svg xmlns="http://www.w3.org/2000/svg" width="24" height="24" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round">
+  <rect x="3" y="6" width="18" height="12" rx="2" />
+  <path d="M12 9v6M9 12h6" />
+</svg>
+</file>
+</tool>
+`
@@ -0,0 +1,206 @@
+package ai
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+type FileKind string
+
+const (
+	FileKindTool       FileKind = "tool"
+	FileKindUtil       FileKind = "util"
+	FileKindIcon       FileKind = "icon"
+	FileKindProps      FileKind = "props"
+	FileKindMigrations FileKind = "migrations"
+	FileKindTypes      FileKind = "types"
+	FileKindStyles     FileKind = "styles"
+	FileKindHelper     FileKind = "helper"
+)
+
+const maxExtraFiles = 8
+
+type ToolFile struct {
+	Name    string   `json:"name"`
+	Kind    FileKind `json:"kind"`
+	Content string   `json:"content"`
+}
+
+const extraFileNameRegexp = `[a-z0-9][a-z0-9._-]*\.(ts|tsx|css)`
+
+var extraFileNamePattern = regexp.MustCompile(`^` + extraFileNameRegexp + `$`)
+
+// toolFileNamePattern matches every file name a tool may have, for schemas
+// given to the model.
+const toolFileNamePattern = `^(tool\.ts|util\.tsx|icon\.svg|` + extraFileNameRegexp + `)$`
+
+// classifyToolFile returns the kind of a file the model produced, and false if
+// the file is not allowed in a tool folder. Besides tool.ts, util.tsx and
+// icon.svg, flat .ts/.tsx/.css files such as props, migrations, types, styles
+// and helpers are allowed.
+func classifyToolFile(name string) (FileKind, bool) {
+	switch name {
+	case "tool.ts":
+		return FileKindTool, true
+	case "util.tsx":
+		return FileKindUtil, true
+	case "icon.svg":
+		return FileKindIcon, true
+	}
+
+	if !extraFileNamePattern.MatchString(name) || strings.Contains(name, "..") {
+		return "", false
+	}
+
+	base := strings.TrimSuffix(name, path.Ext(name))
+	switch {
+	case path.Ext(name) == ".css":
+		return FileKindStyles, true
+	case base == "props" || strings.HasSuffix(base, "-props"):
+		return FileKindProps, true
+	case base == "migrations" || strings.HasSuffix(base, "-migrations"):
+		return FileKindMigrations, true
+	case base == "types" || strings.HasSuffix(base, "-types"):
+		return FileKindTypes, true
+	default:
+		return FileKindHelper, true
+	}
+}
+
+// AllFiles returns every file of the tool in order: tool.ts, util.tsx and
+// icon.svg first, then the extra files in the order the model produced them.
+// Files without content are skipped.
+func (t TldrawToolOutput) AllFiles() []ToolFile {
+	files := []ToolFile{}
+	for _, core := range []ToolFile{
+		{Name: "tool.ts", Kind: FileKindTool, Content: t.Tool},
+		{Name: "util.tsx", Kind: FileKindUtil, Content: t.Util},
+		{Name: "icon.svg", Kind: FileKindIcon, Content: t.Icon},
+	} {
+		if core.Content != "" {
+			files = append(files, core)
+		}
+	}
+
+	return append(files, t.Files...)
+}
+
+// addExtraFile appends an allowed extra file unless one with the same name is
+// already present. It reports whether the file was added.
+func (t *TldrawToolOutput) addExtraFile(name, content string) bool {
+	kind, ok := classifyToolFile(name)
+	if !ok || kind == FileKindTool || kind == FileKindUtil || kind == FileKindIcon {
+		return false
+	}
+	if len(t.Files) >= maxExtraFiles {
+		return false
+	}
+	for _, file := range t.Files {
+		if file.Name == name {
+			return false
+		}
+	}
+
+	t.Files = append(t.Files, ToolFile{Name: name, Kind: kind, Content: content})
+	return true
+}
+
+// file returns the content of the named file and whether the tool has it.
+func (t *TldrawToolOutput) file(name string) (string, bool) {
+	if field := toolFileField(t, name); field != nil {
+		return *field, *field != ""
+	}
+
+	for _, file := range t.Files {
+		if file.Name == name {
+			return file.Content, true
+		}
+	}
+
+	return "", false
+}
+
+// setFile replaces the content of the named file, adding it as an extra file
+// if needed. It reports false for files that are not allowed.
+func (t *TldrawToolOutput) setFile(name, content string) bool {
+	if field := toolFileField(t, name); field != nil {
+		*field = content
+		return true
+	}
+
+	for i, file := range t.Files {
+		if file.Name == name {
+			t.Files[i].Content = content
+			return true
+		}
+	}
+
+	return t.addExtraFile(name, content)
+}
+
+// renderToolFiles formats the files of a tool as <file> tags for prompts.
+func renderToolFiles(tool TldrawToolOutput) string {
+	files := []string{}
+	for _, file := range tool.AllFiles() {
+		files = append(files, fmt.Sprintf("<file name=%q>%s</file>", file.Name, file.Content))
+	}
+
+	return strings.Join(files, "\n\n")
+}
+
+var relativeImportPattern = regexp.MustCompile(`(?:\bfrom\s*|\bimport\s*\(?\s*)['"](\.{1,2}/[^'"]*)['"]`)
+
+type unresolvedImport struct {
+	File      string
+	Specifier string
+	// Suggested is the file that would satisfy the import, empty if no
+	// allowed file can.
+	Suggested string
+}
+
+// unresolvedImports lists relative imports in the tool's code that do not
+// point at one of the tool's own files.
+func unresolvedImports(tool TldrawToolOutput) []unresolvedImport {
+	files := tool.AllFiles()
+
+	names := map[string]bool{}
+	for _, file := range files {
+		names[file.Name] = true
+	}
+
+	unresolved := []unresolvedImport{}
+	for _, file := range files {
+		if file.Kind == FileKindIcon || file.Kind == FileKindStyles {
+			continue
+		}
+
+		for _, match := range relativeImportPattern.FindAllStringSubmatch(file.Content, -1) {
+			spec := match[1]
+			target := strings.TrimPrefix(spec, "./")
+			if names[target] || names[target+".ts"] || names[target+".tsx"] {
+				continue
+			}
+
+			imp := unresolvedImport{File: file.Name, Specifier: spec}
+			if path.Ext(target) == "" {
+				target += ".ts"
+			}
+			if _, ok := classifyToolFile(target); ok && strings.HasPrefix(spec, "./") {
+				imp.Suggested = target
+			}
+			unresolved = append(unresolved, imp)
+		}
+	}
+
+	return unresolved
+}
+
+func (i unresolvedImport) String() string {
+	if i.Suggested == "" {
+		return fmt.Sprintf("%s imports %q which is not a file of the tool", i.File, i.Specifier)
+	}
+
+	return fmt.Sprintf("%s imports %q but %s was not produced", i.File, i.Specifier, i.Suggested)
+}
@@ -0,0 +1,141 @@
+package ai
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClassifyToolFile(t *testing.T) {
+	tests := []struct {
+		name string
+		kind FileKind
+		ok   bool
+	}{
+		{"tool.ts", FileKindTool, true},
+		{"util.tsx", FileKindUtil, true},
+		{"icon.svg", FileKindIcon, true},
+		{"card-shape-props.ts", FileKindProps, true},
+		{"migrations.ts", FileKindMigrations, true},
+		{"card-shape-types.ts", FileKindTypes, true},
+		{"styles.css", FileKindStyles, true},
+		{"use-timer.tsx", FileKindHelper, true},
+		{"../tools.json", "", false},
+		{"nested/helper.ts", "", false},
+		{"Helper.ts", "", false},
+		{"script.js", "", false},
+		{"..ts", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kind, ok := classifyToolFile(test.name)
+			if kind != test.kind || ok != test.ok {
+				t.Errorf("Expected (%q, %v)\nbut got (%q, %v)", test.kind, test.ok, kind, ok)
+			}
+		})
+	}
+}
+
+func TestUnresolvedImports(t *testing.T) {
+	tool := TldrawToolOutput{
+		Id:   "card",
+		Tool: "import { BaseBoxShapeTool } from 'tldraw'\nimport CardUtil from './util'\n",
+		Util: "import { cardShapeProps } from './card-shape-props'\nimport './styles.css'\nimport secret from '../secret'\n",
+		Icon: "<svg></svg>",
+		Files: []ToolFile{
+			{Name: "styles.css", Kind: FileKindStyles, Content: ".card {}"},
+		},
+	}
+
+	got := unresolvedImports(tool)
+	want := []unresolvedImport{
+		{File: "util.tsx", Specifier: "./card-shape-props", Suggested: "card-shape-props.ts"},
+		{File: "util.tsx", Specifier: "../secret"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v\nbut got %+v", want, got)
+	}
+
+	validation := validateToolOutput(tool)
+	if validation.Valid || len(validation.Errors) != 2 {
+		t.Fatalf("Expected 2 validation errors but got %q", validation.Errors)
+	}
+	if !strings.Contains(validation.Errors[1], `"../secret"`) {
+		t.Errorf("Expected the unresolvable import to be reported but got %q", validation.Errors[1])
+	}
+}
+
+func TestGenTldrawToolWithExtraFiles(t *testing.T) {
+	tool, err := parseTldrawToolXML(fakeToolOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	util := "import { counterProps } from './counter-props'\n" + tool.Util
+	props := "export const counterProps = {}\n"
+
+	withoutProps := "<tool id=\"counter\">\n<file name=\"tool.ts\">" + tool.Tool + "</file>\n<file name=\"util.tsx\">" + util + "</file>\n<file name=\"icon.svg\">" + tool.Icon + "</file>\n<file name=\"../../evil.ts\">x</file>\n</tool>"
+	onlyProps := "<tool id=\"counter\">\n<file name=\"counter-props.ts\">" + props + "</file>\n</tool>"
+
+	provider := NewFakeProvider(withoutProps, onlyProps)
+	generator := newTestGenerator(t, provider)
+
+	out, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{})
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+
+	if got := out.Attempts[0].MissingFiles; !reflect.DeepEqual(got, []string{"counter-props.ts"}) {
+		t.Errorf("Expected the imported file to be missing on the first attempt but got %q", got)
+	}
+	if !strings.Contains(provider.Requests()[1].Messages[2].Content, "- counter-props.ts") {
+		t.Error("Expected the repair to ask for the imported file")
+	}
+
+	want := []ToolFile{{Name: "counter-props.ts", Kind: FileKindProps, Content: props}}
+	if !reflect.DeepEqual(out.Files, want) {
+		t.Errorf("Expected extra files %+v\nbut got %+v", want, out.Files)
+	}
+
+	paths := newToolPaths(generator.Workspace, "counter")
+	written, err := os.ReadFile(paths.File("counter-props.ts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != props {
+		t.Error("Expected counter-props.ts to be written to the tool folder")
+	}
+
+	if _, err := os.Stat(paths.File("../../evil.ts")); !os.IsNotExist(err) {
+		t.Error("Expected files outside the allow-list to be ignored")
+	}
+
+	t.Run("Refine sees and updates extra files", func(t *testing.T) {
+		refinedProps := "export const counterProps = { step: 2 }\n"
+		provider := NewFakeProvider("<tool id=\"counter\">\n<file name=\"counter-props.ts\">" + refinedProps + "</file>\n</tool>")
+		generator.Provider = provider
+
+		refined, err := generator.RefineTldrawTool(context.Background(), "counter", "count in steps of two")
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		if !strings.Contains(provider.Requests()[0].Messages[len(provider.Requests()[0].Messages)-1].Content, `<file name="counter-props.ts">`) {
+			t.Error("Expected the refine prompt to include the extra file")
+		}
+		if !reflect.DeepEqual(refined.Changed, []string{"counter-props.ts"}) {
+			t.Errorf("Expected only counter-props.ts to change but got %q", refined.Changed)
+		}
+
+		written, err := os.ReadFile(paths.File("counter-props.ts"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(written) != refinedProps {
+			t.Error("Expected counter-props.ts to be rewritten")
+		}
+	})
+}
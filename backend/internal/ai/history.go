@@ -0,0 +1,316 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tlcrazy-backend/internal/textdiff"
+)
+
+const defaultHistoryDir = ".tlcrazy/history"
+
+var (
+	ErrVersionNotFound = errors.New("tool version not found")
+	ErrVersionExists   = errors.New("tool version already stored")
+)
+
+// ToolVersion is one installed version of a tool. Files maps each file name
+// to the hash of its content in the history store.
+type ToolVersion struct {
+	Version       int               `json:"version"`
+	Action        string            `json:"action"`
+	Name          string            `json:"name,omitempty"`
+	Description   string            `json:"description,omitempty"`
+	Query         string            `json:"query,omitempty"`
+	Model         string            `json:"model,omitempty"`
+	PromptVersion string            `json:"promptVersion,omitempty"`
+	Files         map[string]string `json:"files"`
+	CreatedAt     time.Time         `json:"createdAt"`
+
+	// RolledBackTo is the version a rollback restored.
+	RolledBackTo int `json:"rolledBackTo,omitempty"`
+}
+
+// HistoryStore keeps every installed version of every tool in Dir. File
+// contents are stored once under objects/ by hash, and each tool has a JSON
+// list of its versions.
+type HistoryStore struct {
+	Dir string
+	mu  sync.Mutex
+}
+
+func NewHistoryStore(dir string) *HistoryStore {
+	return &HistoryStore{Dir: dir}
+}
+
+// Versions returns the versions of toolId, oldest first.
+func (h *HistoryStore) Versions(toolId string) ([]ToolVersion, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.read(toolId)
+}
+
+// Version returns one version of toolId with the content of its files.
+func (h *HistoryStore) Version(toolId string, version int) (ToolVersion, TldrawToolOutput, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	versions, err := h.read(toolId)
+	if err != nil {
+		return ToolVersion{}, TldrawToolOutput{}, err
+	}
+
+	for _, v := range versions {
+		if v.Version != version {
+			continue
+		}
+
+		tool := TldrawToolOutput{Id: toolId, Name: v.Name, Description: v.Description}
+		for _, name := range sortedFileNames(v.Files) {
+			content, err := os.ReadFile(h.objectPath(v.Files[name]))
+			if err != nil {
+				return ToolVersion{}, TldrawToolOutput{}, fmt.Errorf("cannot read %s of version %d: %w", name, version, err)
+			}
+			tool.setFile(name, string(content))
+		}
+
+		return v, tool, nil
+	}
+
+	return ToolVersion{}, TldrawToolOutput{}, fmt.Errorf("%w: %s version %d", ErrVersionNotFound, toolId, version)
+}
+
+// Add stores the files of tool and appends version to its history. A zero
+// version number means the one after the last stored version, which keeps
+// numbers unique when a deleted tool is generated again. It returns the
+// version as stored.
+func (h *HistoryStore) Add(tool TldrawToolOutput, version ToolVersion) (ToolVersion, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := ensureDirectoryExists(filepath.Join(h.Dir, "objects")); err != nil {
+		return ToolVersion{}, err
+	}
+
+	versions, err := h.read(tool.Id)
+	if err != nil {
+		return ToolVersion{}, err
+	}
+	last := 0
+	for _, v := range versions {
+		if v.Version == version.Version {
+			return ToolVersion{}, fmt.Errorf("%w: %s version %d", ErrVersionExists, tool.Id, version.Version)
+		}
+		last = max(last, v.Version)
+	}
+	if version.Version == 0 {
+		version.Version = last + 1
+	}
+
+	version.Files = hashToolFiles(tool)
+	for _, file := range tool.AllFiles() {
+		path := h.objectPath(version.Files[file.Name])
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+
+		// Objects are immutable, so a crash can only leave a temp file behind
+		if err := os.WriteFile(path+".tmp", []byte(file.Content), 0644); err != nil {
+			return ToolVersion{}, err
+		}
+		if err := os.Rename(path+".tmp", path); err != nil {
+			return ToolVersion{}, err
+		}
+	}
+
+	if version.CreatedAt.IsZero() {
+		version.CreatedAt = time.Now().UTC()
+	}
+	versions = append(versions, version)
+
+	content, err := json.MarshalIndent(versions, "", "  ")
+	if err != nil {
+		return ToolVersion{}, err
+	}
+
+	tmpPath := h.path(tool.Id) + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0644); err != nil {
+		return ToolVersion{}, err
+	}
+
+	if err := os.Rename(tmpPath, h.path(tool.Id)); err != nil {
+		return ToolVersion{}, err
+	}
+
+	return version, nil
+}
+
+func (h *HistoryStore) read(toolId string) ([]ToolVersion, error) {
+	versions := []ToolVersion{}
+
+	content, err := os.ReadFile(h.path(toolId))
+	if errors.Is(err, os.ErrNotExist) {
+		return versions, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, &versions); err != nil {
+		return nil, fmt.Errorf("failed to parse history for %s: %v", toolId, err)
+	}
+
+	return versions, nil
+}
+
+func (h *HistoryStore) path(toolId string) string {
+	return filepath.Join(h.Dir, toolId+".json")
+}
+
+func (h *HistoryStore) objectPath(hash string) string {
+	return filepath.Join(h.Dir, "objects", strings.TrimPrefix(hash, "sha256:"))
+}
+
+func sortedFileNames(files map[string]string) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// recordVersion adds the tool as just installed to g.History as its next
+// version. Failures are logged since the tool is installed anyway.
+func (g *Generator) recordVersion(action string, tool TldrawToolOutput, origin ToolOrigin, rolledBackTo int) ToolVersion {
+	if g.History == nil {
+		return ToolVersion{}
+	}
+
+	version, err := g.History.Add(tool, ToolVersion{
+		Action:        action,
+		Name:          tool.Name,
+		Description:   tool.Description,
+		Query:         origin.Query,
+		Model:         origin.Model,
+		PromptVersion: origin.PromptVersion,
+		RolledBackTo:  rolledBackTo,
+	})
+	if err != nil {
+		log.Printf("Error saving history for %s: %s", tool.Id, err)
+	}
+
+	return version
+}
+
+// ToolVersions lists the installed versions of a tool, oldest first.
+func (g *Generator) ToolVersions(toolId string) ([]ToolVersion, error) {
+	if err := ValidateToolId(toolId); err != nil {
+		return nil, err
+	}
+	if g.History == nil {
+		return []ToolVersion{}, nil
+	}
+
+	return g.History.Versions(toolId)
+}
+
+// FileDiff is the change to one file between two versions. Diff is empty
+// when only the trailing newline changed.
+type FileDiff struct {
+	File   string `json:"file"`
+	Status string `json:"status"`
+	Diff   string `json:"diff"`
+}
+
+// DiffToolVersions compares every file of two versions of a tool. Unchanged
+// files are left out.
+func (g *Generator) DiffToolVersions(toolId string, from, to int) ([]FileDiff, error) {
+	if err := ValidateToolId(toolId); err != nil {
+		return nil, err
+	}
+	if g.History == nil {
+		return nil, fmt.Errorf("%w: %s version %d", ErrVersionNotFound, toolId, from)
+	}
+
+	fromVersion, fromTool, err := g.History.Version(toolId, from)
+	if err != nil {
+		return nil, err
+	}
+	toVersion, toTool, err := g.History.Version(toolId, to)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]string{}
+	for name, hash := range fromVersion.Files {
+		names[name] = hash
+	}
+	for name, hash := range toVersion.Files {
+		names[name] = hash
+	}
+
+	diffs := []FileDiff{}
+	for _, name := range sortedFileNames(names) {
+		fromHash, inFrom := fromVersion.Files[name]
+		toHash, inTo := toVersion.Files[name]
+		if fromHash == toHash {
+			continue
+		}
+
+		status := "modified"
+		switch {
+		case !inFrom:
+			status = "added"
+		case !inTo:
+			status = "removed"
+		}
+
+		a, _ := fromTool.file(name)
+		b, _ := toTool.file(name)
+		diffs = append(diffs, FileDiff{
+			File:   name,
+			Status: status,
+			Diff:   textdiff.Unified(fmt.Sprintf("v%d/%s", from, name), fmt.Sprintf("v%d/%s", to, name), a, b),
+		})
+	}
+
+	return diffs, nil
+}
+
+// RollbackTool reinstalls a prior version of a tool as its newest version.
+func (g *Generator) RollbackTool(ctx context.Context, toolId string, version int) (ToolVersion, error) {
+	if err := ValidateToolId(toolId); err != nil {
+		return ToolVersion{}, err
+	}
+	if g.History == nil {
+		return ToolVersion{}, fmt.Errorf("%w: %s version %d", ErrVersionNotFound, toolId, version)
+	}
+
+	target, tool, err := g.History.Version(toolId, version)
+	if err != nil {
+		return ToolVersion{}, err
+	}
+
+	origin := ToolOrigin{Query: target.Query, Model: target.Model, PromptVersion: target.PromptVersion}
+
+	writeCtx, cancel := withStageTimeout(ctx, g.Timeouts.Write)
+	defer cancel()
+
+	if _, err := g.store().Install(writeCtx, tool, newToolEntry(tool, origin)); err != nil {
+		return ToolVersion{}, fmt.Errorf("%w %s: %w", ErrWriteFailed, toolId, err)
+	}
+
+	return g.recordVersion("rollback", tool, origin, version), nil
+}
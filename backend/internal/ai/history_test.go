@@ -0,0 +1,135 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestToolHistory(t *testing.T) {
+	tool, err := parseTldrawToolXML(fakeToolOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refinedUtil := strings.Replace(tool.Util, "count: 0", "count: 10", 1)
+	refined := "<tool id=\"counter\">\n<file name=\"util.tsx\">" + refinedUtil + "</file>\n</tool>"
+
+	generator := newTestGenerator(t, NewFakeProvider(fakeToolOutput, refined, fakeToolOutput))
+	paths := newToolPaths(generator.Workspace, "counter")
+
+	if _, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{}); err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+	if _, err := generator.RefineTldrawTool(context.Background(), "counter", "start at ten"); err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+
+	t.Run("Lists versions", func(t *testing.T) {
+		versions, err := generator.ToolVersions("counter")
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		if len(versions) != 2 {
+			t.Fatalf("Expected 2 versions but got %+v", versions)
+		}
+		if v := versions[0]; v.Version != 1 || v.Action != "generate" || v.Query != "a counter button" || v.Model != "fake" {
+			t.Errorf("Unexpected first version %+v", v)
+		}
+		if v := versions[1]; v.Version != 2 || v.Action != "refine" || v.Query != "start at ten" {
+			t.Errorf("Unexpected second version %+v", v)
+		}
+
+		// Unchanged files are stored once
+		objects, err := os.ReadDir(filepath.Join(generator.History.Dir, "objects"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(objects) != 4 {
+			t.Errorf("Expected 4 stored files but got %d", len(objects))
+		}
+	})
+
+	t.Run("Diffs versions", func(t *testing.T) {
+		diffs, err := generator.DiffToolVersions("counter", 1, 2)
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		if len(diffs) != 1 || diffs[0].File != "util.tsx" || diffs[0].Status != "modified" {
+			t.Fatalf("Expected util.tsx to be modified but got %+v", diffs)
+		}
+		if !strings.Contains(diffs[0].Diff, "-\t\treturn { w: 160, h: 80, count: 0 }\n+\t\treturn { w: 160, h: 80, count: 10 }\n") {
+			t.Errorf("Expected the changed prop in the diff but got\n%s", diffs[0].Diff)
+		}
+
+		if _, err := generator.DiffToolVersions("counter", 1, 9); !errors.Is(err, ErrVersionNotFound) {
+			t.Errorf("Expected ErrVersionNotFound but got %v", err)
+		}
+	})
+
+	t.Run("Rolls back", func(t *testing.T) {
+		version, err := generator.RollbackTool(context.Background(), "counter", 1)
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		if version.Version != 3 || version.Action != "rollback" || version.RolledBackTo != 1 {
+			t.Errorf("Unexpected rollback version %+v", version)
+		}
+
+		util, err := os.ReadFile(paths.Util)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(util) != tool.Util {
+			t.Error("Expected the first util.tsx to be live again")
+		}
+
+		manifest, err := NewToolRegistry(paths.ToolsJSON).Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry, _ := manifest.Get("counter"); entry.Version != 3 {
+			t.Errorf("Expected the registry at version 3 but got %+v", entry)
+		}
+
+		if _, err := generator.RollbackTool(context.Background(), "counter", 7); !errors.Is(err, ErrVersionNotFound) {
+			t.Errorf("Expected ErrVersionNotFound but got %v", err)
+		}
+		if _, err := generator.RollbackTool(context.Background(), "../counter", 1); !errors.Is(err, ErrInvalidToolId) {
+			t.Errorf("Expected ErrInvalidToolId but got %v", err)
+		}
+	})
+	t.Run("Continues after a delete", func(t *testing.T) {
+		if err := generator.DeleteTool(context.Background(), "counter"); err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		if _, err := generator.GenTldrawTool(context.Background(), "a counter again", GenerateOptions{}); err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		versions, err := generator.ToolVersions("counter")
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		if len(versions) != 4 || versions[3].Version != 4 {
+			t.Fatalf("Expected the new tool to be version 4 but got %+v", versions)
+		}
+
+		version, _, err := generator.History.Version("counter", 4)
+		if err != nil || version.Query != "a counter again" {
+			t.Errorf("Expected the regenerated tool as version 4 but got %+v, %v", version, err)
+		}
+		if _, err := generator.DiffToolVersions("counter", 1, 4); err != nil {
+			t.Error("Got an error but didn't expect one", err)
+		}
+	})
+
+	t.Run("Rejects stored versions", func(t *testing.T) {
+		_, err := generator.History.Add(tool, ToolVersion{Version: 2, Action: "generate"})
+		if !errors.Is(err, ErrVersionExists) {
+			t.Errorf("Expected ErrVersionExists but got %v", err)
+		}
+	})
+}
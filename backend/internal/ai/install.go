@@ -0,0 +1,366 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// installStep is one stage of installing a tool into the frontend. Every step
+// after staging is undone when a later one fails.
+type installStep string
+
+const (
+	installStage    installStep = "stage"
+	installValidate installStep = "validate"
+	installFolder   installStep = "folder"
+	installIcon     installStep = "icon"
+	installManifest installStep = "manifest"
+)
+
+// installFault lets tests fail an installation at a given step.
+type installFault func(step installStep) error
+
+// toolInstall installs a tool as a transaction. Every file is staged next to
+// its destination so the commit is a series of renames on one filesystem,
+// and tools.json is updated last so it never points at a partial tool.
+type toolInstall struct {
+	ctx      context.Context
+	tool     TldrawToolOutput
+	entry    ToolEntry
+	paths    toolPaths
+	registry *ToolRegistry
+	fault    installFault
+
+	staging        string
+	stagedFolder   string
+	stagedManifest string
+	stagedIcon     string
+
+	backupFolder string
+	backupIcon   string
+
+	// What the commit has done so far, for the rollback
+	folderMoved     bool
+	folderInstalled bool
+	iconMoved       bool
+	iconInstalled   bool
+}
+
+// installTool installs tool with entry as its manifest entry and returns the
+// entry as stored.
+func installTool(ctx context.Context, tool TldrawToolOutput, entry ToolEntry, paths toolPaths, fault installFault) (ToolEntry, error) {
+	t := &toolInstall{ctx: ctx, tool: tool, entry: entry, paths: paths, registry: NewToolRegistry(paths.ToolsJSON), fault: fault}
+	defer t.cleanup()
+
+	// Hold the registry for the whole install, so no other writer changes
+	// tools.json between staging it and renaming it into place
+	unlock, err := t.registry.lock()
+	if err != nil {
+		return ToolEntry{}, fmt.Errorf("cannot install %s: %w", tool.Id, err)
+	}
+	defer unlock()
+
+	steps := []struct {
+		step installStep
+		run  func() error
+	}{
+		{installStage, t.stage},
+		{installValidate, t.validate},
+		{installFolder, t.commitFolder},
+		{installIcon, t.commitIcon},
+		{installManifest, t.commitManifest},
+	}
+
+	for _, s := range steps {
+		err := t.check(s.step)
+		if err == nil {
+			err = s.run()
+		}
+		if err != nil {
+			t.rollback()
+			return ToolEntry{}, fmt.Errorf("cannot install %s: %s failed: %w", tool.Id, s.step, err)
+		}
+	}
+
+	log.Printf("Installed tool %s", tool.Id)
+	return t.entry, nil
+}
+
+func (t *toolInstall) check(step installStep) error {
+	if err := t.ctx.Err(); err != nil {
+		return err
+	}
+	if t.fault != nil {
+		return t.fault(step)
+	}
+
+	return nil
+}
+
+// stage writes the tool folder and the new tools.json into a temp directory
+// inside the tools directory, and the icon into a temp file next to it.
+func (t *toolInstall) stage() error {
+	toolsDir := filepath.Dir(t.paths.Folder)
+	if err := ensureDirectoryExists(toolsDir); err != nil {
+		return err
+	}
+	if err := ensureDirectoryExists(filepath.Dir(t.paths.Icon)); err != nil {
+		return err
+	}
+
+	staging, err := os.MkdirTemp(toolsDir, ".install-"+t.tool.Id+"-")
+	if err != nil {
+		return err
+	}
+	t.staging = staging
+	t.stagedFolder = filepath.Join(staging, "tool")
+	t.stagedManifest = filepath.Join(staging, "tools.json")
+	t.backupFolder = filepath.Join(staging, "previous")
+
+	if err := os.Mkdir(t.stagedFolder, 0755); err != nil {
+		return err
+	}
+	for _, file := range t.tool.AllFiles() {
+		if file.Kind == FileKindIcon {
+			continue
+		}
+
+		path := filepath.Join(t.stagedFolder, file.Name)
+		log.Println("Writing to", path)
+		if err := os.WriteFile(path, []byte(file.Content), 0644); err != nil {
+			return err
+		}
+	}
+
+	icon, err := os.CreateTemp(filepath.Dir(t.paths.Icon), "."+t.tool.Id+"-*.svg")
+	if err != nil {
+		return err
+	}
+	t.stagedIcon = icon.Name()
+	t.backupIcon = t.stagedIcon + ".previous"
+
+	_, err = icon.WriteString(t.tool.Icon)
+	if closeErr := icon.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	manifest, err := t.registry.read()
+	if err != nil {
+		return err
+	}
+	t.entry = manifest.put(t.entry, time.Now().UTC())
+
+	data, err := encodeManifest(manifest)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(t.stagedManifest, data, 0644)
+}
+
+// validate checks the tool is complete and reads the staged files back, so a
+// short write is caught before anything is replaced.
+func (t *toolInstall) validate() error {
+	if result := validateToolOutput(t.tool); !result.Valid {
+		return fmt.Errorf("invalid tool: %s", strings.Join(result.Errors, ", "))
+	}
+
+	staged := map[string]string{t.stagedIcon: t.tool.Icon}
+	for _, file := range t.tool.AllFiles() {
+		if file.Kind != FileKindIcon {
+			staged[filepath.Join(t.stagedFolder, file.Name)] = file.Content
+		}
+	}
+
+	for path, content := range staged {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if string(data) != content {
+			return fmt.Errorf("staged file %s does not match", path)
+		}
+	}
+
+	data, err := os.ReadFile(t.stagedManifest)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := decodeManifest(data, time.Time{})
+	if err != nil {
+		return err
+	}
+	if _, ok := manifest.Get(t.tool.Id); !ok {
+		return fmt.Errorf("staged manifest is missing %s", t.tool.Id)
+	}
+
+	return nil
+}
+
+func (t *toolInstall) commitFolder() error {
+	if _, err := os.Lstat(t.paths.Folder); err == nil {
+		if err := os.Rename(t.paths.Folder, t.backupFolder); err != nil {
+			return err
+		}
+		t.folderMoved = true
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err := os.Rename(t.stagedFolder, t.paths.Folder); err != nil {
+		return err
+	}
+	t.folderInstalled = true
+
+	return nil
+}
+
+func (t *toolInstall) commitIcon() error {
+	if _, err := os.Lstat(t.paths.Icon); err == nil {
+		if err := os.Rename(t.paths.Icon, t.backupIcon); err != nil {
+			return err
+		}
+		t.iconMoved = true
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err := os.Rename(t.stagedIcon, t.paths.Icon); err != nil {
+		return err
+	}
+	t.iconInstalled = true
+
+	return nil
+}
+
+// commitManifest is the last step, so it never needs to be undone.
+func (t *toolInstall) commitManifest() error {
+	return os.Rename(t.stagedManifest, t.paths.ToolsJSON)
+}
+
+// rollback puts back whatever the commit replaced.
+func (t *toolInstall) rollback() {
+	restore := func(installed, moved bool, path, backup string) {
+		if installed {
+			if err := os.RemoveAll(path); err != nil {
+				log.Println("ERROR: failed to remove", path, err)
+			}
+		}
+		if moved {
+			if err := os.Rename(backup, path); err != nil {
+				log.Println("ERROR: failed to restore", path, err)
+			}
+		}
+	}
+
+	restore(t.iconInstalled, t.iconMoved, t.paths.Icon, t.backupIcon)
+	restore(t.folderInstalled, t.folderMoved, t.paths.Folder, t.backupFolder)
+}
+
+func (t *toolInstall) cleanup() {
+	for _, path := range []string{t.staging, t.stagedIcon, t.backupIcon} {
+		if path == "" {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			log.Println("ERROR: failed to clean up", path, err)
+		}
+	}
+}
+
+// uninstallTool removes the tool folder, its icon and its manifest entry as
+// one transaction. Files are moved aside first and put back if a later step
+// fails.
+func uninstallTool(ctx context.Context, toolId string, paths toolPaths, fault installFault) error {
+	t := &toolInstall{ctx: ctx, tool: TldrawToolOutput{Id: toolId}, paths: paths, registry: NewToolRegistry(paths.ToolsJSON), fault: fault}
+	defer t.cleanup()
+
+	unlock, err := t.registry.lock()
+	if err != nil {
+		return fmt.Errorf("cannot uninstall %s: %w", toolId, err)
+	}
+	defer unlock()
+
+	manifest, err := t.registry.read()
+	if err != nil {
+		return err
+	}
+	_, registered := manifest.Get(toolId)
+	if _, err := os.Lstat(paths.Folder); errors.Is(err, os.ErrNotExist) && !registered {
+		return ErrToolNotFound
+	}
+
+	steps := []struct {
+		step installStep
+		run  func() error
+	}{
+		{installStage, t.stageRemoval},
+		{installFolder, func() error { return t.moveAside(paths.Folder, t.backupFolder, &t.folderMoved) }},
+		{installIcon, func() error { return t.moveAside(paths.Icon, t.backupIcon, &t.iconMoved) }},
+		{installManifest, func() error {
+			manifest.remove(toolId)
+			return t.registry.write(manifest)
+		}},
+	}
+
+	for _, s := range steps {
+		err := t.check(s.step)
+		if err == nil {
+			err = s.run()
+		}
+		if err != nil {
+			t.rollback()
+			return fmt.Errorf("cannot uninstall %s: %s failed: %w", toolId, s.step, err)
+		}
+	}
+
+	log.Printf("Uninstalled tool %s", toolId)
+	return nil
+}
+
+// stageRemoval picks the places the tool is moved to, next to where it is
+// installed.
+func (t *toolInstall) stageRemoval() error {
+	staging, err := os.MkdirTemp(filepath.Dir(t.paths.Folder), ".uninstall-"+t.tool.Id+"-")
+	if err != nil {
+		return err
+	}
+	t.staging = staging
+	t.backupFolder = filepath.Join(staging, "previous")
+
+	if err := ensureDirectoryExists(filepath.Dir(t.paths.Icon)); err != nil {
+		return err
+	}
+	icon, err := os.CreateTemp(filepath.Dir(t.paths.Icon), "."+t.tool.Id+"-*.svg.previous")
+	if err != nil {
+		return err
+	}
+	t.backupIcon = icon.Name()
+
+	return icon.Close()
+}
+
+func (t *toolInstall) moveAside(path, backup string, moved *bool) error {
+	if _, err := os.Lstat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := os.Rename(path, backup); err != nil {
+		return err
+	}
+	*moved = true
+
+	return nil
+}
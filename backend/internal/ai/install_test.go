@@ -0,0 +1,162 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tlcrazy-backend/internal/config"
+)
+
+// failAt fails an installation with err at step.
+func failAt(step installStep, err error) installFault {
+	return func(s installStep) error {
+		if s == step {
+			return err
+		}
+		return nil
+	}
+}
+
+// readInstall returns every file under the tools and icons folders, so tests
+// can check an installation left no trace.
+func readInstall(t *testing.T, workspace config.Workspace) map[string]string {
+	t.Helper()
+
+	files := map[string]string{}
+	for _, root := range []string{workspace.ToolsPath(), workspace.IconsPath()} {
+		err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if err != nil || d.IsDir() || strings.HasSuffix(path, ".lock") {
+				return err
+			}
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(workspace.Root, path)
+			files[filepath.ToSlash(rel)] = string(content)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return files
+}
+
+func TestInstallRollback(t *testing.T) {
+	tool, err := parseTldrawToolXML(fakeToolOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := tool
+	previous.Util = strings.Replace(tool.Util, "count: 0", "count: 1", 1)
+	previous.Icon = "<svg>previous</svg>"
+	previous.addExtraFile("counter-props.ts", "export default {}")
+
+	steps := []installStep{installStage, installValidate, installFolder, installIcon, installManifest}
+	for _, step := range steps {
+		for _, existing := range []bool{false, true} {
+			name := string(step) + " fresh"
+			if existing {
+				name = string(step) + " over existing"
+			}
+
+			t.Run(name, func(t *testing.T) {
+				t.Parallel()
+
+				workspace := newTestApp(t)
+				if existing {
+					if _, err := NewFileToolStore(workspace).Install(context.Background(), previous, ToolEntry{}); err != nil {
+						t.Fatal("Got an error but didn't expect one", err)
+					}
+				}
+				before := readInstall(t, workspace)
+
+				injected := errors.New("injected")
+				store := &FileToolStore{Workspace: workspace, fault: failAt(step, injected)}
+
+				_, err := store.Install(context.Background(), tool, ToolEntry{})
+				if !errors.Is(err, injected) {
+					t.Fatalf("Expected the injected error but got %v", err)
+				}
+
+				after := readInstall(t, workspace)
+				if len(after) != len(before) {
+					t.Errorf("Expected %d files\nbut got %v", len(before), after)
+				}
+				for path, content := range before {
+					if after[path] != content {
+						t.Errorf("Expected %s to be restored", path)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestInstallReplacesTool(t *testing.T) {
+	tool, err := parseTldrawToolXML(fakeToolOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := tool
+	previous.addExtraFile("counter-props.ts", "export default {}")
+
+	workspace := newTestApp(t)
+	paths := newToolPaths(workspace, tool.Id)
+	for _, version := range []TldrawToolOutput{previous, tool} {
+		if _, err := NewFileToolStore(workspace).Install(context.Background(), version, ToolEntry{}); err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+	}
+
+	if _, err := os.Stat(paths.File("counter-props.ts")); !os.IsNotExist(err) {
+		t.Error("Expected files of the previous version to be removed")
+	}
+
+	manifest, err := NewToolRegistry(paths.ToolsJSON).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, _ := manifest.Get(tool.Id); entry.Version != 2 || entry.Hashes["counter-props.ts"] != "" {
+		t.Errorf("Expected the second version in the manifest but got %+v", entry)
+	}
+
+	want := map[string]string{
+		"components/tldraw-custom-tools/counter/tool.ts":  tool.Tool,
+		"components/tldraw-custom-tools/counter/util.tsx": tool.Util,
+		"public/custom-tool-icons/counter.svg":            tool.Icon,
+	}
+	got := readInstall(t, workspace)
+	delete(got, "components/tldraw-custom-tools/tools.json")
+	if len(got) != len(want) {
+		t.Errorf("Expected only the tool files but got %v", got)
+	}
+	for path, content := range want {
+		if got[path] != content {
+			t.Errorf("Expected %s to be installed", path)
+		}
+	}
+}
+
+func TestInstallRejectsIncompleteTool(t *testing.T) {
+	workspace := newTestApp(t)
+	before := readInstall(t, workspace)
+
+	_, err := NewFileToolStore(workspace).Install(context.Background(), TldrawToolOutput{Id: "counter", Tool: "x", Icon: "x"}, ToolEntry{})
+	if err == nil || !strings.Contains(err.Error(), "missing util.tsx") {
+		t.Errorf("Expected the missing util.tsx to be reported but got %v", err)
+	}
+
+	if after := readInstall(t, workspace); len(after) != len(before) {
+		t.Errorf("Expected nothing to be installed but got %v", after)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package ai
+
+import "sync"
+
+var fileLocks sync.Map
+
+// lockFile only excludes other goroutines of this process on platforms
+// without flock.
+func lockFile(path string) (func(), error) {
+	mu, _ := fileLocks.LoadOrStore(path, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+
+	return mu.(*sync.Mutex).Unlock, nil
+}
@@ -0,0 +1,246 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// OpenAIProvider talks to any server implementing the OpenAI
+// /v1/chat/completions wire format, e.g. llama.cpp server, vLLM or Ollama.
+type OpenAIProvider struct {
+	BaseURL    string
+	APIKey     string
+	Model      string
+	Stream     bool
+	HTTPClient *http.Client
+}
+
+func NewOpenAIProvider(baseURL, apiKey, model string) *OpenAIProvider {
+	return &OpenAIProvider{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		APIKey:     apiKey,
+		Model:      model,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+type openAIMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []openAIToolCall `json:"tool_calls,omitempty"`
+}
+
+type openAIFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+	Arguments   string          `json:"arguments,omitempty"`
+}
+
+type openAITool struct {
+	Type     string         `json:"type"`
+	Function openAIFunction `json:"function"`
+}
+
+type openAIToolCall = openAITool
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIChatRequest struct {
+	Model         string               `json:"model,omitempty"`
+	Messages      []openAIMessage      `json:"messages"`
+	MaxTokens     int                  `json:"max_tokens,omitempty"`
+	Stream        bool                 `json:"stream,omitempty"`
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+	Tools         []openAITool         `json:"tools,omitempty"`
+	ToolChoice    *openAITool          `json:"tool_choice,omitempty"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message      openAIMessage `json:"message"`
+		Delta        openAIMessage `json:"delta"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+func (p *OpenAIProvider) ModelName() string {
+	return p.Model
+}
+
+func (p *OpenAIProvider) Complete(ctx context.Context, req CompletionRequest) (CompletionResponse, error) {
+	messages := make([]openAIMessage, 0, len(req.Messages)+1)
+	if req.System != "" {
+		messages = append(messages, openAIMessage{Role: "system", Content: req.System})
+	}
+	for _, msg := range req.Messages {
+		messages = append(messages, openAIMessage{Role: string(msg.Role), Content: msg.Content})
+	}
+
+	stream := (p.Stream || req.OnDelta != nil) && len(req.Tools) == 0
+
+	body := openAIChatRequest{
+		Model:     p.Model,
+		Messages:  messages,
+		MaxTokens: req.MaxTokens,
+		Stream:    stream,
+	}
+	if stream {
+		body.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	}
+	for _, tool := range req.Tools {
+		body.Tools = append(body.Tools, openAITool{
+			Type: "function",
+			Function: openAIFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.InputSchema,
+			},
+		})
+	}
+	if req.ToolChoice != "" {
+		body.ToolChoice = &openAITool{Type: "function", Function: openAIFunction{Name: req.ToolChoice}}
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return CompletionResponse{}, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.BaseURL+"/chat/completions", bytes.NewReader(payload))
+	if err != nil {
+		return CompletionResponse{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if p.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.APIKey)
+	}
+
+	client := p.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		return CompletionResponse{}, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode < 200 || httpResp.StatusCode > 299 {
+		errBody, _ := io.ReadAll(io.LimitReader(httpResp.Body, 4096))
+		return CompletionResponse{}, fmt.Errorf("chat completions request failed with status %d: %s", httpResp.StatusCode, strings.TrimSpace(string(errBody)))
+	}
+
+	if stream {
+		return readOpenAIStream(httpResp.Body, req.OnDelta)
+	}
+
+	var chatResp openAIChatResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&chatResp); err != nil {
+		return CompletionResponse{}, fmt.Errorf("failed to decode chat completions response: %v", err)
+	}
+	if len(chatResp.Choices) == 0 {
+		return CompletionResponse{}, fmt.Errorf("chat completions response has no choices")
+	}
+
+	out := CompletionResponse{
+		Text:       chatResp.Choices[0].Message.Content,
+		StopReason: openAIStopReason(chatResp.Choices[0].FinishReason),
+	}
+	for _, call := range chatResp.Choices[0].Message.ToolCalls {
+		out.ToolCalls = append(out.ToolCalls, ToolCall{
+			Name:  call.Function.Name,
+			Input: json.RawMessage(call.Function.Arguments),
+		})
+	}
+	if chatResp.Usage != nil {
+		out.Usage = Usage{
+			InputTokens:  chatResp.Usage.PromptTokens,
+			OutputTokens: chatResp.Usage.CompletionTokens,
+		}
+	}
+
+	return out, nil
+}
+
+// readOpenAIStream consumes a server-sent events body and stitches the deltas
+// back into a single response, forwarding each delta to onDelta if set.
+func readOpenAIStream(body io.Reader, onDelta func(text string)) (CompletionResponse, error) {
+	var out CompletionResponse
+	var text strings.Builder
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk openAIChatResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return CompletionResponse{}, fmt.Errorf("failed to decode chat completions chunk: %v", err)
+		}
+
+		if chunk.Usage != nil {
+			out.Usage = Usage{
+				InputTokens:  chunk.Usage.PromptTokens,
+				OutputTokens: chunk.Usage.CompletionTokens,
+			}
+		}
+
+		for _, choice := range chunk.Choices {
+			text.WriteString(choice.Delta.Content)
+			if onDelta != nil && choice.Delta.Content != "" {
+				onDelta(choice.Delta.Content)
+			}
+			if choice.FinishReason != "" {
+				out.StopReason = openAIStopReason(choice.FinishReason)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return CompletionResponse{}, err
+	}
+
+	out.Text = text.String()
+	if out.StopReason == "" {
+		out.StopReason = StopReasonOther
+	}
+
+	return out, nil
+}
+
+func openAIStopReason(reason string) StopReason {
+	switch reason {
+	case "stop":
+		return StopReasonEndTurn
+	case "length":
+		return StopReasonMaxTokens
+	case "tool_calls":
+		return StopReasonToolUse
+	default:
+		return StopReasonOther
+	}
+}
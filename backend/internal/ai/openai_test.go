@@ -0,0 +1,181 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func newOpenAITestServer(t *testing.T, handle func(w http.ResponseWriter, body openAIChatRequest)) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var body openAIChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode request body: %s", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		handle(w, body)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestOpenAIProvider(t *testing.T) {
+	req := CompletionRequest{
+		System:    SystemPromptGenTldrawTool,
+		MaxTokens: 128,
+		Messages: []ChatMessage{
+			{Role: RoleUser, Content: "a counter"},
+		},
+	}
+
+	checkRequest := func(t *testing.T, body openAIChatRequest) {
+		if len(body.Messages) != 2 {
+			t.Fatalf("Expected 2 messages but got %d", len(body.Messages))
+		}
+		if body.Messages[0].Role != "system" || body.Messages[0].Content != SystemPromptGenTldrawTool {
+			t.Error("Expected the system prompt to be sent as a system message")
+		}
+		if body.Messages[1].Role != "user" || body.Messages[1].Content != "a counter" {
+			t.Errorf("Unexpected user message %+v", body.Messages[1])
+		}
+		if body.Model != "local-model" || body.MaxTokens != 128 {
+			t.Errorf("Unexpected model or max tokens %q %d", body.Model, body.MaxTokens)
+		}
+	}
+
+	t.Run("Non-streaming response", func(t *testing.T) {
+		server := newOpenAITestServer(t, func(w http.ResponseWriter, body openAIChatRequest) {
+			checkRequest(t, body)
+			if body.Stream {
+				t.Error("Expected a non-streaming request")
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{
+				"choices": [{"message": {"role": "assistant", "content": "<tool id=\"x\"></tool>"}, "finish_reason": "length"}],
+				"usage": {"prompt_tokens": 10, "completion_tokens": 5}
+			}`)
+		})
+
+		provider := NewOpenAIProvider(server.URL+"/v1/", "", "local-model")
+		resp, err := provider.Complete(context.Background(), req)
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		want := CompletionResponse{
+			Text:       `<tool id="x"></tool>`,
+			Usage:      Usage{InputTokens: 10, OutputTokens: 5},
+			StopReason: StopReasonMaxTokens,
+		}
+		if !reflect.DeepEqual(resp, want) {
+			t.Errorf("Expected %+v\nbut got %+v", want, resp)
+		}
+	})
+
+	t.Run("Streaming response", func(t *testing.T) {
+		server := newOpenAITestServer(t, func(w http.ResponseWriter, body openAIChatRequest) {
+			checkRequest(t, body)
+			if !body.Stream {
+				t.Error("Expected a streaming request")
+			}
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, chunk := range []string{
+				`{"choices":[{"delta":{"role":"assistant","content":""}}]}`,
+				`{"choices":[{"delta":{"content":"<tool "}}]}`,
+				`{"choices":[{"delta":{"content":"id=\"x\">"}}]}`,
+				`{"choices":[{"delta":{"content":"</tool>"},"finish_reason":"stop"}]}`,
+				`{"choices":[],"usage":{"prompt_tokens":7,"completion_tokens":3}}`,
+				`[DONE]`,
+			} {
+				fmt.Fprintf(w, "data: %s\n\n", chunk)
+			}
+		})
+
+		provider := NewOpenAIProvider(server.URL+"/v1", "secret", "local-model")
+		provider.Stream = true
+
+		resp, err := provider.Complete(context.Background(), req)
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		want := CompletionResponse{
+			Text:       `<tool id="x"></tool>`,
+			Usage:      Usage{InputTokens: 7, OutputTokens: 3},
+			StopReason: StopReasonEndTurn,
+		}
+		if !reflect.DeepEqual(resp, want) {
+			t.Errorf("Expected %+v\nbut got %+v", want, resp)
+		}
+	})
+
+	t.Run("Tool calls", func(t *testing.T) {
+		server := newOpenAITestServer(t, func(w http.ResponseWriter, body openAIChatRequest) {
+			if len(body.Tools) != 1 || body.Tools[0].Function.Name != writeToolName {
+				t.Errorf("Expected the %s function to be offered", writeToolName)
+			}
+			if body.ToolChoice == nil || body.ToolChoice.Function.Name != writeToolName {
+				t.Errorf("Expected the %s function to be forced", writeToolName)
+			}
+			if body.Stream {
+				t.Error("Expected tool calls not to be streamed")
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{
+				"choices": [{
+					"message": {"role": "assistant", "content": null, "tool_calls": [
+						{"type": "function", "function": {"name": "write_tldraw_tool", "arguments": "{\"id\":\"x\"}"}}
+					]},
+					"finish_reason": "tool_calls"
+				}]
+			}`)
+		})
+
+		provider := NewOpenAIProvider(server.URL+"/v1", "", "local-model")
+		provider.Stream = true
+
+		toolReq := req
+		toolReq.Tools = []ToolSpec{writeToolSpec}
+		toolReq.ToolChoice = writeToolName
+
+		resp, err := provider.Complete(context.Background(), toolReq)
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		want := []ToolCall{{Name: writeToolName, Input: json.RawMessage(`{"id":"x"}`)}}
+		if !reflect.DeepEqual(resp.ToolCalls, want) || resp.StopReason != StopReasonToolUse {
+			t.Errorf("Expected tool call %q but got %+v", want, resp)
+		}
+	})
+
+	t.Run("Error status", func(t *testing.T) {
+		server := newOpenAITestServer(t, func(w http.ResponseWriter, body openAIChatRequest) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, "model is loading")
+		})
+
+		provider := NewOpenAIProvider(server.URL+"/v1", "", "local-model")
+		if _, err := provider.Complete(context.Background(), req); err == nil {
+			t.Error("Expected an error but didn't get one")
+		}
+	})
+}
@@ -0,0 +1,231 @@
+package ai
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ErrPolicyBlocked is returned when generated code breaks the security
+// policy. The output is still returned so callers can show the verdict.
+var ErrPolicyBlocked = errors.New("tool blocked by security policy")
+
+type PolicyAction string
+
+const (
+	// PolicyBlock stops the tool from being written.
+	PolicyBlock PolicyAction = "block"
+	// PolicyFlag writes the tool but reports the finding.
+	PolicyFlag PolicyAction = "flag"
+)
+
+const urlRule = "url-not-allowed"
+
+type PolicyRule struct {
+	Id      string       `json:"id"`
+	Action  PolicyAction `json:"action"`
+	Message string       `json:"message"`
+	Pattern string       `json:"pattern"`
+
+	re *regexp.Regexp
+}
+
+// PolicyConfig is the JSON form of a policy. URLs in the sources whose host
+// is not in AllowedHosts get URLAction. A host like "*.example.com" allows
+// every subdomain of example.com.
+type PolicyConfig struct {
+	Rules        []PolicyRule `json:"rules"`
+	AllowedHosts []string     `json:"allowedHosts"`
+	URLAction    PolicyAction `json:"urlAction"`
+}
+
+// Policy scans generated sources for APIs and URLs that tools must not use.
+// Tools run in the user's page, so anything they do the page can do.
+type Policy struct {
+	rules        []PolicyRule
+	allowedHosts []string
+	urlAction    PolicyAction
+}
+
+type PolicyFinding struct {
+	Rule    string       `json:"rule"`
+	Action  PolicyAction `json:"action"`
+	Message string       `json:"message"`
+	File    string       `json:"file"`
+	Line    int          `json:"line"`
+	Match   string       `json:"match"`
+}
+
+func (f PolicyFinding) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s [%s]", f.File, f.Line, f.Action, f.Message, f.Rule)
+}
+
+type PolicyVerdict struct {
+	Blocked  bool            `json:"blocked"`
+	Findings []PolicyFinding `json:"findings"`
+}
+
+//go:embed policy.json
+var defaultPolicyConfig []byte
+
+var defaultPolicy *Policy
+
+func init() {
+	var err error
+	defaultPolicy, err = ParsePolicy(defaultPolicyConfig)
+	if err != nil {
+		panic(fmt.Sprintf("cannot load default policy: %s", err))
+	}
+}
+
+// DefaultPolicy returns the policy embedded in the binary.
+func DefaultPolicy() *Policy {
+	return defaultPolicy
+}
+
+func NewPolicy(config PolicyConfig) (*Policy, error) {
+	seen := map[string]bool{urlRule: true}
+	policy := &Policy{urlAction: config.URLAction}
+
+	if !policy.urlAction.valid() {
+		return nil, fmt.Errorf("unknown url action %q", config.URLAction)
+	}
+	if policy.urlAction == "" {
+		policy.urlAction = PolicyBlock
+	}
+
+	for i, rule := range config.Rules {
+		if rule.Id == "" {
+			return nil, fmt.Errorf("rule %d has no id", i)
+		}
+		if seen[rule.Id] {
+			return nil, fmt.Errorf("duplicate rule %q", rule.Id)
+		}
+		seen[rule.Id] = true
+
+		if !rule.Action.valid() {
+			return nil, fmt.Errorf("rule %q has unknown action %q", rule.Id, rule.Action)
+		}
+		if rule.Action == "" {
+			rule.Action = PolicyBlock
+		}
+
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q has invalid pattern: %v", rule.Id, err)
+		}
+		rule.re = re
+
+		policy.rules = append(policy.rules, rule)
+	}
+
+	for _, host := range config.AllowedHosts {
+		policy.allowedHosts = append(policy.allowedHosts, strings.ToLower(host))
+	}
+
+	return policy, nil
+}
+
+// ParsePolicy reads a policy from its JSON form, a PolicyConfig object.
+func ParsePolicy(data []byte) (*Policy, error) {
+	var config PolicyConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid policy: %v", err)
+	}
+
+	return NewPolicy(config)
+}
+
+func LoadPolicyFile(name string) (*Policy, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePolicy(data)
+}
+
+func (a PolicyAction) valid() bool {
+	return a == "" || a == PolicyBlock || a == PolicyFlag
+}
+
+var urlPattern = regexp.MustCompile("\\b(?:https?|wss?)://[^\\s'\"`<>()\\\\]+")
+
+// Scan checks every source file of the tool. The icon is left out since it
+// is sanitized on its own.
+func (p *Policy) Scan(tool TldrawToolOutput) PolicyVerdict {
+	verdict := PolicyVerdict{Findings: []PolicyFinding{}}
+
+	for _, file := range tool.AllFiles() {
+		if file.Kind == FileKindIcon {
+			continue
+		}
+
+		for _, rule := range p.rules {
+			for _, m := range rule.re.FindAllStringIndex(file.Content, -1) {
+				verdict.add(PolicyFinding{
+					Rule:    rule.Id,
+					Action:  rule.Action,
+					Message: rule.Message,
+					File:    file.Name,
+					Line:    lineAt(file.Content, m[0]),
+					Match:   file.Content[m[0]:m[1]],
+				})
+			}
+		}
+
+		for _, m := range urlPattern.FindAllStringIndex(file.Content, -1) {
+			raw := file.Content[m[0]:m[1]]
+			if p.allowsURL(raw) {
+				continue
+			}
+
+			verdict.add(PolicyFinding{
+				Rule:    urlRule,
+				Action:  p.urlAction,
+				Message: "the URL's host is not allow-listed",
+				File:    file.Name,
+				Line:    lineAt(file.Content, m[0]),
+				Match:   raw,
+			})
+		}
+	}
+
+	return verdict
+}
+
+func (v *PolicyVerdict) add(finding PolicyFinding) {
+	v.Findings = append(v.Findings, finding)
+	if finding.Action == PolicyBlock {
+		v.Blocked = true
+	}
+}
+
+func (p *Policy) allowsURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+
+	for _, allowed := range p.allowedHosts {
+		if suffix, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+func lineAt(content string, offset int) int {
+	return strings.Count(content[:offset], "\n") + 1
+}
@@ -0,0 +1,166 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPolicyScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		rules   []string
+		blocked bool
+	}{
+		{"Clean", "const x = 1", nil, false},
+		{"Eval", "eval('1 + 1')", []string{"eval"}, true},
+		{"Function constructor", "const f = new Function('return 1')", []string{"function-constructor"}, true},
+		{"String timer", "setTimeout(\"alert(1)\", 10)", []string{"string-timer"}, true},
+		{"Callback timer", "setTimeout(() => {}, 10)", nil, false},
+		{"Cookie", "const c = document.cookie", []string{"document-cookie"}, true},
+		{"Inner HTML prop", "<div dangerouslySetInnerHTML={{ __html: html }} />", []string{"dangerously-set-inner-html"}, true},
+		{"Inner HTML assignment", "el.innerHTML = html", []string{"inner-html"}, true},
+		{"Inner HTML comparison", "if (el.innerHTML == '') {}", nil, false},
+		{"Script element", "document.createElement('script')", []string{"script-element"}, true},
+		{"Dynamic fetch", "fetch(endpoint)", []string{"dynamic-fetch"}, false},
+		{"Relative fetch", "fetch('/api/data')", nil, false},
+		{"Unknown host", "fetch('https://evil.example.com/steal')", []string{urlRule}, true},
+		{"Allowed host", "const ns = 'http://www.w3.org/2000/svg'", nil, false},
+		{"Storage", "localStorage.setItem('k', 'v')", []string{"web-storage"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verdict := DefaultPolicy().Scan(TldrawToolOutput{Id: "counter", Util: test.source})
+
+			rules := []string{}
+			for _, finding := range verdict.Findings {
+				rules = append(rules, finding.Rule)
+			}
+			if strings.Join(rules, ",") != strings.Join(test.rules, ",") {
+				t.Errorf("Expected findings %q\nbut got %q", test.rules, rules)
+			}
+			if verdict.Blocked != test.blocked {
+				t.Errorf("Expected blocked %v but got %v", test.blocked, verdict.Blocked)
+			}
+		})
+	}
+}
+
+func TestPolicyConfig(t *testing.T) {
+	policy, err := ParsePolicy([]byte(`{
+		"rules": [{"id": "alert", "action": "flag", "message": "no alerts", "pattern": "\\balert\\("}],
+		"allowedHosts": ["*.example.com"],
+		"urlAction": "flag"
+	}`))
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+
+	verdict := policy.Scan(TldrawToolOutput{
+		Tool: "fetch('https://api.example.com/x')\nfetch('https://example.com/x')",
+		Util: "alert('hi')\neval('1')",
+	})
+	if verdict.Blocked {
+		t.Error("Expected flagged findings not to block")
+	}
+	if len(verdict.Findings) != 2 {
+		t.Fatalf("Expected 2 findings but got %+v", verdict.Findings)
+	}
+	if f := verdict.Findings[0]; f.Rule != urlRule || f.File != "tool.ts" || f.Line != 2 {
+		t.Errorf("Expected the bare example.com URL on line 2 but got %+v", f)
+	}
+
+	invalid := []string{
+		`{"rules": [{"id": "x", "action": "deny", "pattern": "x"}]}`,
+		`{"rules": [{"id": "x", "pattern": "("}]}`,
+		`{"rules": [{"id": "x", "pattern": "x"}, {"id": "x", "pattern": "y"}]}`,
+		`{"urlAction": "ignore"}`,
+	}
+	for _, config := range invalid {
+		if _, err := ParsePolicy([]byte(config)); err == nil {
+			t.Errorf("Expected an error for %s", config)
+		}
+	}
+}
+
+func TestGenTldrawToolPolicy(t *testing.T) {
+	blocked := strings.Replace(fakeToolOutput, "count: 0", "count: eval('0')", 1)
+	if blocked == fakeToolOutput {
+		t.Fatal("Expected the fake output to have a count prop")
+	}
+
+	t.Run("Blocks and audits", func(t *testing.T) {
+		generator := newTestGenerator(t, NewFakeProvider(blocked))
+
+		out, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{})
+		if !errors.Is(err, ErrPolicyBlocked) {
+			t.Fatalf("Expected ErrPolicyBlocked but got %v", err)
+		}
+		if out.Policy == nil || !out.Policy.Blocked || out.Policy.Findings[0].Rule != "eval" {
+			t.Errorf("Expected an eval finding in the verdict but got %+v", out.Policy)
+		}
+
+		if _, err := os.Stat(newToolPaths(generator.Workspace, "counter").Folder); !os.IsNotExist(err) {
+			t.Error("Expected the blocked tool not to be written")
+		}
+
+		entries, err := generator.Audit.Entries()
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		if len(entries) != 1 || entries[0].Action != "generate" || entries[0].Written || entries[0].Query != "a counter button" {
+			t.Errorf("Expected one blocked generate entry but got %+v", entries)
+		}
+	})
+
+	t.Run("Audits clean tools", func(t *testing.T) {
+		generator := newTestGenerator(t, NewFakeProvider(fakeToolOutput))
+
+		out, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{})
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		if out.Policy == nil || out.Policy.Blocked || len(out.Policy.Findings) != 0 {
+			t.Errorf("Expected a clean verdict but got %+v", out.Policy)
+		}
+
+		entries, err := generator.Audit.Entries()
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		if len(entries) != 1 || !entries[0].Written {
+			t.Errorf("Expected one written entry but got %+v", entries)
+		}
+	})
+
+	t.Run("Blocks refinements", func(t *testing.T) {
+		tool, err := parseTldrawToolXML(fakeToolOutput)
+		if err != nil {
+			t.Fatal(err)
+		}
+		refined := "<tool id=\"counter\">\n<file name=\"util.tsx\">" +
+			strings.Replace(tool.Util, "count: 0", "count: eval('0')", 1) + "</file>\n</tool>"
+
+		generator := newTestGenerator(t, NewFakeProvider(fakeToolOutput, refined))
+		if _, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{}); err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		_, err = generator.RefineTldrawTool(context.Background(), "counter", "start at zero")
+		if !errors.Is(err, ErrPolicyBlocked) {
+			t.Fatalf("Expected ErrPolicyBlocked but got %v", err)
+		}
+
+		written, err := os.ReadFile(newToolPaths(generator.Workspace, "counter").Util)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(written) != tool.Util {
+			t.Error("Expected the blocked refinement to be rolled back")
+		}
+	})
+}
@@ -1,17 +1,38 @@
 package ai
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// PromptVersion identifies the system prompt a tool was generated with. It is
+// derived from the prompt so it changes whenever the prompt does.
+var PromptVersion = func() string {
+	sum := sha256.Sum256([]byte(SystemPromptGenTldrawTool))
+	return hex.EncodeToString(sum[:6])
+}()
+
 const SystemPromptGenTldrawTool = `
 You are an expert at generating tldraw tools.
 You will recieve an query describing a tool from the user.
 
-Then you will generate the id for the tool and 2 code files for the tldraw tool:
+Then you will generate the id for the tool and these files for the tldraw tool:
 - tool.ts
+- util.tsx
 - icon.svg
 
+You may also add extra files next to them, like props, migrations, types, css styles or
+helpers (for example "card-shape-props.ts" or "styles.css").
+
 Rules to follow:
 - The icon svg should ALWAYS be outlined and have a transparent fill
 - The output should always be in the format given in the example below and no extra text
+- The "name" and "description" attributes of the tool tag are optional
+- The tool id must be lowercase kebab-case (a-z, 0-9 and "-"), at most 48 characters, and not the id of a built-in tldraw tool like "select", "draw", "text" or "note"
+- The tool id, the static id and shapeType in "tool.ts" and the static type in "util.tsx" MUST all be the same
 - The package is "tldraw" NOT "@tldraw/tldraw"
+- Extra file names must be lowercase kebab-case and end in .ts, .tsx or .css, with no folders
+- Every relative import like './card-shape-props' MUST point to a file you output
 - Use react to render the tool, NOT tldraw shapes
 - Use default exports NOT named exports
 - Set "pointerEvents" style value to "all" for the tool util in HTMLContainer
@@ -22,10 +43,11 @@ Rules to follow:
 
 Here is an example output
 
-<tool id="sticker">
+<tool id="card" name="Card" description="A card that counts clicks">
 <file name="tool.ts">
-import { BaseBoxShapeTool, TLClickEvent } from 'tldraw'
-export class CardShapeTool extends BaseBoxShapeTool {
+import { BaseBoxShapeTool } from 'tldraw'
+
+export default class CardShapeTool extends BaseBoxShapeTool {
 	static override id = 'card'
 	static override initial = 'idle'
 	override shapeType = 'card'
@@ -35,29 +57,20 @@ export class CardShapeTool extends BaseBoxShapeTool {
 This file contains our custom tool. The tool is a StateNode with the id "card".
 
 We get a lot of functionality for free by extending the BaseBoxShapeTool. but we can
-handle events in out own way by overriding methods like onDoubleClick. For an example 
-of a tool with more custom functionality, check out the screenshot-tool example. 
-
+handle events in out own way by overriding methods like onDoubleClick. Interactivity
+like click events belongs in the util, not here.
 */
 </file>
 
 <file name="util.tsx">
-import { useState } from 'react'
-import {
-	HTMLContainer,
-	Rectangle2d,
-	ShapeUtil,
-	TLOnResizeHandler,
-	getDefaultColorTheme,
-	resizeBox,
-} from 'tldraw'
+import { HTMLContainer, Rectangle2d, ShapeUtil, TLOnResizeHandler, resizeBox } from 'tldraw'
 import { cardShapeMigrations } from './card-shape-migrations'
 import { cardShapeProps } from './card-shape-props'
 import { ICardShape } from './card-shape-types'
 
 // There's a guide at the bottom of this file!
 
-export class CardShapeUtil extends ShapeUtil<ICardShape> {
+export default class CardShapeUtil extends ShapeUtil<ICardShape> {
 	static override type = 'card' as const
 	// [1]
 	static override props = cardShapeProps
@@ -73,7 +86,7 @@ export class CardShapeUtil extends ShapeUtil<ICardShape> {
 		return {
 			w: 300,
 			h: 300,
-			color: 'black',
+			count: 0,
 		}
 	}
 
@@ -89,30 +102,24 @@ export class CardShapeUtil extends ShapeUtil<ICardShape> {
 	// [6]
 	component(shape: ICardShape) {
 		const bounds = this.editor.getShapeGeometry(shape).bounds
-		const theme = getDefaultColorTheme({ isDarkMode: this.editor.user.getIsDarkMode() })
-
-		//[a]
-		// eslint-disable-next-line react-hooks/rules-of-hooks
-		const [count, setCount] = useState(0)
 
 		return (
 			<HTMLContainer
 				id={shape.id}
-				style={{
-					border: '1px solid black',
-					display: 'flex',
-					flexDirection: 'column',
-					alignItems: 'center',
-					justifyContent: 'center',
-					pointerEvents: 'all',
-					backgroundColor: theme[shape.props.color].semi,
-					color: theme[shape.props.color].solid,
-				}}
+				className="flex flex-col items-center justify-center border border-black bg-white text-black"
+				style={{ pointerEvents: 'all' }}
 			>
-				<h2>Clicks: {count}</h2>
+				<h2 className="text-lg font-bold">Clicks: {shape.props.count}</h2>
 				<button
-					// [b]
-					onClick={() => setCount((count) => count + 1)}
+					className="rounded border border-black px-2"
+					// [a]
+					onClick={() =>
+						this.editor.updateShape<ICardShape>({
+							id: shape.id,
+							type: 'card',
+							props: { count: shape.props.count + 1 },
+						})
+					}
 					onPointerDown={(e) => e.stopPropagation()}
 				>
 					{bounds.w.toFixed()}x{bounds.h.toFixed()}
@@ -159,11 +166,9 @@ Render method — the React component that will be rendered for the shape. It ta
 shape as an argument. HTMLContainer is just a div that's being used to wrap our text 
 and button. We can get the shape's bounds using our own getGeometry method.
 	
-- [a] Check it out! We can do normal React stuff here like using setState.
-   Annoying: eslint sometimes thinks this is a class component, but it's not.
-
-- [b] You need to stop the pointer down event on buttons, otherwise the editor will
-	   think you're trying to select drag the shape.
+- [a] Shape data is updated with this.editor.updateShape. You need to stop the pointer
+	   down event on buttons, otherwise the editor will think you're trying to select
+	   drag the shape.
 
 [7]
 Indicator — used when hovering over a shape or when it's selected; must return only SVG elements here
@@ -174,8 +179,108 @@ custom logic here, but for our purposes, this is fine.
 */
 </file>
 
+<file name="card-shape-types.ts">
+import { TLBaseShape } from 'tldraw'
+
+export type ICardShape = TLBaseShape<
+	'card',
+	{
+		w: number
+		h: number
+		count: number
+	}
+>
+</file>
+
+<file name="card-shape-props.ts">
+import { RecordProps, T } from 'tldraw'
+import { ICardShape } from './card-shape-types'
+
+// Validation for our custom card shape's props
+export const cardShapeProps: RecordProps<ICardShape> = {
+	w: T.number,
+	h: T.number,
+	count: T.number,
+}
+</file>
+
+<file name="card-shape-migrations.ts">
+import { createShapePropsMigrationSequence } from 'tldraw'
+
+// Migrations for the card shape, none yet
+export const cardShapeMigrations = createShapePropsMigrationSequence({
+	sequence: [],
+})
+</file>
+
 <file name="icon.svg">
-...
+<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round">
+	<rect x="3" y="5" width="18" height="14" rx="2" />
+	<path d="M12 9v6M9 12h6" />
+</svg>
 </file>
 </tool>
 `
+
+// PromptRefineTldrawTool is sent as a follow-up user message when refining an
+// existing tool. Arguments: tool id, the current <file> tags, instruction.
+const PromptRefineTldrawTool = `
+Here are the current files of the tool with id "%[1]s":
+
+<tool id="%[1]s">
+%[2]s
+</tool>
+
+Change the tool as follows:
+%[3]s
+
+Rules for your answer:
+- Keep the tool id "%[1]s"
+- Only output the files that need to change, in the same <tool> and <file> format
+- Always output the complete content of every file you change
+`
+
+// PromptRepairTldrawTool asks the model to fix an unusable answer.
+// Arguments: description of the problems, tool id, list of files to output.
+const PromptRepairTldrawTool = `
+Your previous answer could not be used because %[1]s.
+
+Output ONLY the following files for the tool, in the <tool id="%[2]s"> and <file name="..."> format from the example, with no extra text:
+%[3]s
+`
+
+// SystemPromptToolUseSuffix is appended to the system prompt in tool-use mode.
+const SystemPromptToolUseSuffix = `
+Instead of writing the <tool> output as text, call the "write_tldraw_tool" tool with the
+same id, name, description and files. The content of each file is exactly what would go
+between its <file> tags.
+`
+
+// PromptRepairToolUse is the tool-use counterpart of PromptRepairTldrawTool.
+// Arguments: description of the problems, tool id, list of files to output.
+const PromptRepairToolUse = `
+Your previous answer could not be used because %[1]s.
+
+Call the "write_tldraw_tool" tool again with the id "%[2]s" and ONLY the following files:
+%[3]s
+`
+
+// PromptContinue asks a provider that cannot resume a prefilled answer to
+// continue one that hit the token limit. Arguments: end of the answer so far.
+const PromptContinue = `
+Your previous answer was cut off because it was too long. It ends with:
+
+%[1]s
+
+Continue exactly from where it stopped, starting with the very next character. Do not repeat anything you already wrote and do not add any commentary.
+`
+
+// PromptFixTypeErrors sends compiler errors back to the model.
+// Arguments: tool id, list of errors.
+const PromptFixTypeErrors = `
+The TypeScript compiler reports these errors in the tool "%[1]s":
+
+%[2]s
+
+Fix them and output ONLY the files you change, complete and in the same format as before, keeping the tool id "%[1]s".
+`
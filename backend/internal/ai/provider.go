@@ -0,0 +1,125 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+)
+
+type ChatMessage struct {
+	Role    Role   `json:"role"`
+	Content string `json:"content"`
+}
+
+type StopReason string
+
+const (
+	StopReasonEndTurn   StopReason = "end_turn"
+	StopReasonMaxTokens StopReason = "max_tokens"
+	StopReasonToolUse   StopReason = "tool_use"
+	StopReasonOther     StopReason = "other"
+)
+
+type Usage struct {
+	InputTokens  int `json:"inputTokens"`
+	OutputTokens int `json:"outputTokens"`
+}
+
+// ToolSpec describes a function the model can call, with its input given as
+// a JSON schema.
+type ToolSpec struct {
+	Name        string
+	Description string
+	InputSchema json.RawMessage
+}
+
+type ToolCall struct {
+	Name  string
+	Input json.RawMessage
+}
+
+type CompletionRequest struct {
+	System    string
+	Messages  []ChatMessage
+	MaxTokens int
+
+	// Tools are offered to the model. When ToolChoice names one of them the
+	// model is forced to call it. Responses using tools are never streamed.
+	Tools      []ToolSpec
+	ToolChoice string
+
+	// OnDelta, when set, asks the provider to stream the response and is
+	// called with each chunk of text as it arrives.
+	OnDelta func(text string)
+}
+
+type CompletionResponse struct {
+	Text       string
+	ToolCalls  []ToolCall
+	Usage      Usage
+	StopReason StopReason
+}
+
+// Provider is an LLM backend that can complete a conversation given a system prompt.
+type Provider interface {
+	Complete(ctx context.Context, req CompletionRequest) (CompletionResponse, error)
+}
+
+// ModelNamer is implemented by providers that can tell which model they use.
+type ModelNamer interface {
+	ModelName() string
+}
+
+// Prefiller is implemented by providers whose model continues a conversation
+// ending in an assistant message instead of starting a new reply.
+type Prefiller interface {
+	Prefill() bool
+}
+
+// NewProviderFromEnv picks a provider based on the LLM_PROVIDER env var.
+// Defaults to Anthropic when unset.
+func NewProviderFromEnv() (Provider, error) {
+	model := os.Getenv("LLM_MODEL")
+
+	switch name := strings.ToLower(os.Getenv("LLM_PROVIDER")); name {
+	case "", "anthropic":
+		api_key := os.Getenv("ANTHROPIC_API_KEY")
+		if api_key == "" {
+			return nil, fmt.Errorf("anthropic API Key env var not found")
+		}
+		return NewAnthropicProvider(api_key, model), nil
+
+	case "openai":
+		base_url := os.Getenv("OPENAI_BASE_URL")
+		if base_url == "" {
+			return nil, fmt.Errorf("OPENAI_BASE_URL env var not found")
+		}
+		provider := NewOpenAIProvider(base_url, os.Getenv("OPENAI_API_KEY"), model)
+		provider.Stream, _ = strconv.ParseBool(os.Getenv("OPENAI_STREAM"))
+		return provider, nil
+
+	case "fake":
+		output := fakeToolOutput
+		if path := os.Getenv("FAKE_PROVIDER_OUTPUT"); path != "" {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read fake provider output: %v", err)
+			}
+			output = string(content)
+		}
+		return NewFakeProvider(output), nil
+
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", name)
+	}
+}
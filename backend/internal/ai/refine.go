@@ -0,0 +1,265 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"tlcrazy-backend/internal/codemod"
+	"tlcrazy-backend/internal/config"
+	"tlcrazy-backend/internal/icon"
+	"tlcrazy-backend/internal/validator"
+)
+
+var (
+	ErrToolNotFound   = errors.New("tool not found")
+	ErrInvalidToolId  = errors.New("invalid tool id")
+	ErrInvalidOptions = errors.New("invalid generate options")
+
+	// ErrWriteFailed wraps the errors of writing a tool into its workspace,
+	// after which the workspace is left as it was.
+	ErrWriteFailed = errors.New("cannot write tool")
+	ErrNoWorkspace = errors.New("no workspace configured")
+)
+
+type RefineOutput struct {
+	TldrawToolOutput
+	Changed     []string               `json:"changed"`
+	Attempts    []GenerationAttempt    `json:"attempts"`
+	TypeCheck   *TypeCheckResult       `json:"typeCheck,omitempty"`
+	Codemods    []codemod.Change       `json:"codemods"`
+	Diagnostics []validator.Diagnostic `json:"diagnostics"`
+	Policy      *PolicyVerdict         `json:"policy,omitempty"`
+}
+
+// RefineTldrawTool applies a follow-up instruction to an already installed
+// tool. The model sees the prior conversation plus the tool's current files,
+// and its answer goes through the same repairs, codemods and type check as a
+// generated tool. The tool is reinstalled when any of its files changed.
+func (g *Generator) RefineTldrawTool(ctx context.Context, toolId, query string) (RefineOutput, error) {
+	current, err := g.store().Tool(ctx, toolId)
+	if err != nil {
+		return RefineOutput{}, err
+	}
+
+	session := Session{ToolId: toolId}
+	if g.Sessions != nil {
+		session, err = g.Sessions.Load(toolId)
+		if err != nil {
+			return RefineOutput{}, err
+		}
+	}
+
+	messages := append(session.Messages, ChatMessage{
+		Role:    RoleUser,
+		Content: fmt.Sprintf(PromptRefineTldrawTool, toolId, renderToolFiles(current), query),
+	})
+
+	genCtx, cancel := withStageTimeout(ctx, g.Timeouts.Generate)
+	defer cancel()
+
+	resp, err := g.complete(genCtx, g.newRequest(ModeXML, messages))
+	if err != nil {
+		return RefineOutput{}, err
+	}
+
+	log.Println("API Resp", resp.Text)
+
+	refined, messages, err := g.refineUntilValid(genCtx, current, messages, resp)
+	if err != nil {
+		return RefineOutput{}, err
+	}
+
+	g.applyCodemods(&refined, GenerateOptions{})
+	messages, err = g.typeCheckUntilClean(genCtx, ModeXML, &refined, messages, GenerateOptions{})
+	if err != nil {
+		return RefineOutput{}, err
+	}
+
+	out := RefineOutput{
+		TldrawToolOutput: refined.TldrawToolOutput,
+		Changed:          changedToolFiles(current, refined.TldrawToolOutput),
+		Attempts:         refined.Attempts,
+		TypeCheck:        refined.TypeCheck,
+		Codemods:         refined.Codemods,
+	}
+
+	out.Diagnostics = g.checkTool(out.TldrawToolOutput)
+
+	out.Policy = g.scanPolicy("refine", query, out.TldrawToolOutput)
+	if out.Policy != nil && out.Policy.Blocked {
+		out.Changed = []string{}
+		return out, fmt.Errorf("%w: %s", ErrPolicyBlocked, toolId)
+	}
+
+	if len(out.Changed) > 0 {
+		origin := g.origin(query)
+
+		manifest, err := g.store().Manifest(ctx)
+		if err != nil {
+			return RefineOutput{}, err
+		}
+		entry, ok := manifest.Get(toolId)
+		if !ok {
+			entry = newToolEntry(out.TldrawToolOutput, origin)
+		}
+		entry.Model = origin.Model
+
+		writeCtx, cancel := withStageTimeout(ctx, g.Timeouts.Write)
+		defer cancel()
+
+		if _, err := g.store().Install(writeCtx, out.TldrawToolOutput, entry); err != nil {
+			return RefineOutput{}, fmt.Errorf("%w %s: %w", ErrWriteFailed, toolId, err)
+		}
+
+		g.recordVersion("refine", out.TldrawToolOutput, origin, 0)
+	}
+
+	session.Messages = messages
+	g.saveSession(session)
+
+	return out, nil
+}
+
+// refineUntilValid merges the files of resp into current and, while the
+// answer cannot be parsed or imports files the tool does not have, asks the
+// model to fix it, up to g.MaxRepairs times. The id of the tool never
+// changes. An icon that cannot be sanitized keeps the current one.
+func (g *Generator) refineUntilValid(ctx context.Context, current TldrawToolOutput, messages []ChatMessage, resp CompletionResponse) (GenerateOutput, []ChatMessage, error) {
+	out := GenerateOutput{TldrawToolOutput: cloneTool(current), Attempts: []GenerationAttempt{}}
+
+	for attempt := 0; ; attempt++ {
+		messages = append(messages, ChatMessage{Role: RoleAssistant, Content: nonEmpty(resp.Text)})
+
+		if err := ctx.Err(); err != nil {
+			return out, messages, err
+		}
+
+		// Files completed before a parse error are kept
+		parsed, parseErr := customXMLParser(resp.Text)
+		for _, file := range parsed.Files {
+			if file.Name == "icon.svg" {
+				result, err := icon.Sanitize(file.Content)
+				if err != nil {
+					log.Printf("Keeping the current icon of %s: %s", current.Id, err)
+					continue
+				}
+				file.Content = result.SVG
+			}
+
+			if !out.setFile(file.Name, file.Content) {
+				log.Printf("Ignoring file %q of tool %s", file.Name, current.Id)
+			}
+		}
+
+		// Tools written before icons were checked may have none
+		if out.Icon == "" {
+			out.Icon = icon.Fallback(current.Id, out.Name)
+			out.FallbackIcon = true
+		}
+
+		missing := missingToolFiles(out.TldrawToolOutput)
+		record := GenerationAttempt{Attempt: attempt, MissingFiles: missing, Usage: resp.Usage}
+		if parseErr != nil {
+			record.Error = parseErr.Error()
+		}
+		out.Attempts = append(out.Attempts, record)
+
+		if parseErr == nil && len(missing) == 0 {
+			return out, messages, nil
+		}
+
+		if attempt >= g.MaxRepairs {
+			problem := record.Error
+			if problem == "" {
+				problem = "missing " + strings.Join(missing, ", ")
+			}
+			return out, messages, fmt.Errorf("refined tool output still invalid after %d repair attempts: %s", attempt, problem)
+		}
+
+		log.Printf("Repairing refined output of %s (attempt %d): error=%q missing=%q", current.Id, attempt+1, record.Error, missing)
+
+		messages = append(messages, ChatMessage{
+			Role:    RoleUser,
+			Content: repairPrompt(ModeXML, current.Id, parseErr, nil, nil, missing),
+		})
+
+		var err error
+		resp, err = g.complete(ctx, g.newRequest(ModeXML, messages))
+		if err != nil {
+			return out, messages, err
+		}
+
+		log.Println("API Resp", resp.Text)
+	}
+}
+
+// changedToolFiles lists the files of refined that differ from current, in
+// the order of refined.
+func changedToolFiles(current, refined TldrawToolOutput) []string {
+	changed := []string{}
+	for _, file := range refined.AllFiles() {
+		if existing, ok := current.file(file.Name); !ok || existing != file.Content {
+			changed = append(changed, file.Name)
+		}
+	}
+
+	return changed
+}
+
+func readToolFiles(workspace config.Workspace, toolId string) (TldrawToolOutput, error) {
+	paths, err := resolveToolPaths(workspace, toolId)
+	if err != nil {
+		return TldrawToolOutput{}, err
+	}
+
+	if _, err := os.Stat(paths.Folder); errors.Is(err, os.ErrNotExist) {
+		return TldrawToolOutput{}, ErrToolNotFound
+	}
+
+	tool := TldrawToolOutput{Id: toolId}
+	for path, content := range map[string]*string{
+		paths.Tool: &tool.Tool,
+		paths.Util: &tool.Util,
+		paths.Icon: &tool.Icon,
+	} {
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return TldrawToolOutput{}, err
+		}
+		*content = string(data)
+	}
+
+	entries, err := os.ReadDir(paths.Folder)
+	if err != nil {
+		return TldrawToolOutput{}, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || slices.Contains(coreToolFiles, entry.Name()) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(paths.Folder, entry.Name()))
+		if err != nil {
+			return TldrawToolOutput{}, err
+		}
+		tool.addExtraFile(entry.Name(), string(data))
+	}
+
+	return tool, nil
+}
+
+func (g *Generator) saveSession(session Session) {
+	if g.Sessions == nil {
+		return
+	}
+
+	if err := g.Sessions.Save(session); err != nil {
+		log.Printf("Error saving session for %s: %s", session.ToolId, err)
+	}
+}
@@ -0,0 +1,163 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRefineTldrawTool(t *testing.T) {
+	original, err := parseTldrawToolXML(fakeToolOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refinedUtil := strings.Replace(original.Util, "border-black", "border-red-500", 1)
+	refineOutput := "<tool id=\"counter\">\n<file name=\"tool.ts\">" + original.Tool + "</file>\n<file name=\"util.tsx\">" + refinedUtil + "</file>\n</tool>"
+
+	provider := NewFakeProvider(fakeToolOutput, refineOutput)
+	generator := newTestGenerator(t, provider)
+
+	if _, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := generator.RefineTldrawTool(context.Background(), "counter", "make the border red")
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+
+	if !reflect.DeepEqual(out.Changed, []string{"util.tsx"}) {
+		t.Errorf("Expected only util.tsx to change but got %q", out.Changed)
+	}
+	if out.Util != refinedUtil || out.Tool != original.Tool || out.Icon != original.Icon {
+		t.Error("Expected refined output to merge changed files with the current ones")
+	}
+
+	written, err := os.ReadFile(newToolPaths(generator.Workspace, "counter").Util)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != refinedUtil {
+		t.Error("Expected util.tsx to be rewritten")
+	}
+
+	requests := provider.Requests()
+	refineReq := requests[1]
+	if len(refineReq.Messages) != 3 {
+		t.Fatalf("Expected prior conversation plus the refine message but got %d messages", len(refineReq.Messages))
+	}
+	if !strings.Contains(refineReq.Messages[2].Content, "make the border red") {
+		t.Error("Expected the instruction in the refine message")
+	}
+
+	t.Run("Session survives a restart", func(t *testing.T) {
+		session, err := NewSessionStore(generator.Sessions.Dir).Load("counter")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(session.Messages) != 4 {
+			t.Errorf("Expected 4 messages in the session but got %d", len(session.Messages))
+		}
+	})
+
+	t.Run("Unknown and unsafe tool ids", func(t *testing.T) {
+		if _, err := generator.RefineTldrawTool(context.Background(), "missing", "x"); err != ErrToolNotFound {
+			t.Errorf("Expected ErrToolNotFound but got %v", err)
+		}
+		if _, err := generator.RefineTldrawTool(context.Background(), "..", "x"); !errors.Is(err, ErrInvalidToolId) {
+			t.Errorf("Expected ErrInvalidToolId but got %v", err)
+		}
+	})
+}
+
+func TestRefineRepairsAndFixes(t *testing.T) {
+	original, err := parseTldrawToolXML(fakeToolOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	malformed := "<tool id=\"counter\">\n<file name=\"util.tsx\">" + original.Util
+	oldImport := strings.Replace(original.Util, "from 'tldraw'", "from '@tldraw/tldraw'", 1)
+	repaired := "<tool id=\"counter\">\n<file name=\"util.tsx\">" + oldImport + "</file>\n</tool>"
+
+	provider := NewFakeProvider(fakeToolOutput, malformed, repaired)
+	generator := newTestGenerator(t, provider)
+
+	if _, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := generator.RefineTldrawTool(context.Background(), "counter", "change nothing")
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+
+	if len(out.Attempts) != 2 || out.Attempts[0].Error == "" {
+		t.Errorf("Expected a failed attempt followed by a repair but got %+v", out.Attempts)
+	}
+	if !strings.Contains(provider.Requests()[2].Messages[len(provider.Requests()[2].Messages)-1].Content, "could not be parsed") {
+		t.Error("Expected the repair to report the parse error")
+	}
+	if len(out.Codemods) == 0 || out.Util != original.Util {
+		t.Errorf("Expected the codemods to fix the import but got %+v", out.Codemods)
+	}
+	if len(out.Changed) != 0 {
+		t.Errorf("Expected no changes once the import was fixed but got %q", out.Changed)
+	}
+
+	t.Run("Gives up after the repair budget", func(t *testing.T) {
+		generator := newTestGenerator(t, NewFakeProvider(fakeToolOutput, malformed))
+		if _, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := generator.RefineTldrawTool(context.Background(), "counter", "x"); err == nil || !strings.Contains(err.Error(), "still invalid") {
+			t.Errorf("Expected the refine to fail after the repairs but got %v", err)
+		}
+
+		util, err := os.ReadFile(newToolPaths(generator.Workspace, "counter").Util)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(util) != original.Util {
+			t.Error("Expected the installed tool to be left alone")
+		}
+	})
+}
+
+func TestSessionTrimming(t *testing.T) {
+	store := NewSessionStore(t.TempDir())
+	store.MaxMessages = 4
+
+	messages := []ChatMessage{{Role: RoleUser, Content: "a counter button"}}
+	for i := range 5 {
+		messages = append(messages,
+			ChatMessage{Role: RoleAssistant, Content: "answer " + strconv.Itoa(i)},
+			ChatMessage{Role: RoleUser, Content: "refine " + strconv.Itoa(i)},
+		)
+	}
+
+	if err := store.Save(Session{ToolId: "counter", Messages: messages}); err != nil {
+		t.Fatal(err)
+	}
+	session, err := store.Load("counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ChatMessage{
+		{Role: RoleUser, Content: "a counter button"},
+		{Role: RoleAssistant, Content: "answer 3"},
+		{Role: RoleUser, Content: "refine 3"},
+		{Role: RoleAssistant, Content: "answer 4"},
+		{Role: RoleUser, Content: "refine 4"},
+	}
+	if !reflect.DeepEqual(session.Messages, want) {
+		t.Errorf("Expected %+v\nbut got %+v", want, session.Messages)
+	}
+}
@@ -0,0 +1,297 @@
+package ai
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+)
+
+// manifestVersion is the format of tools.json. The legacy {"ids": [...]}
+// format has no version field, so it reads as version 0 and is migrated.
+const manifestVersion = 1
+
+// ToolManifest is the content of tools.json.
+type ToolManifest struct {
+	Version int `json:"version"`
+
+	// Ids lists the enabled tools in toolbar order. It is derived from Tools
+	// and is all the frontend reads.
+	Ids   []string    `json:"ids"`
+	Tools []ToolEntry `json:"tools"`
+}
+
+// ToolEntry describes one installed tool. Version counts the installs and
+// refinements of the tool, starting at 1.
+type ToolEntry struct {
+	Id            string            `json:"id"`
+	Name          string            `json:"name,omitempty"`
+	Description   string            `json:"description,omitempty"`
+	Query         string            `json:"query,omitempty"`
+	Model         string            `json:"model,omitempty"`
+	PromptVersion string            `json:"promptVersion,omitempty"`
+	Hashes        map[string]string `json:"hashes,omitempty"`
+	Version       int               `json:"version"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	UpdatedAt     time.Time         `json:"updatedAt"`
+	Enabled       bool              `json:"enabled"`
+	Order         int               `json:"order"`
+}
+
+// ToolOrigin is what produced a tool, recorded in its manifest entry.
+type ToolOrigin struct {
+	Query         string
+	Model         string
+	PromptVersion string
+}
+
+// Get returns the entry for id.
+func (m *ToolManifest) Get(id string) (ToolEntry, bool) {
+	for _, entry := range m.Tools {
+		if entry.Id == id {
+			return entry, true
+		}
+	}
+
+	return ToolEntry{}, false
+}
+
+// put adds entry, or replaces the entry with the same id while keeping its
+// creation time, toolbar position and enabled flag.
+func (m *ToolManifest) put(entry ToolEntry, now time.Time) ToolEntry {
+	entry.UpdatedAt = now
+
+	for i, existing := range m.Tools {
+		if existing.Id != entry.Id {
+			continue
+		}
+
+		entry.Version = existing.Version + 1
+		entry.CreatedAt = existing.CreatedAt
+		entry.Enabled = existing.Enabled
+		entry.Order = existing.Order
+		m.Tools[i] = entry
+		return entry
+	}
+
+	entry.Version = 1
+	entry.CreatedAt = now
+	entry.Enabled = true
+	entry.Order = 0
+	for _, existing := range m.Tools {
+		entry.Order = max(entry.Order, existing.Order+1)
+	}
+	m.Tools = append(m.Tools, entry)
+
+	return entry
+}
+
+// remove drops the entry for id and reports whether there was one.
+func (m *ToolManifest) remove(id string) bool {
+	for i, entry := range m.Tools {
+		if entry.Id == id {
+			m.Tools = append(m.Tools[:i], m.Tools[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// move puts the tool at position in the toolbar, counting from 0, and
+// renumbers the order of every tool.
+func (m *ToolManifest) move(id string, position int) {
+	m.normalize()
+
+	entry, ok := m.Get(id)
+	if !ok {
+		return
+	}
+	m.remove(id)
+
+	position = min(max(position, 0), len(m.Tools))
+	m.Tools = slices.Insert(m.Tools, position, entry)
+	for i := range m.Tools {
+		m.Tools[i].Order = i
+	}
+}
+
+// normalize drops duplicate entries, keeping the first, sorts the tools by
+// toolbar order and derives Ids.
+func (m *ToolManifest) normalize() {
+	m.Version = manifestVersion
+
+	seen := map[string]bool{}
+	tools := make([]ToolEntry, 0, len(m.Tools))
+	for _, entry := range m.Tools {
+		if entry.Id == "" || seen[entry.Id] {
+			continue
+		}
+		seen[entry.Id] = true
+		tools = append(tools, entry)
+	}
+
+	sort.SliceStable(tools, func(i, j int) bool {
+		return tools[i].Order < tools[j].Order
+	})
+	m.Tools = tools
+
+	m.Ids = []string{}
+	for _, entry := range m.Tools {
+		if entry.Enabled {
+			m.Ids = append(m.Ids, entry.Id)
+		}
+	}
+}
+
+// decodeManifest parses tools.json, migrating the legacy format. now is used
+// as the timestamps of migrated entries.
+func decodeManifest(data []byte, now time.Time) (ToolManifest, error) {
+	var m ToolManifest
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, &m); err != nil {
+			return ToolManifest{}, err
+		}
+	}
+
+	switch {
+	case m.Version > manifestVersion:
+		return ToolManifest{}, fmt.Errorf("unsupported manifest version %d", m.Version)
+
+	case m.Version == 0:
+		m.Tools = nil
+		for i, id := range m.Ids {
+			m.Tools = append(m.Tools, ToolEntry{
+				Id:        id,
+				Version:   1,
+				CreatedAt: now,
+				UpdatedAt: now,
+				Enabled:   true,
+				Order:     i,
+			})
+		}
+	}
+
+	m.normalize()
+	return m, nil
+}
+
+func encodeManifest(m ToolManifest) ([]byte, error) {
+	m.normalize()
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(data, '\n'), nil
+}
+
+// hashToolFiles returns the sha256 of every file of the tool by file name.
+func hashToolFiles(tool TldrawToolOutput) map[string]string {
+	hashes := map[string]string{}
+	for _, file := range tool.AllFiles() {
+		sum := sha256.Sum256([]byte(file.Content))
+		hashes[file.Name] = "sha256:" + hex.EncodeToString(sum[:])
+	}
+
+	return hashes
+}
+
+func newToolEntry(tool TldrawToolOutput, origin ToolOrigin) ToolEntry {
+	return ToolEntry{
+		Id:            tool.Id,
+		Name:          tool.Name,
+		Description:   tool.Description,
+		Query:         origin.Query,
+		Model:         origin.Model,
+		PromptVersion: origin.PromptVersion,
+		Hashes:        hashToolFiles(tool),
+	}
+}
+
+// ToolRegistry owns tools.json at Path. Writers hold a lock on a file next
+// to it, so concurrent requests and processes never lose each other's tools.
+type ToolRegistry struct {
+	Path string
+}
+
+func NewToolRegistry(path string) *ToolRegistry {
+	return &ToolRegistry{Path: path}
+}
+
+// Load returns the manifest. A missing tools.json is an empty manifest.
+func (r *ToolRegistry) Load() (ToolManifest, error) {
+	unlock, err := r.lock()
+	if err != nil {
+		return ToolManifest{}, err
+	}
+	defer unlock()
+
+	return r.read()
+}
+
+// Update applies fn to the manifest and writes it back, all under the lock.
+// Nothing is written when fn fails.
+func (r *ToolRegistry) Update(fn func(m *ToolManifest) error) error {
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	m, err := r.read()
+	if err != nil {
+		return err
+	}
+	if err := fn(&m); err != nil {
+		return err
+	}
+
+	return r.write(m)
+}
+
+// write replaces tools.json with m. The caller holds the lock.
+func (r *ToolRegistry) write(m ToolManifest) error {
+	data, err := encodeManifest(m)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temp file first so the frontend never reads a partial file
+	tmpPath := r.Path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, r.Path)
+}
+
+func (r *ToolRegistry) read() (ToolManifest, error) {
+	data, err := os.ReadFile(r.Path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return ToolManifest{}, err
+	}
+
+	m, err := decodeManifest(data, time.Now().UTC())
+	if err != nil {
+		return ToolManifest{}, fmt.Errorf("invalid %s: %w", r.Path, err)
+	}
+
+	return m, nil
+}
+
+func (r *ToolRegistry) lock() (func(), error) {
+	if err := ensureDirectoryExists(filepath.Dir(r.Path)); err != nil {
+		return nil, err
+	}
+
+	return lockFile(r.Path + ".lock")
+}
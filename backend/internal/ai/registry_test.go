@@ -0,0 +1,147 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestToolRegistry(t *testing.T) {
+	newRegistry := func(t *testing.T, content string) *ToolRegistry {
+		path := filepath.Join(t.TempDir(), "tools.json")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return NewToolRegistry(path)
+	}
+
+	t.Run("Migrates the legacy format", func(t *testing.T) {
+		registry := newRegistry(t, `{"ids":["timer","counter","timer"]}`)
+
+		manifest, err := registry.Load()
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		if manifest.Version != manifestVersion {
+			t.Errorf("Expected version %d but got %d", manifestVersion, manifest.Version)
+		}
+		if want := []string{"timer", "counter"}; !reflect.DeepEqual(manifest.Ids, want) {
+			t.Errorf("Expected %q\nbut got %q", want, manifest.Ids)
+		}
+		if entry, _ := manifest.Get("counter"); !entry.Enabled || entry.Version != 1 {
+			t.Errorf("Expected an enabled entry but got %+v", entry)
+		}
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		manifest, err := NewToolRegistry(filepath.Join(t.TempDir(), "tools.json")).Load()
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		if len(manifest.Ids) != 0 || len(manifest.Tools) != 0 {
+			t.Errorf("Expected an empty manifest but got %+v", manifest)
+		}
+	})
+
+	t.Run("Unsupported version", func(t *testing.T) {
+		if _, err := newRegistry(t, `{"version":99}`).Load(); err == nil {
+			t.Error("Expected an error for a newer manifest")
+		}
+	})
+
+	t.Run("Put keeps position and flags", func(t *testing.T) {
+		registry := newRegistry(t, `{"ids":["a","b"]}`)
+
+		err := registry.Update(func(m *ToolManifest) error {
+			m.Tools[0].Enabled = false
+			m.put(ToolEntry{Id: "a", Query: "again"}, time.Now())
+			m.put(ToolEntry{Id: "c"}, time.Now())
+			return nil
+		})
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		manifest, err := registry.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"b", "c"}; !reflect.DeepEqual(manifest.Ids, want) {
+			t.Errorf("Expected %q\nbut got %q", want, manifest.Ids)
+		}
+		a, _ := manifest.Get("a")
+		if a.Version != 2 || a.Enabled || a.Order != 0 || a.Query != "again" {
+			t.Errorf("Expected a disabled second version of a but got %+v", a)
+		}
+		if c, _ := manifest.Get("c"); c.Order != 2 {
+			t.Errorf("Expected c to be last in the toolbar but got %+v", c)
+		}
+	})
+
+	t.Run("Concurrent writers", func(t *testing.T) {
+		registry := newRegistry(t, `{"ids":[]}`)
+
+		var wg sync.WaitGroup
+		for i := range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				// Separate registries, like separate processes
+				err := NewToolRegistry(registry.Path).Update(func(m *ToolManifest) error {
+					m.put(ToolEntry{Id: fmt.Sprintf("tool-%d", i)}, time.Now())
+					return nil
+				})
+				if err != nil {
+					t.Error("Got an error but didn't expect one", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		manifest, err := registry.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(manifest.Ids) != 20 {
+			t.Errorf("Expected 20 tools but got %q", manifest.Ids)
+		}
+	})
+}
+
+func TestRefineUpdatesRegistry(t *testing.T) {
+	tool, err := parseTldrawToolXML(fakeToolOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refined := "<tool id=\"counter\">\n<file name=\"util.tsx\">" + tool.Util + "// refined\n</file>\n</tool>"
+
+	generator := newTestGenerator(t, NewFakeProvider(fakeToolOutput, refined))
+	if _, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{}); err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+	if _, err := generator.RefineTldrawTool(context.Background(), "counter", "add a comment"); err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+
+	manifest, err := NewToolRegistry(newToolPaths(generator.Workspace, "counter").ToolsJSON).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, _ := manifest.Get("counter")
+	if entry.Version != 2 || entry.Query != "a counter button" {
+		t.Errorf("Expected a second version keeping the query but got %+v", entry)
+	}
+
+	refinedTool := tool
+	refinedTool.Util += "// refined\n"
+	if !reflect.DeepEqual(entry.Hashes, hashToolFiles(refinedTool)) {
+		t.Errorf("Expected the hashes of the refined files but got %v", entry.Hashes)
+	}
+}
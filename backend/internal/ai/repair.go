@@ -0,0 +1,270 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"tlcrazy-backend/internal/codemod"
+	"tlcrazy-backend/internal/icon"
+	"tlcrazy-backend/internal/validator"
+)
+
+const defaultMaxRepairs = 2
+
+// GenerationAttempt records one model response and what was wrong with it.
+// Attempt 0 is the initial generation, every later one is a repair.
+type GenerationAttempt struct {
+	Attempt      int      `json:"attempt"`
+	Error        string   `json:"error,omitempty"`
+	MissingFiles []string `json:"missingFiles,omitempty"`
+	Usage        Usage    `json:"usage"`
+}
+
+type GenerateOutput struct {
+	TldrawToolOutput
+	Attempts   []GenerationAttempt `json:"attempts"`
+	Candidates []CandidateResult   `json:"candidates,omitempty"`
+
+	// FallbackIcon is set when the model gave no usable icon and a generated
+	// one is used instead.
+	FallbackIcon bool `json:"fallbackIcon,omitempty"`
+
+	// TypeCheck is the result of compiling the tool, nil when disabled.
+	TypeCheck *TypeCheckResult `json:"typeCheck,omitempty"`
+
+	// Codemods are the automatic fixes applied to the model output.
+	Codemods []codemod.Change `json:"codemods"`
+	// Diagnostics are the validator findings for the final tool.
+	Diagnostics []validator.Diagnostic `json:"diagnostics"`
+	Policy      *PolicyVerdict         `json:"policy,omitempty"`
+}
+
+// repairUntilValid parses resp and, while the output is unusable, feeds the
+// problem back to the model asking only for the files that are still missing.
+// It gives up after g.MaxRepairs repair requests.
+func (g *Generator) repairUntilValid(ctx context.Context, mode GenerationMode, messages []ChatMessage, resp CompletionResponse, emit func(StreamEvent)) (GenerateOutput, []ChatMessage, error) {
+	out := GenerateOutput{Attempts: []GenerationAttempt{}}
+
+	for attempt := 0; ; attempt++ {
+		messages = append(messages, ChatMessage{Role: RoleAssistant, Content: assistantContent(resp)})
+
+		if err := ctx.Err(); err != nil {
+			return out, messages, err
+		}
+
+		parsed, parseErr := decodeOutput(mode, resp)
+		filled := mergeToolXML(&out.TldrawToolOutput, parsed)
+		iconErr := sanitizeIcon(&out.TldrawToolOutput)
+		missing := missingToolFiles(out.TldrawToolOutput)
+
+		// An id that breaks the policy is dropped so the repair can replace it
+		var idErr error
+		if out.Id != "" {
+			out.Id, idErr = NormalizeToolId(out.Id)
+		}
+
+		record := GenerationAttempt{
+			Attempt:      attempt,
+			MissingFiles: missing,
+			Usage:        resp.Usage,
+		}
+		if err := errors.Join(parseErr, idErr, iconErr); err != nil {
+			record.Error = err.Error()
+		}
+		out.Attempts = append(out.Attempts, record)
+
+		// In XML mode the files of the first response were already reported
+		// while streaming. The tool event is only sent once, so the id is
+		// reported here until one passes the policy.
+		if emit != nil && out.Id != "" {
+			emit(StreamEvent{Type: StreamEventTool, Data: ToolEventData{Id: out.Id}})
+		}
+		if emit != nil && (attempt > 0 || mode == ModeToolUse) {
+			for _, file := range filled {
+				emit(StreamEvent{Type: StreamEventFile, Data: file})
+			}
+		}
+
+		if out.Id != "" && len(missing) == 0 {
+			if out.Icon == "" {
+				out.Icon = icon.Fallback(out.Id, out.Name)
+				out.FallbackIcon = true
+			}
+			return out, messages, nil
+		}
+
+		if attempt >= g.MaxRepairs {
+			return out, messages, fmt.Errorf("tool output still invalid after %d repair attempts: %w", attempt, outputProblems(out.Id, parseErr, idErr, iconErr, missing))
+		}
+
+		// The icon is optional, but worth asking for while repairing anyway
+		wanted := missing
+		if out.Icon == "" {
+			wanted = append(wanted, "icon.svg")
+		}
+
+		log.Printf("Repairing tool output (attempt %d): error=%q missing=%q", attempt+1, record.Error, missing)
+		if emit != nil {
+			emit(StreamEvent{Type: StreamEventRepair, Data: record})
+		}
+
+		messages = append(messages, ChatMessage{
+			Role:    RoleUser,
+			Content: repairPrompt(mode, out.Id, parseErr, idErr, iconErr, wanted),
+		})
+
+		var err error
+		resp, err = g.complete(ctx, g.newRequest(mode, messages))
+		if err != nil {
+			return out, messages, err
+		}
+
+		log.Println("API Resp", resp.Text)
+	}
+}
+
+// mergeToolXML fills in the id, metadata and any files of tool that are still
+// empty from parsed, and returns the files it filled. Files completed before a
+// parse error are kept this way.
+func mergeToolXML(tool *TldrawToolOutput, parsed TldrawXML) []TldrawXMLFile {
+	if tool.Id == "" {
+		tool.Id = parsed.Id
+	}
+	if tool.Name == "" {
+		tool.Name = parsed.Name
+	}
+	if tool.Description == "" {
+		tool.Description = parsed.Description
+	}
+
+	filled := []TldrawXMLFile{}
+	for _, file := range parsed.Files {
+		target := toolFileField(tool, file.Name)
+		if target == nil {
+			if tool.addExtraFile(file.Name, file.Content) {
+				filled = append(filled, file)
+			}
+			continue
+		}
+		if *target != "" {
+			continue
+		}
+		*target = file.Content
+		filled = append(filled, file)
+	}
+
+	return filled
+}
+
+func toolFileField(tool *TldrawToolOutput, name string) *string {
+	switch name {
+	case "tool.ts":
+		return &tool.Tool
+	case "util.tsx":
+		return &tool.Util
+	case "icon.svg":
+		return &tool.Icon
+	default:
+		return nil
+	}
+}
+
+// missingToolFiles lists the required files that are empty and the files that
+// relative imports point at but were not produced.
+func missingToolFiles(tool TldrawToolOutput) []string {
+	missing := []string{}
+	for _, name := range requiredToolFiles {
+		if *toolFileField(&tool, name) == "" {
+			missing = append(missing, name)
+		}
+	}
+
+	for _, imp := range unresolvedImports(tool) {
+		if imp.Suggested != "" && !slices.Contains(missing, imp.Suggested) {
+			missing = append(missing, imp.Suggested)
+		}
+	}
+
+	return missing
+}
+
+// outputProblems joins everything that keeps an output from being usable.
+func outputProblems(toolId string, parseErr, idErr, iconErr error, missing []string) error {
+	var missingErr error
+	if len(missing) > 0 {
+		missingErr = fmt.Errorf("missing %s", strings.Join(missing, ", "))
+	} else if toolId == "" && idErr == nil {
+		missingErr = errors.New("missing the tool id")
+	}
+
+	return errors.Join(parseErr, idErr, iconErr, missingErr)
+}
+
+func repairPrompt(mode GenerationMode, toolId string, parseErr, idErr, iconErr error, missing []string) string {
+	var problems []string
+	if parseErr != nil {
+		problems = append(problems, fmt.Sprintf("it could not be parsed (%s)", parseErr))
+	}
+	if idErr != nil {
+		problems = append(problems, fmt.Sprintf("the tool id is not allowed (%s)", idErr))
+	} else if toolId == "" {
+		problems = append(problems, "the <tool> tag has no id")
+	}
+	if iconErr != nil {
+		problems = append(problems, fmt.Sprintf("the icon could not be used (%s)", iconErr))
+	}
+	if len(missing) > 0 {
+		problems = append(problems, fmt.Sprintf("it is missing %s", strings.Join(missing, ", ")))
+	}
+
+	id := toolId
+	if id == "" {
+		id = "..."
+	}
+
+	files := missing
+	if len(files) == 0 {
+		files = requiredToolFiles
+	}
+
+	prompt := PromptRepairTldrawTool
+	if mode == ModeToolUse {
+		prompt = PromptRepairToolUse
+	}
+
+	return fmt.Sprintf(prompt, strings.Join(problems, " and "), id, "- "+strings.Join(files, "\n- "))
+}
+
+// sanitizeIcon replaces the tool's icon with its sanitized form. An icon that
+// cannot be sanitized is dropped so that it counts as missing.
+func sanitizeIcon(tool *TldrawToolOutput) error {
+	if tool.Icon == "" {
+		return nil
+	}
+
+	result, err := icon.Sanitize(tool.Icon)
+	if err != nil {
+		tool.Icon = ""
+		return fmt.Errorf("invalid icon.svg: %w", err)
+	}
+
+	if len(result.Removed) > 0 {
+		log.Printf("Removed from icon of %s: %s", tool.Id, strings.Join(result.Removed, ", "))
+	}
+	tool.Icon = result.SVG
+
+	return nil
+}
+
+// nonEmpty guards against empty assistant turns, which the APIs reject.
+func nonEmpty(text string) string {
+	if strings.TrimSpace(text) == "" {
+		return "(empty response)"
+	}
+
+	return text
+}
@@ -0,0 +1,131 @@
+package ai
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"tlcrazy-backend/internal/icon"
+)
+
+func TestRepairUntilValid(t *testing.T) {
+	tool, err := parseTldrawToolXML(fakeToolOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withoutUtil := "<tool id=\"counter\">\n<file name=\"tool.ts\">" + tool.Tool + "</file>\n<file name=\"icon.svg\">" + tool.Icon + "</file>\n</tool>"
+	onlyUtil := "<tool id=\"counter\">\n<file name=\"util.tsx\">" + tool.Util + "</file>\n</tool>"
+	utilAndIcon := "<tool id=\"counter\">\n<file name=\"util.tsx\">" + tool.Util + "</file>\n<file name=\"icon.svg\">" + tool.Icon + "</file>\n</tool>"
+	unterminated := "<tool id=\"counter\">\n<file name=\"tool.ts\">" + tool.Tool + "</file>\n<file name=\"util.tsx\">" + tool.Util[:40]
+
+	t.Run("Asks only for the missing file", func(t *testing.T) {
+		provider := NewFakeProvider(withoutUtil, onlyUtil)
+		generator := newTestGenerator(t, provider)
+
+		out, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{})
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		if !reflect.DeepEqual(out.TldrawToolOutput, tool) {
+			t.Error("Expected the repaired tool to match the original")
+		}
+		if len(out.Attempts) != 2 {
+			t.Fatalf("Expected 2 attempts but got %d", len(out.Attempts))
+		}
+		if got := out.Attempts[0].MissingFiles; len(got) != 1 || got[0] != "util.tsx" {
+			t.Errorf("Expected util.tsx to be missing on the first attempt but got %q", got)
+		}
+
+		repairMsg := provider.Requests()[1].Messages[2].Content
+		if !strings.Contains(repairMsg, "- util.tsx") || strings.Contains(repairMsg, "- tool.ts") {
+			t.Errorf("Expected the repair to ask only for util.tsx but got %q", repairMsg)
+		}
+	})
+
+	t.Run("Feeds parser errors back to the model", func(t *testing.T) {
+		provider := NewFakeProvider(unterminated, utilAndIcon)
+		generator := newTestGenerator(t, provider)
+
+		out, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{})
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		if !reflect.DeepEqual(out.TldrawToolOutput, tool) {
+			t.Error("Expected the repaired tool to match the original")
+		}
+		if out.Attempts[0].Error == "" {
+			t.Error("Expected the parse error to be recorded")
+		}
+		if !strings.Contains(provider.Requests()[1].Messages[2].Content, "missing </file> tag") {
+			t.Error("Expected the parse error in the repair message")
+		}
+	})
+
+	t.Run("Falls back to a generated icon", func(t *testing.T) {
+		brokenIcon := strings.Replace(fakeToolOutput, tool.Icon, "<svg><path d=\"M0 0\">", 1)
+		provider := NewFakeProvider(brokenIcon)
+		generator := newTestGenerator(t, provider)
+
+		out, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{})
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		if want := icon.Fallback("counter", ""); out.Icon != want || !out.FallbackIcon {
+			t.Errorf("Expected the fallback icon %q\nbut got %q", want, out.Icon)
+		}
+		if !strings.Contains(out.Attempts[0].Error, "invalid icon.svg") {
+			t.Errorf("Expected the icon error to be recorded but got %q", out.Attempts[0].Error)
+		}
+		if got := len(provider.Requests()); got != 1 {
+			t.Errorf("Expected no repair for the icon alone but got %d requests", got)
+		}
+
+		written, err := os.ReadFile(newToolPaths(generator.Workspace, "counter").Icon)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(written) != out.Icon {
+			t.Error("Expected the fallback icon to be written")
+		}
+	})
+
+	t.Run("Gives up after the repair budget", func(t *testing.T) {
+		provider := NewFakeProvider("Sorry, I can't help with that.")
+		generator := newTestGenerator(t, provider)
+		generator.MaxRepairs = 2
+
+		if _, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{}); err == nil {
+			t.Fatal("Expected an error but didn't get one")
+		}
+		if got := len(provider.Requests()); got != 3 {
+			t.Errorf("Expected 1 generation and 2 repairs but got %d requests", got)
+		}
+	})
+}
+
+func TestRepairReportsMissingFiles(t *testing.T) {
+	badIcon := strings.Replace(fakeToolOutput, "<svg", "<div", 1)
+	badIcon = strings.Replace(badIcon, "from 'tldraw'", "from 'tldraw'\nimport { counterProps } from './counter-props'", 1)
+	provider := NewFakeProvider(badIcon)
+	generator := newTestGenerator(t, provider)
+	generator.MaxRepairs = 1
+
+	_, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{})
+	if err == nil {
+		t.Fatal("Expected an error but didn't get one")
+	}
+	if !strings.Contains(err.Error(), "invalid icon.svg") || !strings.Contains(err.Error(), "missing counter-props.ts") {
+		t.Errorf("Expected the icon and the missing file in the error but got %q", err)
+	}
+
+	repairMsg := provider.Requests()[1].Messages[2].Content
+	if !strings.Contains(repairMsg, "the icon could not be used") || !strings.Contains(repairMsg, "it is missing counter-props.ts") {
+		t.Errorf("Expected the repair to name the icon and the missing file but got %q", repairMsg)
+	}
+}
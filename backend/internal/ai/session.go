@@ -0,0 +1,108 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSessionsDir        = ".tlcrazy/sessions"
+	defaultMaxSessionMessages = 12
+)
+
+// Session is the conversation that produced a tool, kept so the tool can be
+// refined later with follow-up instructions.
+type Session struct {
+	ToolId    string        `json:"toolId"`
+	Messages  []ChatMessage `json:"messages"`
+	CreatedAt time.Time     `json:"createdAt"`
+	UpdatedAt time.Time     `json:"updatedAt"`
+}
+
+// SessionStore persists sessions as one JSON file per tool in Dir. Every
+// refine sends the whole session along with the current files, so only the
+// first request and the latest MaxMessages messages are kept. Zero keeps all.
+type SessionStore struct {
+	Dir         string
+	MaxMessages int
+	mu          sync.Mutex
+}
+
+func NewSessionStore(dir string) *SessionStore {
+	return &SessionStore{Dir: dir, MaxMessages: defaultMaxSessionMessages}
+}
+
+// Load returns the session for toolId, or an empty session if none exists yet.
+func (s *SessionStore) Load(toolId string) (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, err := os.ReadFile(s.path(toolId))
+	if errors.Is(err, os.ErrNotExist) {
+		return Session{ToolId: toolId}, nil
+	}
+	if err != nil {
+		return Session{}, err
+	}
+
+	var session Session
+	if err := json.Unmarshal(content, &session); err != nil {
+		return Session{}, fmt.Errorf("failed to parse session for %s: %v", toolId, err)
+	}
+
+	return session, nil
+}
+
+func (s *SessionStore) Save(session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = now
+	}
+	session.UpdatedAt = now
+	session.Messages = trimMessages(session.Messages, s.MaxMessages)
+
+	if err := ensureDirectoryExists(s.Dir); err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temp file first so a crash never leaves a truncated session
+	tmpPath := s.path(session.ToolId) + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, s.path(session.ToolId))
+}
+
+func (s *SessionStore) path(toolId string) string {
+	return filepath.Join(s.Dir, toolId+".json")
+}
+
+// trimMessages keeps the first message, which asked for the tool, and the
+// last limit messages. The kept tail starts with an answer so that turns still
+// alternate.
+func trimMessages(messages []ChatMessage, limit int) []ChatMessage {
+	if limit <= 0 || len(messages) <= limit+1 {
+		return messages
+	}
+
+	tail := messages[len(messages)-limit:]
+	for len(tail) > 0 && tail[0].Role != RoleAssistant {
+		tail = tail[1:]
+	}
+
+	return append([]ChatMessage{messages[0]}, tail...)
+}
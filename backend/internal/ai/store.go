@@ -0,0 +1,223 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"tlcrazy-backend/internal/config"
+)
+
+// ToolStore is where installed tools live. Installs and removals are all or
+// nothing: a failed one leaves the store as it was.
+type ToolStore interface {
+	// Install writes every file of tool and puts entry in the manifest, in
+	// place of any earlier version. The id and hashes of the entry are taken
+	// from tool. It returns the entry as stored.
+	Install(ctx context.Context, tool TldrawToolOutput, entry ToolEntry) (ToolEntry, error)
+
+	// Tool returns the id and files of an installed tool, or ErrToolNotFound.
+	Tool(ctx context.Context, toolId string) (TldrawToolOutput, error)
+
+	Manifest(ctx context.Context) (ToolManifest, error)
+
+	// UpdateManifest applies fn to the manifest and stores the result.
+	// Nothing is stored when fn fails.
+	UpdateManifest(ctx context.Context, fn func(m *ToolManifest) error) error
+
+	// Remove uninstalls a tool, or returns ErrToolNotFound.
+	Remove(ctx context.Context, toolId string) error
+}
+
+// installedEntry is entry as stored for tool.
+func installedEntry(tool TldrawToolOutput, entry ToolEntry) ToolEntry {
+	entry.Id = tool.Id
+	entry.Hashes = hashToolFiles(tool)
+
+	return entry
+}
+
+// checkInstall rejects tools a store must not hold.
+func checkInstall(tool TldrawToolOutput) error {
+	if err := ValidateToolId(tool.Id); err != nil {
+		return err
+	}
+	if result := validateToolOutput(tool); !result.Valid {
+		return fmt.Errorf("invalid tool: %s", strings.Join(result.Errors, ", "))
+	}
+
+	return nil
+}
+
+// FileToolStore keeps tools in the source tree of the frontend app of
+// Workspace, which bundles them, with tools.json as the manifest.
+type FileToolStore struct {
+	Workspace config.Workspace
+
+	fault installFault
+}
+
+func NewFileToolStore(workspace config.Workspace) *FileToolStore {
+	return &FileToolStore{Workspace: workspace}
+}
+
+func (s *FileToolStore) registry() *ToolRegistry {
+	return NewToolRegistry(newToolPaths(s.Workspace, "").ToolsJSON)
+}
+
+func (s *FileToolStore) Install(ctx context.Context, tool TldrawToolOutput, entry ToolEntry) (ToolEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return ToolEntry{}, err
+	}
+
+	// Check if the workspace is valid
+	if s.Workspace.Root == "" {
+		return ToolEntry{}, ErrNoWorkspace
+	}
+	if _, err := os.Stat(s.Workspace.Root); err != nil {
+		return ToolEntry{}, err
+	}
+
+	paths, err := resolveToolPaths(s.Workspace, tool.Id)
+	if err != nil {
+		return ToolEntry{}, err
+	}
+	for _, file := range tool.Files {
+		if err := ensureWithin(paths.Folder, paths.File(file.Name)); err != nil {
+			return ToolEntry{}, err
+		}
+	}
+
+	return installTool(ctx, tool, installedEntry(tool, entry), paths, s.fault)
+}
+
+func (s *FileToolStore) Tool(ctx context.Context, toolId string) (TldrawToolOutput, error) {
+	return readToolFiles(s.Workspace, toolId)
+}
+
+func (s *FileToolStore) Manifest(ctx context.Context) (ToolManifest, error) {
+	return s.registry().Load()
+}
+
+func (s *FileToolStore) UpdateManifest(ctx context.Context, fn func(m *ToolManifest) error) error {
+	return s.registry().Update(fn)
+}
+
+func (s *FileToolStore) Remove(ctx context.Context, toolId string) error {
+	paths, err := resolveToolPaths(s.Workspace, toolId)
+	if err != nil {
+		return err
+	}
+
+	return uninstallTool(ctx, toolId, paths, s.fault)
+}
+
+// MemoryToolStore keeps tools in memory, for tests and throwaway servers.
+type MemoryToolStore struct {
+	mu       sync.Mutex
+	manifest ToolManifest
+	tools    map[string]TldrawToolOutput
+}
+
+func NewMemoryToolStore() *MemoryToolStore {
+	s := &MemoryToolStore{tools: map[string]TldrawToolOutput{}}
+	s.manifest.normalize()
+
+	return s
+}
+
+func (s *MemoryToolStore) Install(ctx context.Context, tool TldrawToolOutput, entry ToolEntry) (ToolEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return ToolEntry{}, err
+	}
+	if err := checkInstall(tool); err != nil {
+		return ToolEntry{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	installed := s.manifest.put(installedEntry(tool, entry), time.Now().UTC())
+	s.manifest.normalize()
+	s.tools[tool.Id] = cloneTool(tool)
+
+	return installed, nil
+}
+
+func (s *MemoryToolStore) Tool(ctx context.Context, toolId string) (TldrawToolOutput, error) {
+	if err := ValidateToolId(toolId); err != nil {
+		return TldrawToolOutput{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tool, ok := s.tools[toolId]
+	if !ok {
+		return TldrawToolOutput{}, ErrToolNotFound
+	}
+
+	return cloneTool(tool), nil
+}
+
+func (s *MemoryToolStore) Manifest(ctx context.Context) (ToolManifest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return cloneManifest(s.manifest), nil
+}
+
+func (s *MemoryToolStore) UpdateManifest(ctx context.Context, fn func(m *ToolManifest) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := cloneManifest(s.manifest)
+	if err := fn(&m); err != nil {
+		return err
+	}
+	m.normalize()
+	s.manifest = m
+
+	return nil
+}
+
+func (s *MemoryToolStore) Remove(ctx context.Context, toolId string) error {
+	if err := ValidateToolId(toolId); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, installed := s.tools[toolId]
+	if !s.manifest.remove(toolId) && !installed {
+		return ErrToolNotFound
+	}
+	s.manifest.normalize()
+	delete(s.tools, toolId)
+
+	return nil
+}
+
+func cloneTool(tool TldrawToolOutput) TldrawToolOutput {
+	tool.Files = slices.Clone(tool.Files)
+	return tool
+}
+
+func cloneManifest(m ToolManifest) ToolManifest {
+	m.Ids = slices.Clone(m.Ids)
+	m.Tools = slices.Clone(m.Tools)
+	for i := range m.Tools {
+		m.Tools[i].Hashes = maps.Clone(m.Tools[i].Hashes)
+	}
+
+	return m
+}
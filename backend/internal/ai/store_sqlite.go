@@ -0,0 +1,274 @@
+//go:build cgo
+
+package ai
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Files reference their tool lazily, so an install can write the files and
+// the manifest in either order within its transaction.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS tools (
+	id             TEXT PRIMARY KEY,
+	name           TEXT NOT NULL,
+	description    TEXT NOT NULL,
+	query          TEXT NOT NULL,
+	model          TEXT NOT NULL,
+	prompt_version TEXT NOT NULL,
+	hashes         TEXT NOT NULL,
+	version        INTEGER NOT NULL,
+	created_at     TEXT NOT NULL,
+	updated_at     TEXT NOT NULL,
+	enabled        INTEGER NOT NULL,
+	position       INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS tool_files (
+	tool_id TEXT NOT NULL REFERENCES tools (id) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED,
+	name    TEXT NOT NULL,
+	seq     INTEGER NOT NULL,
+	content TEXT NOT NULL,
+	PRIMARY KEY (tool_id, name)
+);
+`
+
+// SQLiteToolStore keeps tools in a SQLite database, which makes the server
+// the source of truth for tools instead of the frontend's source tree.
+type SQLiteToolStore struct {
+	db *sql.DB
+}
+
+// OpenSQLiteToolStore opens the database at path, creating it if needed.
+func OpenSQLiteToolStore(path string) (*SQLiteToolStore, error) {
+	if err := ensureDirectoryExists(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+
+	// Writers take the lock when they begin, so concurrent installs wait for
+	// each other instead of failing on upgrade
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_foreign_keys=on&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot create tables in %s: %w", path, err)
+	}
+
+	return &SQLiteToolStore{db: db}, nil
+}
+
+func (s *SQLiteToolStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteToolStore) Install(ctx context.Context, tool TldrawToolOutput, entry ToolEntry) (ToolEntry, error) {
+	if err := checkInstall(tool); err != nil {
+		return ToolEntry{}, err
+	}
+
+	var installed ToolEntry
+	err := s.update(ctx, func(tx *sql.Tx, m *ToolManifest) error {
+		installed = m.put(installedEntry(tool, entry), time.Now().UTC())
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM tool_files WHERE tool_id = ?`, tool.Id); err != nil {
+			return err
+		}
+		for i, file := range tool.AllFiles() {
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO tool_files (tool_id, name, seq, content) VALUES (?, ?, ?, ?)`,
+				tool.Id, file.Name, i, file.Content,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return ToolEntry{}, fmt.Errorf("cannot install %s: %w", tool.Id, err)
+	}
+
+	return installed, nil
+}
+
+func (s *SQLiteToolStore) Tool(ctx context.Context, toolId string) (TldrawToolOutput, error) {
+	if err := ValidateToolId(toolId); err != nil {
+		return TldrawToolOutput{}, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT name, content FROM tool_files WHERE tool_id = ? ORDER BY seq`, toolId)
+	if err != nil {
+		return TldrawToolOutput{}, err
+	}
+	defer rows.Close()
+
+	tool := TldrawToolOutput{Id: toolId}
+	found := false
+	for rows.Next() {
+		var name, content string
+		if err := rows.Scan(&name, &content); err != nil {
+			return TldrawToolOutput{}, err
+		}
+		if !tool.setFile(name, content) {
+			return TldrawToolOutput{}, fmt.Errorf("tool %s has an unknown file %q", toolId, name)
+		}
+		found = true
+	}
+	if err := rows.Err(); err != nil {
+		return TldrawToolOutput{}, err
+	}
+
+	if !found {
+		return TldrawToolOutput{}, ErrToolNotFound
+	}
+
+	return tool, nil
+}
+
+func (s *SQLiteToolStore) Manifest(ctx context.Context) (ToolManifest, error) {
+	return readSQLiteManifest(ctx, s.db)
+}
+
+func (s *SQLiteToolStore) UpdateManifest(ctx context.Context, fn func(m *ToolManifest) error) error {
+	return s.update(ctx, func(tx *sql.Tx, m *ToolManifest) error {
+		return fn(m)
+	})
+}
+
+func (s *SQLiteToolStore) Remove(ctx context.Context, toolId string) error {
+	if err := ValidateToolId(toolId); err != nil {
+		return err
+	}
+
+	return s.update(ctx, func(tx *sql.Tx, m *ToolManifest) error {
+		if !m.remove(toolId) {
+			return ErrToolNotFound
+		}
+
+		// Removing the entry deletes the files along with it
+		return nil
+	})
+}
+
+// update runs fn on the manifest in a transaction and writes the manifest
+// back. Entries fn removes are deleted with their files.
+func (s *SQLiteToolStore) update(ctx context.Context, fn func(tx *sql.Tx, m *ToolManifest) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	m, err := readSQLiteManifest(ctx, tx)
+	if err != nil {
+		return err
+	}
+	previous := map[string]bool{}
+	for _, entry := range m.Tools {
+		previous[entry.Id] = true
+	}
+
+	if err := fn(tx, &m); err != nil {
+		return err
+	}
+	m.normalize()
+
+	for _, entry := range m.Tools {
+		delete(previous, entry.Id)
+		if err := writeSQLiteEntry(ctx, tx, entry); err != nil {
+			return err
+		}
+	}
+	for id := range previous {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM tools WHERE id = ?`, id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+type sqlQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func readSQLiteManifest(ctx context.Context, q sqlQueryer) (ToolManifest, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, name, description, query, model, prompt_version, hashes, version, created_at, updated_at, enabled, position
+		FROM tools ORDER BY position, id`)
+	if err != nil {
+		return ToolManifest{}, err
+	}
+	defer rows.Close()
+
+	m := ToolManifest{}
+	for rows.Next() {
+		var entry ToolEntry
+		var hashes, createdAt, updatedAt string
+		err := rows.Scan(
+			&entry.Id, &entry.Name, &entry.Description, &entry.Query, &entry.Model, &entry.PromptVersion,
+			&hashes, &entry.Version, &createdAt, &updatedAt, &entry.Enabled, &entry.Order,
+		)
+		if err != nil {
+			return ToolManifest{}, err
+		}
+
+		if err := json.Unmarshal([]byte(hashes), &entry.Hashes); err != nil {
+			return ToolManifest{}, fmt.Errorf("invalid hashes of %s: %w", entry.Id, err)
+		}
+		if entry.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+			return ToolManifest{}, err
+		}
+		if entry.UpdatedAt, err = time.Parse(time.RFC3339Nano, updatedAt); err != nil {
+			return ToolManifest{}, err
+		}
+
+		m.Tools = append(m.Tools, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return ToolManifest{}, err
+	}
+
+	m.normalize()
+	return m, nil
+}
+
+func writeSQLiteEntry(ctx context.Context, tx *sql.Tx, entry ToolEntry) error {
+	hashes, err := json.Marshal(entry.Hashes)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO tools (id, name, description, query, model, prompt_version, hashes, version, created_at, updated_at, enabled, position)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			name = excluded.name,
+			description = excluded.description,
+			query = excluded.query,
+			model = excluded.model,
+			prompt_version = excluded.prompt_version,
+			hashes = excluded.hashes,
+			version = excluded.version,
+			created_at = excluded.created_at,
+			updated_at = excluded.updated_at,
+			enabled = excluded.enabled,
+			position = excluded.position`,
+		entry.Id, entry.Name, entry.Description, entry.Query, entry.Model, entry.PromptVersion, string(hashes),
+		entry.Version, entry.CreatedAt.Format(time.RFC3339Nano), entry.UpdatedAt.Format(time.RFC3339Nano),
+		entry.Enabled, entry.Order,
+	)
+
+	return err
+}
@@ -0,0 +1,19 @@
+//go:build !cgo
+
+package ai
+
+import "errors"
+
+// SQLiteToolStore needs cgo for its SQLite driver, so builds without cgo
+// can only report it as unavailable.
+type SQLiteToolStore struct {
+	ToolStore
+}
+
+func OpenSQLiteToolStore(path string) (*SQLiteToolStore, error) {
+	return nil, errors.New("the SQLite tool store needs a build with cgo")
+}
+
+func (s *SQLiteToolStore) Close() error {
+	return nil
+}
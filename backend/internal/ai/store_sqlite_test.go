@@ -0,0 +1,47 @@
+//go:build cgo
+
+package ai
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSQLiteToolStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tools.db")
+
+	store, err := OpenSQLiteToolStore(path)
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+	testToolStore(t, store)
+
+	before, err := store.Manifest(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Survives a restart", func(t *testing.T) {
+		store, err := OpenSQLiteToolStore(path)
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		defer store.Close()
+
+		after, err := store.Manifest(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(after, before) {
+			t.Errorf("Expected %+v\nbut got %+v", before, after)
+		}
+		if _, err := store.Tool(context.Background(), "timer"); err != nil {
+			t.Error("Expected the files of timer to be kept", err)
+		}
+	})
+}
@@ -0,0 +1,181 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testToolStore checks the behavior every ToolStore shares.
+func testToolStore(t *testing.T, store ToolStore) {
+	ctx := context.Background()
+
+	tool, err := parseTldrawToolXML(fakeToolOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withProps := tool
+	withProps.addExtraFile("counter-props.ts", "export default {}")
+
+	first, err := store.Install(ctx, withProps, newToolEntry(withProps, ToolOrigin{Query: "a counter button"}))
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+	if first.Id != "counter" || first.Version != 1 || !first.Enabled || first.Query != "a counter button" || len(first.Hashes) != 4 {
+		t.Errorf("Unexpected entry %+v", first)
+	}
+
+	got, err := store.Tool(ctx, "counter")
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+	if !reflect.DeepEqual(got.AllFiles(), withProps.AllFiles()) {
+		t.Errorf("Expected %+v\nbut got %+v", withProps.AllFiles(), got.AllFiles())
+	}
+
+	t.Run("Replaces the previous version", func(t *testing.T) {
+		second, err := store.Install(ctx, tool, newToolEntry(tool, ToolOrigin{}))
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		if second.Version != 2 || !second.CreatedAt.Equal(first.CreatedAt) {
+			t.Errorf("Unexpected entry %+v", second)
+		}
+
+		got, err := store.Tool(ctx, "counter")
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		if len(got.Files) != 0 {
+			t.Errorf("Expected the extra file of the previous version to be gone but got %+v", got.Files)
+		}
+	})
+
+	t.Run("Updates the manifest", func(t *testing.T) {
+		timer := tool
+		timer.Id = "timer"
+		if _, err := store.Install(ctx, timer, newToolEntry(timer, ToolOrigin{})); err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		err := store.UpdateManifest(ctx, func(m *ToolManifest) error {
+			m.move("timer", 0)
+			return nil
+		})
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		failed := errors.New("failed")
+		err = store.UpdateManifest(ctx, func(m *ToolManifest) error {
+			m.remove("counter")
+			return failed
+		})
+		if !errors.Is(err, failed) {
+			t.Errorf("Expected the error of fn but got %v", err)
+		}
+
+		manifest, err := store.Manifest(ctx)
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		if !reflect.DeepEqual(manifest.Ids, []string{"timer", "counter"}) {
+			t.Errorf("Expected timer to move first but got %q", manifest.Ids)
+		}
+	})
+
+	t.Run("Rejects incomplete tools", func(t *testing.T) {
+		incomplete := TldrawToolOutput{Id: "counter", Tool: "x", Icon: "x"}
+		if _, err := store.Install(ctx, incomplete, ToolEntry{}); err == nil {
+			t.Error("Expected an error for the missing util.tsx")
+		}
+
+		manifest, err := store.Manifest(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry, _ := manifest.Get("counter"); entry.Version != 2 {
+			t.Errorf("Expected the manifest to be left alone but got %+v", entry)
+		}
+	})
+
+	t.Run("Removes tools", func(t *testing.T) {
+		if err := store.Remove(ctx, "counter"); err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		if _, err := store.Tool(ctx, "counter"); !errors.Is(err, ErrToolNotFound) {
+			t.Errorf("Expected ErrToolNotFound but got %v", err)
+		}
+		if err := store.Remove(ctx, "counter"); !errors.Is(err, ErrToolNotFound) {
+			t.Errorf("Expected ErrToolNotFound but got %v", err)
+		}
+
+		manifest, err := store.Manifest(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(manifest.Ids, []string{"timer"}) {
+			t.Errorf("Expected only timer to be left but got %q", manifest.Ids)
+		}
+	})
+
+	t.Run("Unsafe tool ids", func(t *testing.T) {
+		if _, err := store.Tool(ctx, "../counter"); !errors.Is(err, ErrInvalidToolId) {
+			t.Errorf("Expected ErrInvalidToolId but got %v", err)
+		}
+		if err := store.Remove(ctx, "../counter"); !errors.Is(err, ErrInvalidToolId) {
+			t.Errorf("Expected ErrInvalidToolId but got %v", err)
+		}
+	})
+}
+
+func TestFileToolStore(t *testing.T) {
+	testToolStore(t, NewFileToolStore(newTestApp(t)))
+}
+
+func TestMemoryToolStore(t *testing.T) {
+	testToolStore(t, NewMemoryToolStore())
+}
+
+func TestGeneratorWithToolStore(t *testing.T) {
+	tool, err := parseTldrawToolXML(fakeToolOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refined := "<tool id=\"counter\">\n<file name=\"util.tsx\">// refined\n" + tool.Util + "</file>\n</tool>"
+
+	generator := newTestGenerator(t, NewFakeProvider(fakeToolOutput, refined))
+	generator.Workspace.Root = ""
+	generator.Store = NewMemoryToolStore()
+
+	if _, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{}); err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+	if _, err := generator.RefineTldrawTool(context.Background(), "counter", "add a comment"); err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+
+	installed, err := generator.GetTool(context.Background(), "counter")
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+	if installed.Version != 2 || installed.Query != "a counter button" {
+		t.Errorf("Unexpected entry %+v", installed.ToolEntry)
+	}
+
+	util, err := generator.ToolFile(context.Background(), "counter", "util.tsx")
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+	if util.Content != "// refined\n"+tool.Util {
+		t.Errorf("Expected the refined util.tsx but got %q", util.Content)
+	}
+	if _, err := generator.ToolFile(context.Background(), "counter", "missing.ts"); !errors.Is(err, ErrToolNotFound) {
+		t.Errorf("Expected ErrToolNotFound but got %v", err)
+	}
+
+	if versions, _ := generator.ToolVersions("counter"); len(versions) != 2 || versions[1].Version != 2 {
+		t.Errorf("Expected both versions in the history but got %+v", versions)
+	}
+}
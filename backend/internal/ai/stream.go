@@ -0,0 +1,71 @@
+package ai
+
+import (
+	"fmt"
+
+	"tlcrazy-backend/internal/validator"
+)
+
+type StreamEventType string
+
+const (
+	StreamEventDelta      StreamEventType = "delta"
+	StreamEventTool       StreamEventType = "tool"
+	StreamEventFile       StreamEventType = "file"
+	StreamEventRepair     StreamEventType = "repair"
+	StreamEventValidation StreamEventType = "validation"
+	StreamEventDone       StreamEventType = "done"
+)
+
+// StreamEvent is a progress update emitted while a tool is being generated.
+type StreamEvent struct {
+	Type StreamEventType
+	Data any
+}
+
+type DeltaEventData struct {
+	Text string `json:"text"`
+}
+
+type ToolEventData struct {
+	Id string `json:"id"`
+}
+
+type ValidationResult struct {
+	Valid  bool     `json:"valid"`
+	Errors []string `json:"errors,omitempty"`
+
+	Diagnostics []validator.Diagnostic `json:"diagnostics,omitempty"`
+	Policy      *PolicyVerdict         `json:"policy,omitempty"`
+}
+
+// coreToolFiles are the files every tool has. The icon is not required from
+// the model since a fallback icon is generated when it is missing.
+var (
+	coreToolFiles     = []string{"tool.ts", "util.tsx", "icon.svg"}
+	requiredToolFiles = []string{"tool.ts", "util.tsx"}
+)
+
+func validateToolOutput(tool TldrawToolOutput) ValidationResult {
+	errors := []string{}
+
+	if tool.Id == "" {
+		errors = append(errors, "missing tool id")
+	}
+
+	for _, name := range missingToolFiles(tool) {
+		errors = append(errors, fmt.Sprintf("missing %s", name))
+	}
+
+	// Imports that no extra file can satisfy are already covered above
+	for _, imp := range unresolvedImports(tool) {
+		if imp.Suggested == "" {
+			errors = append(errors, imp.String())
+		}
+	}
+
+	return ValidationResult{
+		Valid:  len(errors) == 0,
+		Errors: errors,
+	}
+}
@@ -2,264 +2,409 @@ package ai
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
-	"sort"
-	"strings"
-	"sync"
+	"time"
 
-	"github.com/liushuangls/go-anthropic/v2"
+	"tlcrazy-backend/internal/codemod"
+	"tlcrazy-backend/internal/config"
+	"tlcrazy-backend/internal/typecheck"
+	"tlcrazy-backend/internal/validator"
 )
 
 type TldrawToolOutput struct {
-	Id   string `json:"id"`
-	Icon string `json:"icon"`
-	Tool string `json:"tool"`
-	Util string `json:"util"`
+	Id          string `json:"id"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Icon        string `json:"icon"`
+	Tool        string `json:"tool"`
+	Util        string `json:"util"`
+
+	// Files holds the extra files next to tool.ts and util.tsx, such as
+	// props, migrations or styles, in the order the model produced them.
+	Files []ToolFile `json:"files,omitempty"`
 }
 
-func GenTldrawTool(query string) (TldrawToolOutput, error) {
-	api_key := os.Getenv("ANTHROPIC_API_KEY")
-	if api_key == "" {
-		return TldrawToolOutput{}, errors.New("anthropic API Key env var not found")
-	}
+const defaultMaxTokens = 4096
 
-	anthropic_client := anthropic.NewClient(api_key)
+// Generator turns a user query into a tldraw tool using an LLM provider and
+// installs the result into the frontend app of Workspace.
+type Generator struct {
+	Provider  Provider
+	Workspace config.Workspace
+	Sessions  *SessionStore
 
-	resp, err := anthropic_client.CreateMessages(context.Background(), anthropic.MessagesRequest{
-		Model:     anthropic.ModelClaude3Dot5Sonnet20240620,
-		MaxTokens: 4096,
-		Messages: []anthropic.Message{
-			anthropic.NewUserTextMessage(query),
-		},
-		System: SystemPromptGenTldrawTool,
-	})
-	if err != nil {
-		return TldrawToolOutput{}, err
-	}
+	// Store holds the installed tools. Nil installs them into the source
+	// tree of Workspace.
+	Store ToolStore
 
-	log.Println("API Resp", resp.Content[0].GetText())
+	// History keeps every installed version of each tool, so tools can be
+	// rolled back. Nil keeps no history.
+	History *HistoryStore
 
-	tool, err := parseTldrawToolXML(resp.Content[0].GetText())
-	if err != nil {
-		return TldrawToolOutput{}, err
+	// MaxRepairs is how many times an unusable model output is sent back to
+	// the model for repair before giving up.
+	MaxRepairs int
+
+	// MaxTokens is the output token ceiling per request. Responses cut off at
+	// the ceiling are continued up to MaxContinuations times.
+	MaxTokens        int
+	MaxContinuations int
+
+	// MaxCandidates caps GenerateOptions.Candidates and MaxConcurrency caps
+	// how many candidates are generated at the same time.
+	MaxCandidates  int
+	MaxConcurrency int
+
+	// DefaultMode is used when a request does not pick a generation mode.
+	DefaultMode GenerationMode
+
+	// Codemods fix common mistakes in the generated code before it is
+	// validated and written.
+	Codemods codemod.Pipeline
+
+	// TypeChecker compiles the tool before it is written, and type errors
+	// are sent back to the model up to MaxTypeFixes times. Nil skips it.
+	TypeChecker  *typecheck.Checker
+	MaxTypeFixes int
+
+	// Validator checks generated code against the rules from the system
+	// prompt. Nil skips the checks.
+	Validator *validator.Validator
+
+	// Policy blocks or flags generated code that uses dangerous APIs or
+	// talks to hosts that are not allow-listed. Every verdict is appended to
+	// Audit. Nil skips the scan.
+	Policy *Policy
+	Audit  *AuditLog
+
+	Timeouts StageTimeouts
+}
+
+// StageTimeouts bound each stage of the pipeline. Zero means no timeout
+// beyond the caller's context.
+type StageTimeouts struct {
+	// Generate covers every LLM request made for a tool, including repairs.
+	Generate time.Duration
+	Write    time.Duration
+}
+
+func withStageTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
 	}
 
-	writeToolFiles(tool, "/Users/13point5/projects/tlcrazy/frontend")
+	return context.WithTimeout(ctx, timeout)
+}
 
-	return tool, nil
+func NewGenerator(provider Provider) *Generator {
+	return &Generator{
+		Provider:   provider,
+		Sessions:   NewSessionStore(defaultSessionsDir),
+		History:    NewHistoryStore(defaultHistoryDir),
+		MaxRepairs: defaultMaxRepairs,
+
+		MaxTokens:        defaultMaxTokens,
+		MaxContinuations: defaultMaxContinuations,
+
+		MaxCandidates:  defaultMaxCandidates,
+		MaxConcurrency: defaultMaxConcurrency,
+
+		DefaultMode:  ModeXML,
+		Codemods:     codemod.Default(),
+		MaxTypeFixes: defaultMaxTypeFixes,
+		Validator:    validator.Default(),
+		Policy:       DefaultPolicy(),
+		Audit:        NewAuditLog(defaultAuditLog),
+	}
 }
 
-type TldrawXML struct {
-	Id    string
-	Files []TldrawXMLFile
+func (g *Generator) GenTldrawTool(ctx context.Context, query string, opts GenerateOptions) (GenerateOutput, error) {
+	return g.generate(ctx, query, opts, nil)
 }
 
-type TldrawXMLFile struct {
-	Name    string
-	Content string
+// GenTldrawToolStream works like GenTldrawTool but reports progress through
+// emit as the model output streams in.
+func (g *Generator) GenTldrawToolStream(ctx context.Context, query string, opts GenerateOptions, emit func(StreamEvent)) (GenerateOutput, error) {
+	return g.generate(ctx, query, opts, emit)
 }
 
-func customXMLParser(xmlString string) (TldrawXML, error) {
-	var tldraw TldrawXML
+func (g *Generator) generate(ctx context.Context, query string, opts GenerateOptions, emit func(StreamEvent)) (GenerateOutput, error) {
+	genCtx, cancel := withStageTimeout(ctx, g.Timeouts.Generate)
+	defer cancel()
 
-	// Find the <tool> tag and extract the id attribute
-	toolStart := strings.Index(xmlString, "<tool")
-	toolEnd := strings.Index(xmlString, ">")
-	if toolStart == -1 || toolEnd == -1 {
-		return tldraw, fmt.Errorf("invalid XML: missing <tool> tag")
+	var out GenerateOutput
+	var messages []ChatMessage
+	var err error
+	mode := opts.Mode
+	if mode == "" {
+		mode = g.DefaultMode
 	}
-
-	// Extract the id attribute from <tool>
-	toolTag := xmlString[toolStart:toolEnd]
-	idIndex := strings.Index(toolTag, `id="`)
-	if idIndex != -1 {
-		idStart := idIndex + len(`id="`)
-		idEnd := strings.Index(toolTag[idStart:], `"`)
-		tldraw.Id = toolTag[idStart : idStart+idEnd]
+	if !mode.Valid() {
+		return GenerateOutput{}, fmt.Errorf("%w: unknown mode %q, use one of %q", ErrInvalidOptions, mode, GenerationModes)
 	}
 
-	// Process each <file> tag
-	for {
-		fileStart := strings.Index(xmlString, "<file")
-		if fileStart == -1 {
-			break
+	if opts.Candidates > 1 {
+		out, messages, err = g.generateCandidates(genCtx, query, mode, opts.Candidates, opts)
+		if err == nil && emit != nil {
+			// Candidates are not streamed, so only the winner is reported
+			emitToolFiles(emit, out.TldrawToolOutput)
 		}
-
-		fileEnd := strings.Index(xmlString[fileStart:], ">")
-		if fileEnd == -1 {
-			return tldraw, fmt.Errorf("invalid XML: malformed <file> tag")
-		}
-		fileEnd += fileStart
-
-		// Extract the name attribute from <file>
-		fileTag := xmlString[fileStart:fileEnd]
-		nameIndex := strings.Index(fileTag, `name="`)
-		var file TldrawXMLFile
-		if nameIndex != -1 {
-			nameStart := nameIndex + len(`name="`)
-			nameEnd := strings.Index(fileTag[nameStart:], `"`)
-			file.Name = fileTag[nameStart : nameStart+nameEnd]
+	} else {
+		out, messages, err = g.generateCandidate(genCtx, query, mode, emit)
+		if err == nil {
+			g.applyCodemods(&out, opts)
 		}
+	}
+	if err != nil {
+		return GenerateOutput{}, err
+	}
 
-		// Find the closing </file> tag
-		fileCloseStart := strings.Index(xmlString[fileEnd:], "</file>")
-		if fileCloseStart == -1 {
-			return tldraw, fmt.Errorf("invalid XML: missing </file> tag")
+	if !opts.SkipTypeCheck {
+		messages, err = g.typeCheckUntilClean(genCtx, mode, &out, messages, opts)
+		if err != nil {
+			return GenerateOutput{}, err
 		}
-		fileCloseEnd := fileCloseStart + len("</file>")
-		fileContent := xmlString[fileEnd+1 : fileEnd+fileCloseStart]
+	}
 
-		// Assign content and append to list of files
-		file.Content = fileContent
-		tldraw.Files = append(tldraw.Files, file)
+	out.Diagnostics = g.checkTool(out.TldrawToolOutput)
+	out.Policy = g.scanPolicy("generate", query, out.TldrawToolOutput)
 
-		// Move the cursor forward
-		xmlString = xmlString[fileEnd+fileCloseEnd:]
+	if emit != nil {
+		validation := validateToolOutput(out.TldrawToolOutput)
+		validation.Diagnostics = out.Diagnostics
+		validation.Policy = out.Policy
+		emit(StreamEvent{Type: StreamEventValidation, Data: validation})
 	}
 
-	return tldraw, nil
-}
-
-func parseTldrawToolXML(xmlString string) (TldrawToolOutput, error) {
-	parsedXML, err := customXMLParser(xmlString)
-	if err != nil {
-		return TldrawToolOutput{}, err
+	if out.Policy != nil && out.Policy.Blocked {
+		return out, fmt.Errorf("%w: %s", ErrPolicyBlocked, out.Id)
 	}
 
-	out := TldrawToolOutput{Id: parsedXML.Id}
+	writeCtx, cancel := withStageTimeout(ctx, g.Timeouts.Write)
+	defer cancel()
 
-	for _, file := range parsedXML.Files {
-		if file.Name == "tool.ts" {
-			out.Tool = file.Content
-		}
+	// The store rolls back a failed install by itself, and an installed tool
+	// stays installed even if ctx expires afterwards
+	origin := g.origin(query)
+	if _, err := g.store().Install(writeCtx, out.TldrawToolOutput, newToolEntry(out.TldrawToolOutput, origin)); err != nil {
+		return out, fmt.Errorf("%w %s: %w", ErrWriteFailed, out.Id, err)
+	}
+	g.recordVersion("generate", out.TldrawToolOutput, origin, 0)
 
-		if file.Name == "util.tsx" {
-			out.Util = file.Content
-		}
+	g.saveSession(Session{
+		ToolId:   out.Id,
+		Messages: messages,
+	})
 
-		if file.Name == "icon.svg" {
-			out.Icon = file.Content
-		}
+	if emit != nil {
+		emit(StreamEvent{Type: StreamEventDone, Data: out})
 	}
 
 	return out, nil
 }
 
-type WriteFileResult struct {
-	path string
-	err  error
-}
+func (g *Generator) store() ToolStore {
+	if g.Store == nil {
+		return NewFileToolStore(g.Workspace)
+	}
 
-func writeToolFiles(tool TldrawToolOutput, appPath string) (bool, []error) {
-	errors := []error{}
+	return g.Store
+}
 
-	// Check if appPath is valid
-	if _, err := os.Stat(appPath); err != nil {
-		errors = append(errors, err)
-		return false, errors
+// origin describes how a tool for query is generated, for the registry.
+func (g *Generator) origin(query string) ToolOrigin {
+	origin := ToolOrigin{Query: query, PromptVersion: PromptVersion}
+	if namer, ok := g.Provider.(ModelNamer); ok {
+		origin.Model = namer.ModelName()
 	}
 
-	toolsJSONPath := filepath.Join(appPath, "components/tldraw-custom-tools/tools.json")
-	iconPath := filepath.Join(appPath, "public/custom-tool-icons", fmt.Sprintf("%s.svg", tool.Id))
+	return origin
+}
 
-	toolFolderPath := filepath.Join(appPath, "components/tldraw-custom-tools", tool.Id)
-	if err := ensureDirectoryExists(toolFolderPath); err != nil {
-		errors = append(errors, err)
-		return false, errors
+// generateCandidate asks the model for a tool and repairs the output until it
+// parses. Nothing is written to disk.
+func (g *Generator) generateCandidate(ctx context.Context, query string, mode GenerationMode, emit func(StreamEvent)) (GenerateOutput, []ChatMessage, error) {
+	req := g.newRequest(mode, []ChatMessage{
+		{Role: RoleUser, Content: query},
+	})
+
+	if emit != nil {
+		// The tool event is sent once, with the first id that passes the
+		// policy. An id the model got wrong waits for the repair to fix it.
+		idSent := false
+		next := emit
+		emit = func(event StreamEvent) {
+			if event.Type == StreamEventTool {
+				if idSent {
+					return
+				}
+				idSent = true
+			}
+			next(event)
+		}
+
+		var parser toolXMLStreamParser
+		idChecked := false
+
+		req.OnDelta = func(text string) {
+			emit(StreamEvent{Type: StreamEventDelta, Data: DeltaEventData{Text: text}})
+
+			files := parser.Feed(text)
+			if raw, ok := parser.ToolId(); ok && !idChecked {
+				idChecked = true
+				if id, err := NormalizeToolId(raw); err == nil {
+					emit(StreamEvent{Type: StreamEventTool, Data: ToolEventData{Id: id}})
+				}
+			}
+			for _, file := range files {
+				emit(StreamEvent{Type: StreamEventFile, Data: file})
+			}
+		}
 	}
 
-	toolPath := filepath.Join(toolFolderPath, "tool.ts")
-	utilPath := filepath.Join(toolFolderPath, "util.tsx")
+	resp, err := g.complete(ctx, req)
+	if err != nil {
+		return GenerateOutput{}, nil, err
+	}
 
-	files := []string{toolsJSONPath, toolPath, utilPath, iconPath}
+	log.Println("API Resp", resp.Text)
 
-	// Write to files concurrently and store errors in a channel
-	wg := sync.WaitGroup{}
-	resChan := make(chan WriteFileResult, len(files))
+	return g.repairUntilValid(ctx, mode, req.Messages, resp, emit)
+}
 
-	wg.Add(len(files))
-	go appendToolId(toolsJSONPath, tool.Id, resChan, &wg)
-	go writeToolFile(toolPath, tool.Tool, resChan, &wg)
-	go writeToolFile(utilPath, tool.Util, resChan, &wg)
-	go writeToolFile(iconPath, tool.Icon, resChan, &wg)
-	wg.Wait()
+// emitToolFiles reports the id and every file of a finished tool.
+func emitToolFiles(emit func(StreamEvent), tool TldrawToolOutput) {
+	emit(StreamEvent{Type: StreamEventTool, Data: ToolEventData{Id: tool.Id}})
+	for _, file := range tool.AllFiles() {
+		emit(StreamEvent{Type: StreamEventFile, Data: TldrawXMLFile{Name: file.Name, Content: file.Content}})
+	}
+}
 
-	for range len(files) {
-		writeRes := <-resChan
-		if writeRes.err != nil {
-			errors = append(errors, writeRes.err)
-			log.Println("ERROR:", writeRes.err.Error())
-		}
+// applyCodemods aligns the ids in the sources with the tool id, rewrites the
+// tool's files with g.Codemods and records the changes in out. Disabling the
+// codemods only skips g.Codemods, the ids are always aligned.
+func (g *Generator) applyCodemods(out *GenerateOutput, opts GenerateOptions) {
+	if out.Codemods == nil {
+		out.Codemods = []codemod.Change{}
 	}
 
-	// TODO: undo operations if errors exist
+	changes := fixIdMismatches(&out.TldrawToolOutput)
 
-	close(resChan)
+	if len(g.Codemods) > 0 && !opts.DisableCodemods {
+		files := []codemod.File{}
+		for _, file := range out.AllFiles() {
+			files = append(files, codemod.File{Name: file.Name, Content: file.Content})
+		}
 
-	return true, errors
-}
+		var pipelineChanges []codemod.Change
+		files, pipelineChanges = g.Codemods.Run(files)
+		for _, file := range files {
+			out.setFile(file.Name, file.Content)
+		}
+		changes = append(changes, pipelineChanges...)
+	}
+	out.Codemods = append(out.Codemods, changes...)
 
-func writeToolFile(path, content string, resChan chan WriteFileResult, wg *sync.WaitGroup) {
-	defer wg.Done()
+	for _, change := range changes {
+		log.Printf("Codemod %s changed %s:%d: %s", change.Codemod, change.File, change.Line, change.Description)
+	}
+}
 
-	log.Println("Writing to", path)
+// checkTool reports ids that disagree with the tool id and runs g.Validator
+// over every file of the tool.
+func (g *Generator) checkTool(tool TldrawToolOutput) []validator.Diagnostic {
+	diagnostics := consistencyDiagnostics(tool)
+	if g.Validator == nil {
+		return diagnostics
+	}
 
-	err := os.WriteFile(path, []byte(content), 0644)
-	resChan <- WriteFileResult{path, err}
-	if err == nil {
-		log.Println("Finished writing to", path)
+	files := []validator.File{}
+	for _, file := range tool.AllFiles() {
+		files = append(files, validator.File{Name: file.Name, Content: file.Content})
 	}
+
+	return append(diagnostics, g.Validator.Check(files)...)
 }
 
-type ToolsFileContent struct {
-	Ids []string `json:"ids"`
+// TldrawXML is the intermediate form of a model output. Both the XML and the
+// tool-use generation modes decode into it.
+type TldrawXML struct {
+	Id          string          `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Files       []TldrawXMLFile `json:"files"`
 }
 
-func appendToolId(path, toolId string, resChan chan WriteFileResult, wg *sync.WaitGroup) {
-	defer wg.Done()
+type TldrawXMLFile struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
 
-	log.Printf("Appending Tool ID: %s", toolId)
+func customXMLParser(xmlString string) (TldrawXML, error) {
+	var parser toolXMLStreamParser
+	parser.Feed(xmlString)
 
-	// Read file content as string
-	fileContent, err := os.ReadFile(path)
+	return parser.Finish()
+}
+
+func parseTldrawToolXML(xmlString string) (TldrawToolOutput, error) {
+	parsedXML, err := customXMLParser(xmlString)
 	if err != nil {
-		resChan <- WriteFileResult{path, err}
-		return
+		return TldrawToolOutput{}, err
 	}
 
-	// Parse string as struct
-	var data ToolsFileContent
-	if err := json.Unmarshal(fileContent, &data); err != nil {
-		resChan <- WriteFileResult{path, err}
-		return
+	out := TldrawToolOutput{
+		Id:          parsedXML.Id,
+		Name:        parsedXML.Name,
+		Description: parsedXML.Description,
 	}
 
-	// Prevent duplicates
-	toolIdIndex := sort.SearchStrings(data.Ids, toolId)
-	fmt.Println("data before", data.Ids)
-	fmt.Println(toolIdIndex, len(data.Ids))
-	if toolIdIndex == len(data.Ids) {
-		data.Ids = append(data.Ids, toolId)
+	for _, file := range parsedXML.Files {
+		if field := toolFileField(&out, file.Name); field != nil {
+			*field = file.Content
+		} else if !out.addExtraFile(file.Name, file.Content) {
+			log.Printf("Ignoring file %q of tool %s", file.Name, out.Id)
+		}
 	}
-	fmt.Println("data after", data.Ids)
 
-	// Convert struct to string
-	dataStr, err := json.Marshal(data)
-	if err != nil {
-		resChan <- WriteFileResult{path, err}
-		return
+	return out, nil
+}
+
+type toolPaths struct {
+	ToolsJSON string
+	Folder    string
+	Tool      string
+	Util      string
+	Icon      string
+}
+
+func newToolPaths(workspace config.Workspace, toolId string) toolPaths {
+	toolFolderPath := filepath.Join(workspace.ToolsPath(), toolId)
+
+	return toolPaths{
+		ToolsJSON: filepath.Join(workspace.ToolsPath(), "tools.json"),
+		Folder:    toolFolderPath,
+		Tool:      filepath.Join(toolFolderPath, "tool.ts"),
+		Util:      filepath.Join(toolFolderPath, "util.tsx"),
+		Icon:      filepath.Join(workspace.IconsPath(), fmt.Sprintf("%s.svg", toolId)),
 	}
+}
 
-	// Write new data
-	err = os.WriteFile(path, []byte(dataStr), 0644)
-	resChan <- WriteFileResult{path, err}
-	if err == nil {
-		log.Printf("Finished appending Tool ID: %s", toolId)
+// File returns where a file of the tool is written. Extra files live in the
+// tool folder next to tool.ts.
+func (p toolPaths) File(name string) string {
+	switch name {
+	case "tool.ts":
+		return p.Tool
+	case "util.tsx":
+		return p.Util
+	case "icon.svg":
+		return p.Icon
+	default:
+		return filepath.Join(p.Folder, name)
 	}
 }
 
@@ -1,9 +1,16 @@
 package ai
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+
+	"tlcrazy-backend/internal/config"
 )
 
 const (
@@ -73,3 +80,464 @@ func TestParseTldrawToolRawOutput(t *testing.T) {
 		}
 	})
 }
+
+func TestCustomXMLParser(t *testing.T) {
+	testcases := []struct {
+		name  string
+		input string
+		want  TldrawXML
+	}{
+		{
+			name:  "Single quoted attributes in any order",
+			input: `<tool description='Counts' id='counter'><file data-kind="ts" name='tool.ts'>a</file></tool>`,
+			want:  TldrawXML{Id: "counter", Description: "Counts", Files: []TldrawXMLFile{{Name: "tool.ts", Content: "a"}}},
+		},
+		{
+			name:  "Angle bracket inside an attribute",
+			input: `<tool id="cmp" description="a > b"><file name="tool.ts">a</file></tool>`,
+			want:  TldrawXML{Id: "cmp", Description: "a > b", Files: []TldrawXMLFile{{Name: "tool.ts", Content: "a"}}},
+		},
+		{
+			name:  "Escaped attribute values",
+			input: `<tool id="x" name="Tom &amp; Jerry"><file name="tool.ts">a</file></tool>`,
+			want:  TldrawXML{Id: "x", Name: "Tom & Jerry", Files: []TldrawXMLFile{{Name: "tool.ts", Content: "a"}}},
+		},
+		{
+			name:  "Chatter and code fences around the output",
+			input: "Sure! Here is your tool:\n```xml\n<tool id=\"x\">\n<file name=\"tool.ts\">a</file>\n</tool>\n```\nLet me know if you need <file> changes.",
+			want:  TldrawXML{Id: "x", Files: []TldrawXMLFile{{Name: "tool.ts", Content: "a"}}},
+		},
+		{
+			name:  "Code fence inside a file",
+			input: "<tool id=\"x\"><file name=\"tool.ts\">\n```ts\nconst a = 1\n```\n</file></tool>",
+			want:  TldrawXML{Id: "x", Files: []TldrawXMLFile{{Name: "tool.ts", Content: "\nconst a = 1\n"}}},
+		},
+		{
+			name:  "CDATA content",
+			input: `<tool id="x"><file name="util.tsx"> <![CDATA[const a = "</file>" && 1 < 2]]> </file></tool>`,
+			want:  TldrawXML{Id: "x", Files: []TldrawXMLFile{{Name: "util.tsx", Content: `const a = "</file>" && 1 < 2`}}},
+		},
+		{
+			name:  "Closing tag inside generated code",
+			input: "<tool id=\"x\"><file name=\"util.tsx\">const a = '</file>' // </file> here\n</file>\n<file name=\"tool.ts\">b</file></tool>",
+			want: TldrawXML{Id: "x", Files: []TldrawXMLFile{
+				{Name: "util.tsx", Content: "const a = '</file>' // </file> here\n"},
+				{Name: "tool.ts", Content: "b"},
+			}},
+		},
+		{
+			name:  "Longer tag names are not tools",
+			input: `<toolbar id="nope"></toolbar><tool id="x"><file name="tool.ts">a</file></tool>`,
+			want:  TldrawXML{Id: "x", Files: []TldrawXMLFile{{Name: "tool.ts", Content: "a"}}},
+		},
+		{
+			name:  "Missing closing tool tag",
+			input: `<tool id="x"><file name="tool.ts">a</file>`,
+			want:  TldrawXML{Id: "x", Files: []TldrawXMLFile{{Name: "tool.ts", Content: "a"}}},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := customXMLParser(tc.input)
+			if err != nil {
+				t.Fatal("Got an error but didn't expect one", err)
+			}
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Errorf("Expected %q\nbut got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCustomXMLParserErrors(t *testing.T) {
+	testcases := []struct {
+		name   string
+		input  string
+		msg    string
+		line   int
+		column int
+	}{
+		{
+			name:   "Missing tool tag",
+			input:  "I cannot do that",
+			msg:    "missing <tool> tag",
+			line:   1,
+			column: 17,
+		},
+		{
+			name:   "Unterminated file",
+			input:  "<tool id=\"x\">\n  <file name=\"util.tsx\">\nexport default",
+			msg:    "missing </file> tag",
+			line:   2,
+			column: 3,
+		},
+		{
+			name:   "Unterminated attribute",
+			input:  "<tool id=\"x\">\n<file name=\"util.tsx>oops",
+			msg:    `unterminated value for attribute "name"`,
+			line:   2,
+			column: 12,
+		},
+		{
+			name:   "Unterminated CDATA",
+			input:  "<tool id=\"x\"><file name=\"util.tsx\"><![CDATA[oops",
+			msg:    "unterminated CDATA section",
+			line:   1,
+			column: 36,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := customXMLParser(tc.input)
+
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("Expected a ParseError but got %v", err)
+			}
+			if parseErr.Msg != tc.msg || parseErr.Line != tc.line || parseErr.Column != tc.column {
+				t.Errorf("Expected %q at %d:%d but got %q at %d:%d", tc.msg, tc.line, tc.column, parseErr.Msg, parseErr.Line, parseErr.Column)
+			}
+			if parseErr.Snippet == "" {
+				t.Error("Expected a snippet")
+			}
+		})
+	}
+}
+
+func FuzzCustomXMLParser(f *testing.F) {
+	f.Add(fakeToolOutput, 10)
+	f.Add(`<tool id='x'><file name="a"><![CDATA[</file>]]></file></tool>`, 20)
+	f.Add("```\n<tool id=\"x\"><file name=\"b\">'</file>'</file>\n</tool>", 7)
+
+	f.Fuzz(func(t *testing.T, input string, split int) {
+		full, fullErr := customXMLParser(input)
+
+		// Splitting the input anywhere must not change the result
+		split = min(max(split, 0), len(input))
+		var parser toolXMLStreamParser
+		parser.Feed(input[:split])
+		parser.Feed(input[split:])
+		streamed, streamErr := parser.Finish()
+
+		if (fullErr == nil) != (streamErr == nil) {
+			t.Fatalf("Errors differ: %v vs %v", fullErr, streamErr)
+		}
+		if fullErr == nil && !reflect.DeepEqual(full, streamed) {
+			t.Fatalf("Results differ:\n%q\n%q", full, streamed)
+		}
+	})
+}
+
+func newTestApp(t *testing.T) config.Workspace {
+	t.Helper()
+
+	workspace := config.NewWorkspace(config.DefaultWorkspaceName, t.TempDir())
+	if err := os.MkdirAll(workspace.ToolsPath(), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(workspace.IconsPath(), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workspace.ToolsPath(), "tools.json"), []byte(`{"ids":[]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return workspace
+}
+
+func newTestGenerator(t *testing.T, provider Provider) *Generator {
+	t.Helper()
+
+	generator := NewGenerator(provider)
+	generator.Workspace = newTestApp(t)
+	generator.Sessions = NewSessionStore(t.TempDir())
+	generator.History = NewHistoryStore(t.TempDir())
+	generator.Audit = NewAuditLog(filepath.Join(t.TempDir(), "audit.jsonl"))
+
+	return generator
+}
+
+func TestGenTldrawToolWithFakeProvider(t *testing.T) {
+	provider := NewFakeProvider(fakeToolOutput)
+	generator := newTestGenerator(t, provider)
+	appPath := generator.Workspace.Root
+
+	tool, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{})
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+
+	if tool.Id != "counter" {
+		t.Errorf("Expected id %q but got %q", "counter", tool.Id)
+	}
+
+	requests := provider.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("Expected 1 request but got %d", len(requests))
+	}
+	if requests[0].System != SystemPromptGenTldrawTool {
+		t.Error("Expected the tldraw tool system prompt to be sent")
+	}
+	if got := requests[0].Messages[0].Content; got != "a counter button" {
+		t.Errorf("Expected query to be sent as the user message but got %q", got)
+	}
+
+	for path, want := range map[string]string{
+		"components/tldraw-custom-tools/counter/tool.ts":  tool.Tool,
+		"components/tldraw-custom-tools/counter/util.tsx": tool.Util,
+		"public/custom-tool-icons/counter.svg":            tool.Icon,
+	} {
+		got, err := os.ReadFile(filepath.Join(appPath, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("Unexpected content in %s", path)
+		}
+	}
+
+	manifest, err := NewToolRegistry(filepath.Join(appPath, "components/tldraw-custom-tools/tools.json")).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(manifest.Ids, []string{"counter"}) {
+		t.Errorf("Unexpected tools.json ids %q", manifest.Ids)
+	}
+
+	entry, _ := manifest.Get("counter")
+	if entry.Query != "a counter button" || entry.Model != "fake" || entry.PromptVersion != PromptVersion || entry.Version != 1 {
+		t.Errorf("Unexpected tools.json entry %+v", entry)
+	}
+}
+
+func TestGenTldrawToolWorkspace(t *testing.T) {
+	t.Run("Custom layout", func(t *testing.T) {
+		generator := newTestGenerator(t, NewFakeProvider(fakeToolOutput))
+		generator.Workspace.ToolsDir = "src/tools"
+		generator.Workspace.IconsDir = "static/icons"
+
+		if _, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{}); err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		for _, path := range []string{"src/tools/counter/tool.ts", "src/tools/tools.json", "static/icons/counter.svg"} {
+			if _, err := os.Stat(filepath.Join(generator.Workspace.Root, path)); err != nil {
+				t.Errorf("Expected %s to be written but got %v", path, err)
+			}
+		}
+	})
+
+	t.Run("Write failure", func(t *testing.T) {
+		generator := newTestGenerator(t, NewFakeProvider(fakeToolOutput))
+		if err := os.RemoveAll(generator.Workspace.Root); err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{})
+		if !errors.Is(err, ErrWriteFailed) {
+			t.Fatalf("Expected ErrWriteFailed but got %v", err)
+		}
+		if out.Id != "counter" {
+			t.Errorf("Expected the generated tool with the error but got %+v", out)
+		}
+		if versions, _ := generator.ToolVersions("counter"); len(versions) != 0 {
+			t.Errorf("Expected no version to be recorded but got %+v", versions)
+		}
+	})
+}
+
+func TestToolXMLStreamParser(t *testing.T) {
+	var parser toolXMLStreamParser
+	var names []string
+
+	// Feed one byte at a time to exercise every partial boundary
+	for i := range len(fakeToolOutput) {
+		for _, file := range parser.Feed(fakeToolOutput[i : i+1]) {
+			names = append(names, file.Name)
+		}
+	}
+
+	want := []string{"tool.ts", "util.tsx", "icon.svg"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Expected files %q\nbut got %q", want, names)
+	}
+
+	streamed, err := parser.Finish()
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+
+	parsed, err := customXMLParser(fakeToolOutput)
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+
+	if !reflect.DeepEqual(streamed, parsed) {
+		t.Errorf("Expected streamed result to match full parse\n%q\n%q", streamed, parsed)
+	}
+
+	t.Run("Unterminated file is reported on finish", func(t *testing.T) {
+		var parser toolXMLStreamParser
+		files := parser.Feed(`<tool id="x"><file name="tool.ts">export default`)
+		if len(files) != 0 {
+			t.Errorf("Expected no completed files but got %d", len(files))
+		}
+		if _, err := parser.Finish(); err == nil {
+			t.Error("Expected an error but didn't get one")
+		}
+	})
+}
+
+func TestGenTldrawToolStream(t *testing.T) {
+	generator := newTestGenerator(t, NewFakeProvider(fakeToolOutput))
+
+	var events []StreamEventType
+	var deltas string
+	_, err := generator.GenTldrawToolStream(context.Background(), "a counter button", GenerateOptions{}, func(event StreamEvent) {
+		if event.Type == StreamEventDelta {
+			deltas += event.Data.(DeltaEventData).Text
+			return
+		}
+		events = append(events, event.Type)
+	})
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+
+	if deltas != fakeToolOutput {
+		t.Error("Expected deltas to add up to the full output")
+	}
+
+	want := []StreamEventType{
+		StreamEventTool,
+		StreamEventFile,
+		StreamEventFile,
+		StreamEventFile,
+		StreamEventValidation,
+		StreamEventDone,
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("Expected events %q\nbut got %q", want, events)
+	}
+}
+
+func TestGenTldrawToolDiagnostics(t *testing.T) {
+	bad := strings.Replace(fakeToolOutput, "from 'tldraw'", "from '@tldraw/tldraw'", 1)
+	generator := newTestGenerator(t, NewFakeProvider(fakeToolOutput, bad))
+
+	out, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{})
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+	if len(out.Diagnostics) != 0 {
+		t.Errorf("Expected no diagnostics but got %+v", out.Diagnostics)
+	}
+
+	out, err = generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{DisableCodemods: true})
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+	if len(out.Diagnostics) != 1 || out.Diagnostics[0].Rule != "tldraw-import" || out.Diagnostics[0].File != "tool.ts" {
+		t.Errorf("Expected a tldraw-import diagnostic for tool.ts but got %+v", out.Diagnostics)
+	}
+}
+
+func TestGenTldrawToolCodemods(t *testing.T) {
+	bad := strings.NewReplacer(
+		"from 'tldraw'", "from '@tldraw/tldraw'",
+		"export default class CounterTool", "export class CounterTool",
+	).Replace(fakeToolOutput)
+	generator := newTestGenerator(t, NewFakeProvider(bad))
+
+	out, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{})
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+
+	if len(out.Codemods) < 2 {
+		t.Errorf("Expected the import and default export to be fixed but got %+v", out.Codemods)
+	}
+	if len(out.Diagnostics) != 0 {
+		t.Errorf("Expected no diagnostics after codemods but got %+v", out.Diagnostics)
+	}
+
+	written, err := os.ReadFile(newToolPaths(generator.Workspace, "counter").Tool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(written), "export default CounterTool") {
+		t.Error("Expected the fixed tool.ts to be written")
+	}
+
+	t.Run("Disabled per request", func(t *testing.T) {
+		out, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{DisableCodemods: true})
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		if len(out.Codemods) != 0 || strings.Contains(out.Tool, "export default") {
+			t.Error("Expected the model output to be left as is")
+		}
+	})
+}
+
+func TestSystemPromptExample(t *testing.T) {
+	prompt := SystemPromptGenTldrawTool
+	example := prompt[strings.Index(prompt, "<tool id=") : strings.LastIndex(prompt, "</tool>")+len("</tool>")]
+	generator := newTestGenerator(t, NewFakeProvider(example))
+
+	out, err := generator.GenTldrawTool(context.Background(), "a card that counts clicks", GenerateOptions{})
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+
+	if len(out.Attempts) != 1 || out.FallbackIcon {
+		t.Errorf("Expected the example to be usable as is but got %+v", out.Attempts)
+	}
+	if len(out.Codemods) != 0 || len(out.Diagnostics) != 0 {
+		t.Errorf("Expected no codemods or diagnostics but got %+v %+v", out.Codemods, out.Diagnostics)
+	}
+	if len(out.Files) != 3 {
+		t.Errorf("Expected the 3 imported files but got %+v", out.Files)
+	}
+}
+
+func TestGenTldrawToolStreamToolId(t *testing.T) {
+	tool, err := parseTldrawToolXML(fakeToolOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	onlyId := "<tool id=\"counter\">\n<file name=\"icon.svg\">" + tool.Icon + "</file>\n</tool>"
+
+	for _, tc := range []struct {
+		name      string
+		responses []string
+		wantIds   []string
+	}{
+		{"Normalized", []string{strings.Replace(fakeToolOutput, `id="counter"`, `id="Counter"`, 1)}, []string{"counter"}},
+		{"Held back until repaired", []string{strings.Replace(fakeToolOutput, `id="counter"`, `id="../../app"`, 1), onlyId}, []string{"counter"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			generator := newTestGenerator(t, NewFakeProvider(tc.responses...))
+
+			ids := []string{}
+			var done GenerateOutput
+			_, err := generator.GenTldrawToolStream(context.Background(), "a counter button", GenerateOptions{}, func(event StreamEvent) {
+				switch event.Type {
+				case StreamEventTool:
+					ids = append(ids, event.Data.(ToolEventData).Id)
+				case StreamEventDone:
+					done = event.Data.(GenerateOutput)
+				}
+			})
+			if err != nil {
+				t.Fatal("Got an error but didn't expect one", err)
+			}
+
+			if !reflect.DeepEqual(ids, tc.wantIds) || done.Id != tc.wantIds[0] {
+				t.Errorf("Expected tool events %q for the installed tool %q but got %q", tc.wantIds, done.Id, ids)
+			}
+		})
+	}
+}
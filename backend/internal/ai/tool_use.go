@@ -0,0 +1,119 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"tlcrazy-backend/internal/config"
+)
+
+// GenerationMode selects the output format. See config.GenerationMode.
+type GenerationMode = config.GenerationMode
+
+const (
+	ModeXML     = config.ModeXML
+	ModeToolUse = config.ModeToolUse
+)
+
+// GenerationModes are the modes the generator supports.
+var GenerationModes = config.GenerationModes
+
+const writeToolName = "write_tldraw_tool"
+
+var writeToolSpec = ToolSpec{
+	Name:        writeToolName,
+	Description: "Writes the generated tldraw tool. Call it exactly once with every file of the tool.",
+	InputSchema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"id": {
+			"type": "string",
+			"description": "Unique kebab-case id of the tool, also used as the shape type"
+		},
+		"name": {
+			"type": "string",
+			"description": "Short human readable name of the tool"
+		},
+		"description": {
+			"type": "string",
+			"description": "One sentence describing what the tool does"
+		},
+		"files": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"properties": {
+					"name": {
+						"type": "string",
+						"pattern": ` + jsonString(toolFileNamePattern) + `,
+						"description": "tool.ts, util.tsx, icon.svg, or an extra .ts, .tsx or .css file they import"
+					},
+					"content": {
+						"type": "string",
+						"description": "Full content of the file"
+					}
+				},
+				"required": ["name", "content"]
+			}
+		}
+	},
+	"required": ["id", "files"]
+}`),
+}
+
+func jsonString(s string) string {
+	encoded, _ := json.Marshal(s)
+	return string(encoded)
+}
+
+// decodeOutput turns a model response into the common intermediate format so
+// that both generation modes share everything downstream.
+func decodeOutput(mode GenerationMode, resp CompletionResponse) (TldrawXML, error) {
+	if mode != ModeToolUse {
+		return customXMLParser(resp.Text)
+	}
+
+	for _, call := range resp.ToolCalls {
+		if call.Name != writeToolName {
+			continue
+		}
+
+		var parsed TldrawXML
+		if err := json.Unmarshal(call.Input, &parsed); err != nil {
+			return TldrawXML{}, fmt.Errorf("invalid %s input: %v", writeToolName, err)
+		}
+
+		// Contents get the same cleanup as in XML mode
+		for i := range parsed.Files {
+			parsed.Files[i].Content = stripCodeFence(parsed.Files[i].Content)
+		}
+		return parsed, nil
+	}
+
+	return TldrawXML{}, fmt.Errorf("model did not call the %s tool", writeToolName)
+}
+
+// assistantContent is how a response is replayed in later turns of the
+// conversation. Tool calls are replayed as their JSON input.
+func assistantContent(resp CompletionResponse) string {
+	if len(resp.ToolCalls) > 0 && resp.Text == "" {
+		return string(resp.ToolCalls[0].Input)
+	}
+
+	return nonEmpty(resp.Text)
+}
+
+func (g *Generator) newRequest(mode GenerationMode, messages []ChatMessage) CompletionRequest {
+	req := CompletionRequest{
+		System:   SystemPromptGenTldrawTool,
+		Messages: messages,
+	}
+
+	if mode == ModeToolUse {
+		req.System += SystemPromptToolUseSuffix
+		req.Tools = []ToolSpec{writeToolSpec}
+		req.ToolChoice = writeToolName
+	}
+
+	return req
+}
@@ -0,0 +1,183 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestToolUseMode(t *testing.T) {
+	parsed, err := customXMLParser(fakeToolOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input, err := json.Marshal(parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	toolUseResp := CompletionResponse{
+		ToolCalls:  []ToolCall{{Name: writeToolName, Input: input}},
+		StopReason: StopReasonToolUse,
+	}
+
+	xmlGenerator := newTestGenerator(t, NewFakeProvider(fakeToolOutput))
+	xmlOut, err := xmlGenerator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{Mode: ModeXML})
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+
+	provider := NewFakeProviderWithResponses(toolUseResp)
+	toolGenerator := newTestGenerator(t, provider)
+	toolOut, err := toolGenerator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{Mode: ModeToolUse})
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+
+	if !reflect.DeepEqual(xmlOut.TldrawToolOutput, toolOut.TldrawToolOutput) {
+		t.Errorf("Expected both modes to produce the same tool\n%q\n%q", xmlOut.TldrawToolOutput, toolOut.TldrawToolOutput)
+	}
+
+	xmlPaths := newToolPaths(xmlGenerator.Workspace, "counter")
+	toolPaths := newToolPaths(toolGenerator.Workspace, "counter")
+	for _, pair := range [][2]string{
+		{xmlPaths.Tool, toolPaths.Tool},
+		{xmlPaths.Util, toolPaths.Util},
+		{xmlPaths.Icon, toolPaths.Icon},
+	} {
+		want, _ := os.ReadFile(pair[0])
+		got, _ := os.ReadFile(pair[1])
+		if string(want) != string(got) {
+			t.Errorf("Expected %s to match between modes", pair[1])
+		}
+	}
+
+	xmlManifest, err := NewToolRegistry(xmlPaths.ToolsJSON).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	toolManifest, err := NewToolRegistry(toolPaths.ToolsJSON).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(xmlManifest.Ids, toolManifest.Ids) {
+		t.Errorf("Expected the ids %q\nbut got %q", xmlManifest.Ids, toolManifest.Ids)
+	}
+
+	req := provider.Requests()[0]
+	if req.ToolChoice != writeToolName || len(req.Tools) != 1 || req.Tools[0].Name != writeToolName {
+		t.Errorf("Expected the request to force the %s tool", writeToolName)
+	}
+	if !json.Valid(req.Tools[0].InputSchema) {
+		t.Error("Expected the input schema to be valid JSON")
+	}
+
+	t.Run("Missing tool call is repaired", func(t *testing.T) {
+		provider := NewFakeProviderWithResponses(
+			CompletionResponse{Text: "Here is your tool!", StopReason: StopReasonEndTurn},
+			toolUseResp,
+		)
+		generator := newTestGenerator(t, provider)
+
+		out, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{Mode: ModeToolUse})
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		if len(out.Attempts) != 2 || out.Attempts[0].Error == "" {
+			t.Errorf("Expected a failed attempt followed by a repair but got %+v", out.Attempts)
+		}
+	})
+
+	t.Run("Code fences are stripped", func(t *testing.T) {
+		fenced := parsed
+		fenced.Files = append([]TldrawXMLFile{}, parsed.Files...)
+		for i := range fenced.Files {
+			fenced.Files[i].Content = "```tsx\n" + fenced.Files[i].Content + "\n```"
+		}
+		input, err := json.Marshal(fenced)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		generator := newTestGenerator(t, NewFakeProviderWithResponses(CompletionResponse{
+			ToolCalls:  []ToolCall{{Name: writeToolName, Input: input}},
+			StopReason: StopReasonToolUse,
+		}))
+		out, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{Mode: ModeToolUse})
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		if !reflect.DeepEqual(out.TldrawToolOutput, xmlOut.TldrawToolOutput) {
+			t.Errorf("Expected the fences to be stripped like in XML mode\n%q\n%q", xmlOut.TldrawToolOutput, out.TldrawToolOutput)
+		}
+	})
+
+	t.Run("Extra files", func(t *testing.T) {
+		props := "export const counterProps = {}\n"
+		withProps := parsed
+		withProps.Files = append([]TldrawXMLFile{}, parsed.Files...)
+		for i, file := range withProps.Files {
+			if file.Name == "util.tsx" {
+				withProps.Files[i].Content = "import { counterProps } from './counter-props'\n" + file.Content
+			}
+		}
+		withProps.Files = append(withProps.Files, TldrawXMLFile{Name: "counter-props.ts", Content: props})
+
+		input, err := json.Marshal(withProps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		provider := NewFakeProviderWithResponses(CompletionResponse{
+			ToolCalls:  []ToolCall{{Name: writeToolName, Input: input}},
+			StopReason: StopReasonToolUse,
+		})
+		generator := newTestGenerator(t, provider)
+
+		out, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{Mode: ModeToolUse})
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		if len(out.Attempts) != 1 {
+			t.Errorf("Expected no repair but got %+v", out.Attempts)
+		}
+		want := []ToolFile{{Name: "counter-props.ts", Kind: FileKindProps, Content: props}}
+		if !reflect.DeepEqual(out.Files, want) {
+			t.Errorf("Expected extra files %+v\nbut got %+v", want, out.Files)
+		}
+
+		var schema struct {
+			Properties struct {
+				Files struct {
+					Items struct {
+						Properties struct {
+							Name struct {
+								Pattern string `json:"pattern"`
+							} `json:"name"`
+						} `json:"properties"`
+					} `json:"items"`
+				} `json:"files"`
+			} `json:"properties"`
+		}
+		if err := json.Unmarshal(writeToolSpec.InputSchema, &schema); err != nil {
+			t.Fatal(err)
+		}
+		pattern := regexp.MustCompile(schema.Properties.Files.Items.Properties.Name.Pattern)
+		for name, want := range map[string]bool{"tool.ts": true, "icon.svg": true, "counter-props.ts": true, "styles.css": true, "../evil.ts": false, "icon.png": false} {
+			if pattern.MatchString(name) != want {
+				t.Errorf("Expected the schema to accept %s: %v", name, want)
+			}
+		}
+	})
+
+	t.Run("Unknown mode", func(t *testing.T) {
+		generator := newTestGenerator(t, NewFakeProvider(fakeToolOutput))
+		if _, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{Mode: "yaml"}); err == nil {
+			t.Error("Expected an error but didn't get one")
+		}
+	})
+}
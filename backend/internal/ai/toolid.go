@@ -0,0 +1,107 @@
+package ai
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"tlcrazy-backend/internal/config"
+)
+
+const maxToolIdLength = 48
+
+var toolIdPattern = regexp.MustCompile(`^[a-z][a-z0-9]*(-[a-z0-9]+)*$`)
+
+// reservedToolIds are the ids of tldraw's built-in tools and shapes, which a
+// custom tool would shadow, plus names that clash with files in the tools
+// folder.
+var reservedToolIds = map[string]bool{
+	"select": true, "hand": true, "eraser": true, "draw": true, "highlight": true,
+	"laser": true, "zoom": true, "arrow": true, "line": true, "geo": true,
+	"text": true, "note": true, "frame": true, "embed": true, "bookmark": true,
+	"image": true, "video": true, "group": true, "asset": true,
+	"index": true, "tools": true,
+}
+
+// ValidateToolId checks id against the tool id policy: a lowercase ASCII
+// kebab-case slug of at most maxToolIdLength characters that is not reserved.
+// The returned error wraps ErrInvalidToolId.
+func ValidateToolId(id string) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w %q: %s", ErrInvalidToolId, id, reason)
+	}
+
+	switch {
+	case id == "":
+		return invalid("id is empty")
+	case len(id) > maxToolIdLength:
+		return invalid(fmt.Sprintf("id is longer than %d characters", maxToolIdLength))
+	case !toolIdPattern.MatchString(id):
+		return invalid("id must be lowercase kebab-case using only a-z, 0-9 and '-', starting with a letter")
+	case reservedToolIds[id]:
+		return invalid("id is reserved by tldraw")
+	}
+
+	return nil
+}
+
+// NormalizeToolId turns an id produced by the model into one that follows the
+// tool id policy, fixing only harmless differences like case, surrounding
+// space or underscores. Anything else, including path separators, dots and
+// non-ASCII characters that could pass for ASCII, is rejected rather than
+// rewritten.
+func NormalizeToolId(raw string) (string, error) {
+	id := strings.Trim(raw, " \t\r\n")
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x20 || id[i] >= 0x7f {
+			return "", fmt.Errorf("%w %q: id must be printable ASCII", ErrInvalidToolId, raw)
+		}
+	}
+
+	id = strings.ToLower(id)
+	id = strings.NewReplacer(" ", "-", "_", "-").Replace(id)
+
+	if err := ValidateToolId(id); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// resolveToolPaths validates toolId and returns the tool's paths, making sure
+// each one stays inside its directory in the app.
+func resolveToolPaths(workspace config.Workspace, toolId string) (toolPaths, error) {
+	if err := ValidateToolId(toolId); err != nil {
+		return toolPaths{}, err
+	}
+
+	paths := newToolPaths(workspace, toolId)
+	toolsDir := filepath.Dir(paths.ToolsJSON)
+
+	if err := ensureWithin(toolsDir, paths.Folder); err != nil {
+		return toolPaths{}, err
+	}
+	if err := ensureWithin(workspace.IconsPath(), paths.Icon); err != nil {
+		return toolPaths{}, err
+	}
+
+	// A symlinked tool folder would redirect every write out of the app
+	if info, err := os.Lstat(paths.Folder); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return toolPaths{}, fmt.Errorf("%w %q: tool folder is a symlink", ErrInvalidToolId, toolId)
+	}
+
+	return paths, nil
+}
+
+// ensureWithin returns an error unless path is strictly inside dir.
+func ensureWithin(dir, path string) error {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return fmt.Errorf("path %s is outside %s", path, dir)
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeToolId(t *testing.T) {
+	valid := []struct {
+		raw  string
+		want string
+	}{
+		{"counter", "counter"},
+		{"  Click-Counter\n", "click-counter"},
+		{"click_counter", "click-counter"},
+		{"youtube player 2", "youtube-player-2"},
+	}
+
+	for _, test := range valid {
+		t.Run(test.raw, func(t *testing.T) {
+			got, err := NormalizeToolId(test.raw)
+			if err != nil {
+				t.Fatal("Got an error but didn't expect one", err)
+			}
+			if got != test.want {
+				t.Errorf("Expected %q\nbut got %q", test.want, got)
+			}
+		})
+	}
+
+	invalid := []string{
+		"",
+		"..",
+		"../../app",
+		"counter/../../app",
+		`..\..\app`,
+		"/etc/passwd",
+		`C:\tools`,
+		"counter.ts",
+		"-counter",
+		"counter-",
+		"counter--button",
+		"2counter",
+		"counter\x00",
+		strings.Repeat("a", maxToolIdLength+1),
+		"select",
+		"Draw",
+		"index",
+		// Unicode tricks
+		"cоunter",       // Cyrillic o
+		"ｃｏｕｎｔｅｒ",       // fullwidth letters
+		"counter\u200b", // zero width space
+		"\u202ecounter", // right-to-left override
+		"\u212aey",      // Kelvin sign, lowercases to "k"
+		"..\u2215app",   // division slash
+		"counter\uff0f..",
+	}
+
+	for _, raw := range invalid {
+		t.Run(raw, func(t *testing.T) {
+			got, err := NormalizeToolId(raw)
+			if !errors.Is(err, ErrInvalidToolId) {
+				t.Errorf("Expected ErrInvalidToolId but got %q, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestEnsureWithin(t *testing.T) {
+	dir := filepath.Join("app", "tools")
+
+	if err := ensureWithin(dir, filepath.Join(dir, "counter")); err != nil {
+		t.Error("Got an error but didn't expect one", err)
+	}
+
+	for _, path := range []string{
+		dir,
+		filepath.Join(dir, ".."),
+		filepath.Join(dir, "..", "tools-evil"),
+		filepath.Join(dir, "counter", "..", "..", "x"),
+		"/etc/passwd",
+	} {
+		if err := ensureWithin(dir, path); err == nil {
+			t.Errorf("Expected %q to be rejected", path)
+		}
+	}
+}
+
+func TestInstallRejectsUnsafeIds(t *testing.T) {
+	workspace := newTestApp(t)
+
+	for _, id := range []string{"../../app", "/tmp/evil", "..", "select"} {
+		_, err := NewFileToolStore(workspace).Install(context.Background(), TldrawToolOutput{Id: id, Tool: "x", Util: "x", Icon: "x"}, ToolEntry{})
+		if !errors.Is(err, ErrInvalidToolId) {
+			t.Errorf("Expected %q to be rejected but got %v", id, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(workspace.Root, "app")); !os.IsNotExist(err) {
+		t.Error("Expected nothing to be written outside the tools folder")
+	}
+
+	t.Run("Symlinked tool folder", func(t *testing.T) {
+		outside := t.TempDir()
+		link := newToolPaths(workspace, "linked").Folder
+		if err := os.Symlink(outside, link); err != nil {
+			t.Skip("symlinks not supported", err)
+		}
+
+		if _, err := NewFileToolStore(workspace).Install(context.Background(), TldrawToolOutput{Id: "linked", Tool: "x", Util: "x", Icon: "x"}, ToolEntry{}); err == nil {
+			t.Error("Expected a symlinked tool folder to be rejected")
+		}
+		if _, err := os.Stat(filepath.Join(outside, "tool.ts")); !os.IsNotExist(err) {
+			t.Error("Expected nothing to be written through the symlink")
+		}
+	})
+}
+
+func TestGenTldrawToolRepairsUnsafeId(t *testing.T) {
+	unsafe := strings.Replace(fakeToolOutput, `<tool id="counter"`, `<tool id="../../app"`, 1)
+	if unsafe == fakeToolOutput {
+		t.Fatal("Expected the fake output to have a counter tool tag")
+	}
+
+	provider := NewFakeProvider(unsafe, fakeToolOutput)
+	generator := newTestGenerator(t, provider)
+
+	out, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{})
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+
+	if out.Id != "counter" {
+		t.Errorf("Expected id %q but got %q", "counter", out.Id)
+	}
+	if !strings.Contains(out.Attempts[0].Error, "invalid tool id") {
+		t.Errorf("Expected the id error to be recorded but got %q", out.Attempts[0].Error)
+	}
+	if !strings.Contains(provider.Requests()[1].Messages[2].Content, "the tool id is not allowed") {
+		t.Error("Expected the id error in the repair message")
+	}
+}
@@ -0,0 +1,175 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+// ListToolsOptions filters and pages the installed tools. Query matches the
+// id, name or description, ignoring case.
+type ListToolsOptions struct {
+	Query   string
+	Enabled *bool
+	Offset  int
+	Limit   int
+}
+
+type ToolList struct {
+	Tools  []ToolEntry `json:"tools"`
+	Total  int         `json:"total"`
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+}
+
+// InstalledTool is a tool's manifest entry together with its sources.
+type InstalledTool struct {
+	ToolEntry
+	Files []ToolFile `json:"files"`
+}
+
+// ToolPatch changes the metadata of a tool. Nil fields are left alone, and
+// Order is the new position of the tool in the toolbar.
+type ToolPatch struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Enabled     *bool   `json:"enabled"`
+	Order       *int    `json:"order"`
+}
+
+// ListTools returns the installed tools in toolbar order.
+func (g *Generator) ListTools(ctx context.Context, opts ListToolsOptions) (ToolList, error) {
+	if opts.Offset < 0 || opts.Limit < 0 {
+		return ToolList{}, fmt.Errorf("%w: offset and limit must not be negative", ErrInvalidOptions)
+	}
+	if opts.Limit == 0 {
+		opts.Limit = defaultListLimit
+	}
+	opts.Limit = min(opts.Limit, maxListLimit)
+
+	manifest, err := g.store().Manifest(ctx)
+	if err != nil {
+		return ToolList{}, err
+	}
+
+	query := strings.ToLower(opts.Query)
+	matches := []ToolEntry{}
+	for _, entry := range manifest.Tools {
+		if opts.Enabled != nil && entry.Enabled != *opts.Enabled {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(entry.Id+"\n"+entry.Name+"\n"+entry.Description), query) {
+			continue
+		}
+		matches = append(matches, entry)
+	}
+
+	list := ToolList{Tools: []ToolEntry{}, Total: len(matches), Offset: opts.Offset, Limit: opts.Limit}
+	if opts.Offset < len(matches) {
+		list.Tools = matches[opts.Offset:min(opts.Offset+opts.Limit, len(matches))]
+	}
+
+	return list, nil
+}
+
+// GetTool returns the manifest entry and files of an installed tool. Tools
+// installed before the manifest had entries only have their id.
+func (g *Generator) GetTool(ctx context.Context, toolId string) (InstalledTool, error) {
+	tool, err := g.store().Tool(ctx, toolId)
+	if err != nil {
+		return InstalledTool{}, err
+	}
+
+	manifest, err := g.store().Manifest(ctx)
+	if err != nil {
+		return InstalledTool{}, err
+	}
+
+	entry, ok := manifest.Get(toolId)
+	if !ok {
+		entry = ToolEntry{Id: toolId}
+	}
+
+	return InstalledTool{ToolEntry: entry, Files: tool.AllFiles()}, nil
+}
+
+// ToolFile returns one file of an installed tool, so the server can serve
+// tools to the frontend.
+func (g *Generator) ToolFile(ctx context.Context, toolId, name string) (ToolFile, error) {
+	tool, err := g.store().Tool(ctx, toolId)
+	if err != nil {
+		return ToolFile{}, err
+	}
+
+	for _, file := range tool.AllFiles() {
+		if file.Name == name {
+			return file, nil
+		}
+	}
+
+	return ToolFile{}, fmt.Errorf("%w: %s has no file %s", ErrToolNotFound, toolId, name)
+}
+
+// UpdateTool applies patch to the manifest entry of a tool. The files and the
+// version of the tool stay the same.
+func (g *Generator) UpdateTool(ctx context.Context, toolId string, patch ToolPatch) (ToolEntry, error) {
+	if err := ValidateToolId(toolId); err != nil {
+		return ToolEntry{}, err
+	}
+
+	var updated ToolEntry
+	err := g.store().UpdateManifest(ctx, func(m *ToolManifest) error {
+		for i := range m.Tools {
+			entry := &m.Tools[i]
+			if entry.Id != toolId {
+				continue
+			}
+
+			if patch.Name != nil {
+				entry.Name = *patch.Name
+			}
+			if patch.Description != nil {
+				entry.Description = *patch.Description
+			}
+			if patch.Enabled != nil {
+				entry.Enabled = *patch.Enabled
+			}
+			entry.UpdatedAt = time.Now().UTC()
+
+			if patch.Order != nil {
+				m.move(toolId, *patch.Order)
+			}
+			updated, _ = m.Get(toolId)
+			return nil
+		}
+
+		return ErrToolNotFound
+	})
+
+	return updated, err
+}
+
+// DeleteTool uninstalls a tool. Its history is kept, and a tool generated
+// again with the same id continues its version numbers.
+func (g *Generator) DeleteTool(ctx context.Context, toolId string) error {
+	if err := ValidateToolId(toolId); err != nil {
+		return err
+	}
+
+	writeCtx, cancel := withStageTimeout(ctx, g.Timeouts.Write)
+	defer cancel()
+
+	err := g.store().Remove(writeCtx, toolId)
+	if err != nil && !errors.Is(err, ErrToolNotFound) {
+		return fmt.Errorf("%w %s: %w", ErrWriteFailed, toolId, err)
+	}
+
+	return err
+}
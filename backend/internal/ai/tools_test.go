@@ -0,0 +1,171 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// installTestTools installs the fake tool under each id.
+func installTestTools(t *testing.T, generator *Generator, ids ...string) {
+	t.Helper()
+
+	tool, err := parseTldrawToolXML(fakeToolOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range ids {
+		tool.Id = id
+		tool.Name = strings.ToUpper(id[:1]) + id[1:]
+		if _, err := generator.store().Install(context.Background(), tool, newToolEntry(tool, ToolOrigin{})); err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+	}
+}
+
+func toolIds(entries []ToolEntry) []string {
+	ids := []string{}
+	for _, entry := range entries {
+		ids = append(ids, entry.Id)
+	}
+	return ids
+}
+
+func TestListTools(t *testing.T) {
+	generator := newTestGenerator(t, NewFakeProvider())
+	installTestTools(t, generator, "counter", "timer", "sticker", "stopwatch")
+
+	disabled := false
+	if _, err := generator.UpdateTool(context.Background(), "sticker", ToolPatch{Enabled: &disabled}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		opts  ListToolsOptions
+		ids   []string
+		total int
+	}{
+		{"All", ListToolsOptions{}, []string{"counter", "timer", "sticker", "stopwatch"}, 4},
+		{"Paged", ListToolsOptions{Offset: 1, Limit: 2}, []string{"timer", "sticker"}, 4},
+		{"Past the end", ListToolsOptions{Offset: 10}, []string{}, 4},
+		{"Query", ListToolsOptions{Query: "ST"}, []string{"sticker", "stopwatch"}, 2},
+		{"Enabled", ListToolsOptions{Enabled: &disabled}, []string{"sticker"}, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			list, err := generator.ListTools(context.Background(), test.opts)
+			if err != nil {
+				t.Fatal("Got an error but didn't expect one", err)
+			}
+			if ids := toolIds(list.Tools); !reflect.DeepEqual(ids, test.ids) || list.Total != test.total {
+				t.Errorf("Expected %q of %d\nbut got %q of %d", test.ids, test.total, ids, list.Total)
+			}
+		})
+	}
+
+	if _, err := generator.ListTools(context.Background(), ListToolsOptions{Offset: -1}); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("Expected ErrInvalidOptions but got %v", err)
+	}
+}
+
+func TestGetTool(t *testing.T) {
+	generator := newTestGenerator(t, NewFakeProvider())
+	installTestTools(t, generator, "counter")
+
+	tool, err := generator.GetTool(context.Background(), "counter")
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+	if tool.Name != "Counter" || tool.Version != 1 || len(tool.Files) != 3 {
+		t.Errorf("Unexpected tool %+v", tool)
+	}
+
+	if _, err := generator.GetTool(context.Background(), "missing"); !errors.Is(err, ErrToolNotFound) {
+		t.Errorf("Expected ErrToolNotFound but got %v", err)
+	}
+	if _, err := generator.GetTool(context.Background(), "../etc"); !errors.Is(err, ErrInvalidToolId) {
+		t.Errorf("Expected ErrInvalidToolId but got %v", err)
+	}
+}
+
+func TestUpdateTool(t *testing.T) {
+	generator := newTestGenerator(t, NewFakeProvider())
+	installTestTools(t, generator, "counter", "timer", "sticker")
+
+	name, disabled, first := "Click counter", false, 0
+	entry, err := generator.UpdateTool(context.Background(), "sticker", ToolPatch{Name: &name, Enabled: &disabled, Order: &first})
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+	if entry.Name != name || entry.Enabled || entry.Order != 0 || entry.Version != 1 {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+
+	manifest, err := generator.store().Manifest(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := toolIds(manifest.Tools); !reflect.DeepEqual(ids, []string{"sticker", "counter", "timer"}) {
+		t.Errorf("Expected sticker to move first but got %q", ids)
+	}
+	if !reflect.DeepEqual(manifest.Ids, []string{"counter", "timer"}) {
+		t.Errorf("Expected disabled tools to be left out of ids but got %q", manifest.Ids)
+	}
+
+	if _, err := generator.UpdateTool(context.Background(), "missing", ToolPatch{Name: &name}); !errors.Is(err, ErrToolNotFound) {
+		t.Errorf("Expected ErrToolNotFound but got %v", err)
+	}
+}
+
+func TestDeleteTool(t *testing.T) {
+	t.Run("Removes files and entry", func(t *testing.T) {
+		generator := newTestGenerator(t, NewFakeProvider())
+		installTestTools(t, generator, "counter", "timer")
+		paths := newToolPaths(generator.Workspace, "counter")
+
+		if err := generator.DeleteTool(context.Background(), "counter"); err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		for _, path := range []string{paths.Folder, paths.Icon} {
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("Expected %s to be removed", path)
+			}
+		}
+		manifest, err := generator.store().Manifest(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(manifest.Ids, []string{"timer"}) {
+			t.Errorf("Expected only timer to be left but got %q", manifest.Ids)
+		}
+
+		if err := generator.DeleteTool(context.Background(), "counter"); !errors.Is(err, ErrToolNotFound) {
+			t.Errorf("Expected ErrToolNotFound but got %v", err)
+		}
+	})
+
+	for _, step := range []installStep{installFolder, installIcon, installManifest} {
+		t.Run("Restores after "+string(step)+" fails", func(t *testing.T) {
+			generator := newTestGenerator(t, NewFakeProvider())
+			installTestTools(t, generator, "counter")
+			before := readInstall(t, generator.Workspace)
+
+			injected := errors.New("injected")
+			generator.Store = &FileToolStore{Workspace: generator.Workspace, fault: failAt(step, injected)}
+
+			if err := generator.DeleteTool(context.Background(), "counter"); !errors.Is(err, injected) {
+				t.Fatalf("Expected the injected error but got %v", err)
+			}
+			if after := readInstall(t, generator.Workspace); !reflect.DeepEqual(after, before) {
+				t.Errorf("Expected the tool to be restored but got %v", after)
+			}
+		})
+	}
+}
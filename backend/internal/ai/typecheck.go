@@ -0,0 +1,99 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"tlcrazy-backend/internal/typecheck"
+)
+
+const defaultMaxTypeFixes = 2
+
+type TypeCheckResult struct {
+	// Skipped explains why the tool was not compiled, for example when Node
+	// is not installed.
+	Skipped     string                 `json:"skipped,omitempty"`
+	Diagnostics []typecheck.Diagnostic `json:"diagnostics"`
+	Fixes       int                    `json:"fixes"`
+
+	// FixErrors are the fix responses that could not be parsed. Each one
+	// counts as a fix attempt.
+	FixErrors []string `json:"fixErrors,omitempty"`
+}
+
+// typeCheckUntilClean compiles the tool and, while it has type errors, asks
+// the model to fix them. A fix that cannot be parsed uses up an attempt like
+// any other. Compiler problems skip the check instead of failing the
+// generation.
+func (g *Generator) typeCheckUntilClean(ctx context.Context, mode GenerationMode, out *GenerateOutput, messages []ChatMessage, opts GenerateOptions) ([]ChatMessage, error) {
+	if g.TypeChecker == nil {
+		return messages, nil
+	}
+
+	result := &TypeCheckResult{Diagnostics: []typecheck.Diagnostic{}}
+	out.TypeCheck = result
+
+	for {
+		files := []typecheck.File{}
+		for _, file := range out.AllFiles() {
+			files = append(files, typecheck.File{Name: file.Name, Content: file.Content})
+		}
+
+		diagnostics, err := g.TypeChecker.Check(ctx, out.Id, files)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return messages, ctxErr
+			}
+			if !errors.Is(err, typecheck.ErrUnavailable) {
+				log.Printf("Error type checking %s: %s", out.Id, err)
+			}
+			result.Skipped = err.Error()
+			return messages, nil
+		}
+		result.Diagnostics = diagnostics
+
+		typeErrors := []string{}
+		for _, d := range diagnostics {
+			if d.Severity == "error" {
+				typeErrors = append(typeErrors, "- "+d.String())
+			}
+		}
+		if len(typeErrors) == 0 || result.Fixes >= g.MaxTypeFixes {
+			return messages, nil
+		}
+
+		log.Printf("Fixing %d type errors in %s (attempt %d)", len(typeErrors), out.Id, result.Fixes+1)
+
+		messages = append(messages, ChatMessage{
+			Role:    RoleUser,
+			Content: fmt.Sprintf(PromptFixTypeErrors, out.Id, strings.Join(typeErrors, "\n")),
+		})
+
+		resp, err := g.complete(ctx, g.newRequest(mode, messages))
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, ChatMessage{Role: RoleAssistant, Content: assistantContent(resp)})
+		result.Fixes++
+
+		parsed, err := decodeOutput(mode, resp)
+		if err != nil {
+			log.Printf("Error parsing type fix for %s: %s", out.Id, err)
+			result.FixErrors = append(result.FixErrors, err.Error())
+			continue
+		}
+
+		for _, file := range parsed.Files {
+			if file.Name == "icon.svg" {
+				continue
+			}
+			if !out.setFile(file.Name, file.Content) {
+				log.Printf("Ignoring file %q of tool %s", file.Name, out.Id)
+			}
+		}
+		g.applyCodemods(out, opts)
+	}
+}
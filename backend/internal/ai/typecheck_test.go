@@ -0,0 +1,132 @@
+package ai
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tlcrazy-backend/internal/typecheck"
+)
+
+func TestTypeCheckFeedback(t *testing.T) {
+	tool, err := parseTldrawToolXML(fakeToolOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broken := strings.Replace(fakeToolOutput, "count: 0", "count: 'BROKEN'", 1)
+	if broken == fakeToolOutput {
+		t.Fatal("Expected the fake output to have a count prop")
+	}
+	fixed := "<tool id=\"counter\">\n<file name=\"util.tsx\">" + tool.Util + "</file>\n</tool>"
+
+	script := filepath.Join(t.TempDir(), "tsc.sh")
+	err = os.WriteFile(script, []byte(`
+if grep -q BROKEN components/tldraw-custom-tools/counter/util.tsx; then
+	echo "components/tldraw-custom-tools/counter/util.tsx(5,3): error TS2322: Type 'string' is not assignable to type 'number'."
+	exit 2
+fi
+`), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newGenerator := func(provider Provider) *Generator {
+		generator := newTestGenerator(t, provider)
+		generator.TypeChecker = typecheck.NewChecker(generator.Workspace.Root)
+		generator.TypeChecker.Command = []string{"sh", script}
+		return generator
+	}
+
+	t.Run("Feeds type errors back to the model", func(t *testing.T) {
+		provider := NewFakeProvider(broken, fixed)
+		generator := newGenerator(provider)
+
+		out, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{})
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		if out.Util != tool.Util {
+			t.Error("Expected the fixed util.tsx to be used")
+		}
+		if out.TypeCheck == nil || out.TypeCheck.Fixes != 1 || len(out.TypeCheck.Diagnostics) != 0 {
+			t.Errorf("Expected one fix and a clean check but got %+v", out.TypeCheck)
+		}
+
+		fixReq := provider.Requests()[1]
+		if !strings.Contains(fixReq.Messages[len(fixReq.Messages)-1].Content, "util.tsx(5,3): error TS2322") {
+			t.Error("Expected the compiler error in the fix message")
+		}
+
+		written, err := os.ReadFile(newToolPaths(generator.Workspace, "counter").Util)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(written) != tool.Util {
+			t.Error("Expected only the fixed util.tsx to be written")
+		}
+	})
+
+	t.Run("Gives up after the fix budget", func(t *testing.T) {
+		provider := NewFakeProvider(broken)
+		generator := newGenerator(provider)
+		generator.MaxTypeFixes = 1
+
+		out, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{})
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		if out.TypeCheck.Fixes != 1 || len(out.TypeCheck.Diagnostics) != 1 {
+			t.Errorf("Expected the remaining error to be reported but got %+v", out.TypeCheck)
+		}
+	})
+
+	t.Run("Retries an unparsable fix", func(t *testing.T) {
+		provider := NewFakeProvider(broken, "Sorry, I can't help with that.", fixed)
+		generator := newGenerator(provider)
+
+		out, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{})
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		if out.Util != tool.Util || out.TypeCheck.Fixes != 2 || len(out.TypeCheck.Diagnostics) != 0 {
+			t.Errorf("Expected the second fix to be used but got %+v", out.TypeCheck)
+		}
+		if len(out.TypeCheck.FixErrors) != 1 {
+			t.Errorf("Expected the unparsable fix to be recorded but got %q", out.TypeCheck.FixErrors)
+		}
+	})
+
+	t.Run("Skipped without a compiler", func(t *testing.T) {
+		provider := NewFakeProvider(broken)
+		generator := newTestGenerator(t, provider)
+		generator.TypeChecker = typecheck.NewChecker(generator.Workspace.Root)
+
+		out, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{})
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		if out.TypeCheck == nil || !strings.Contains(out.TypeCheck.Skipped, "unavailable") {
+			t.Errorf("Expected the check to be skipped but got %+v", out.TypeCheck)
+		}
+		if len(provider.Requests()) != 1 {
+			t.Error("Expected no fix requests")
+		}
+	})
+
+	t.Run("Skipped per request", func(t *testing.T) {
+		generator := newGenerator(NewFakeProvider(broken))
+
+		out, err := generator.GenTldrawTool(context.Background(), "a counter button", GenerateOptions{SkipTypeCheck: true})
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		if out.TypeCheck != nil {
+			t.Errorf("Expected no type check but got %+v", out.TypeCheck)
+		}
+	})
+}
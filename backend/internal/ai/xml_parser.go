@@ -0,0 +1,389 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseError is returned for model output that does not follow the
+// <tool>/<file> format. Line and Column are 1-based.
+type ParseError struct {
+	Msg     string
+	Line    int
+	Column  int
+	Snippet string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid XML at line %d, column %d: %s (near %q)", e.Line, e.Column, e.Msg, e.Snippet)
+}
+
+func newParseError(input string, offset int, msg string) *ParseError {
+	offset = min(max(offset, 0), len(input))
+
+	lineStart := strings.LastIndex(input[:offset], "\n") + 1
+	lineEnd := strings.Index(input[offset:], "\n")
+	if lineEnd == -1 {
+		lineEnd = len(input)
+	} else {
+		lineEnd += offset
+	}
+
+	snippet := strings.TrimSpace(input[lineStart:lineEnd])
+	if len(snippet) > 80 {
+		snippet = snippet[:77] + "..."
+	}
+
+	return &ParseError{
+		Msg:     msg,
+		Line:    strings.Count(input[:offset], "\n") + 1,
+		Column:  len([]rune(input[lineStart:offset])) + 1,
+		Snippet: snippet,
+	}
+}
+
+// toolXMLStreamParser incrementally parses the <tool>/<file> output format.
+// Input can be fed in arbitrary chunks, and each <file> is returned as soon as
+// its closing tag has arrived. Anything before <tool> and after </tool>, such
+// as chatter or markdown code fences, is ignored.
+type toolXMLStreamParser struct {
+	buf     strings.Builder
+	pos     int
+	toolTag bool
+	done    bool
+	err     error
+	result  TldrawXML
+}
+
+// Feed appends a chunk of model output and returns the files completed by it.
+// Errors are held back until Finish, since more input may still fix them.
+func (p *toolXMLStreamParser) Feed(chunk string) []TldrawXMLFile {
+	p.buf.WriteString(chunk)
+	return p.scan(false)
+}
+
+// ToolId returns the tool id once the opening <tool> tag has been seen.
+func (p *toolXMLStreamParser) ToolId() (string, bool) {
+	return p.result.Id, p.toolTag
+}
+
+// Finish parses whatever is left, treating the end of input as final.
+func (p *toolXMLStreamParser) Finish() (TldrawXML, error) {
+	p.scan(true)
+
+	if p.err != nil {
+		return p.result, p.err
+	}
+	if !p.toolTag {
+		return p.result, newParseError(p.buf.String(), p.buf.Len(), "missing <tool> tag")
+	}
+
+	return p.result, nil
+}
+
+type scanStatus int
+
+const (
+	scanOk scanStatus = iota
+	scanNeedMore
+	scanEnd
+)
+
+func (p *toolXMLStreamParser) scan(eof bool) []TldrawXMLFile {
+	if p.done || p.err != nil {
+		return nil
+	}
+
+	input := p.buf.String()
+
+	if !p.toolTag {
+		start := findTag(input, p.pos, "tool")
+		if start == -1 {
+			return nil
+		}
+
+		tag, end, status, err := parseTag(input, start, eof)
+		if err != nil {
+			p.err = err
+			return nil
+		}
+		if status == scanNeedMore {
+			return nil
+		}
+
+		p.result.Id = tag.attrs["id"]
+		p.result.Name = tag.attrs["name"]
+		p.result.Description = tag.attrs["description"]
+		p.toolTag = true
+		p.pos = end
+
+		if tag.selfClosing {
+			p.done = true
+			return nil
+		}
+	}
+
+	var files []TldrawXMLFile
+	for {
+		file, next, status, err := scanFile(input, p.pos, eof)
+		if err != nil {
+			p.err = err
+			break
+		}
+		if status == scanEnd {
+			p.done = eof || next != -1
+			break
+		}
+		if status == scanNeedMore {
+			break
+		}
+
+		files = append(files, file)
+		p.result.Files = append(p.result.Files, file)
+		p.pos = next
+	}
+
+	return files
+}
+
+// scanFile reads the next <file> starting at pos. It returns scanEnd with next
+// set to the end of </tool> when the tool closes, or -1 when input runs out.
+func scanFile(input string, pos int, eof bool) (TldrawXMLFile, int, scanStatus, error) {
+	fileStart := findTag(input, pos, "file")
+	toolClose := strings.Index(input[pos:], "</tool>")
+	if toolClose != -1 && (fileStart == -1 || pos+toolClose < fileStart) {
+		return TldrawXMLFile{}, pos + toolClose + len("</tool>"), scanEnd, nil
+	}
+	if fileStart == -1 {
+		if eof {
+			return TldrawXMLFile{}, -1, scanEnd, nil
+		}
+		return TldrawXMLFile{}, -1, scanNeedMore, nil
+	}
+
+	tag, contentStart, status, err := parseTag(input, fileStart, eof)
+	if err != nil || status == scanNeedMore {
+		return TldrawXMLFile{}, 0, status, err
+	}
+
+	file := TldrawXMLFile{Name: tag.attrs["name"]}
+	if tag.selfClosing {
+		return file, contentStart, scanOk, nil
+	}
+
+	// Optional CDATA section around the whole content
+	trimmed := strings.TrimLeft(input[contentStart:], " \t\r\n")
+	cdataStart := len(input) - len(trimmed)
+	if !eof && len(trimmed) < len("<![CDATA[") && strings.HasPrefix("<![CDATA[", trimmed) {
+		return TldrawXMLFile{}, 0, scanNeedMore, nil
+	}
+	if strings.HasPrefix(trimmed, "<![CDATA[") {
+		dataStart := cdataStart + len("<![CDATA[")
+		dataEnd := strings.Index(input[dataStart:], "]]>")
+		if dataEnd == -1 {
+			if eof {
+				return TldrawXMLFile{}, 0, scanOk, newParseError(input, cdataStart, "unterminated CDATA section")
+			}
+			return TldrawXMLFile{}, 0, scanNeedMore, nil
+		}
+		dataEnd += dataStart
+
+		rest := strings.TrimLeft(input[dataEnd+len("]]>"):], " \t\r\n")
+		if !strings.HasPrefix(rest, "</file>") {
+			if !eof && strings.HasPrefix("</file>", rest) {
+				return TldrawXMLFile{}, 0, scanNeedMore, nil
+			}
+			return TldrawXMLFile{}, 0, scanOk, newParseError(input, len(input)-len(rest), "missing </file> tag after CDATA section")
+		}
+
+		file.Content = input[dataStart:dataEnd]
+		return file, len(input) - len(rest) + len("</file>"), scanOk, nil
+	}
+
+	contentEnd, status := findFileClose(input, contentStart, eof)
+	if status == scanNeedMore {
+		return TldrawXMLFile{}, 0, scanNeedMore, nil
+	}
+	if contentEnd == -1 {
+		return TldrawXMLFile{}, 0, scanOk, newParseError(input, fileStart, "missing </file> tag")
+	}
+
+	file.Content = stripCodeFence(input[contentStart:contentEnd])
+	return file, contentEnd + len("</file>"), scanOk, nil
+}
+
+// findFileClose finds the </file> that really closes a file. Generated code
+// can contain "</file>" in strings or comments, so a candidate only counts if
+// it is followed by another <file>, </tool>, a code fence or the end of input.
+// If no candidate qualifies the last one is used.
+func findFileClose(input string, contentStart int, eof bool) (int, scanStatus) {
+	last := -1
+	searchFrom := contentStart
+
+	for {
+		idx := strings.Index(input[searchFrom:], "</file>")
+		if idx == -1 {
+			break
+		}
+		idx += searchFrom
+		last = idx
+
+		rest := strings.TrimLeft(input[idx+len("</file>"):], " \t\r\n")
+		if rest == "" {
+			if eof {
+				return idx, scanOk
+			}
+			return -1, scanNeedMore
+		}
+
+		for _, follow := range []string{"<file", "</tool>", "```"} {
+			if strings.HasPrefix(rest, follow) {
+				return idx, scanOk
+			}
+			if !eof && len(rest) < len(follow) && strings.HasPrefix(follow, rest) {
+				return -1, scanNeedMore
+			}
+		}
+
+		searchFrom = idx + len("</file>")
+	}
+
+	if !eof {
+		return -1, scanNeedMore
+	}
+
+	return last, scanOk
+}
+
+// stripCodeFence removes a markdown code fence wrapping the whole content.
+func stripCodeFence(content string) string {
+	trimmed := strings.TrimSpace(content)
+	if !strings.HasPrefix(trimmed, "```") || !strings.HasSuffix(trimmed, "```") || len(trimmed) < 6 {
+		return content
+	}
+
+	firstNewline := strings.Index(trimmed, "\n")
+	if firstNewline == -1 {
+		return content
+	}
+
+	return "\n" + strings.TrimSpace(trimmed[firstNewline:len(trimmed)-3]) + "\n"
+}
+
+type xmlTag struct {
+	name        string
+	attrs       map[string]string
+	selfClosing bool
+}
+
+// findTag returns the offset of the next <name tag at or after pos, skipping
+// longer names like <toolbar, or -1.
+func findTag(input string, pos int, name string) int {
+	open := "<" + name
+	for {
+		idx := strings.Index(input[pos:], open)
+		if idx == -1 {
+			return -1
+		}
+		idx += pos
+
+		after := idx + len(open)
+		if after == len(input) || strings.ContainsRune(" \t\r\n/>", rune(input[after])) {
+			return idx
+		}
+		pos = after
+	}
+}
+
+// parseTag reads the tag starting at start and returns it with the offset just
+// past its closing '>'. Attribute values may use single or double quotes, so a
+// '>' inside a value does not end the tag.
+func parseTag(input string, start int, eof bool) (xmlTag, int, scanStatus, error) {
+	i := start + 1
+	for i < len(input) && !isTagSpace(input[i]) && input[i] != '>' && input[i] != '/' {
+		i++
+	}
+	tag := xmlTag{name: input[start+1 : i], attrs: map[string]string{}}
+
+	needMore := func() (xmlTag, int, scanStatus, error) {
+		if eof {
+			return xmlTag{}, 0, scanOk, newParseError(input, start, fmt.Sprintf("malformed <%s> tag", tag.name))
+		}
+		return xmlTag{}, 0, scanNeedMore, nil
+	}
+
+	for {
+		for i < len(input) && isTagSpace(input[i]) {
+			i++
+		}
+		if i >= len(input) {
+			return needMore()
+		}
+
+		switch {
+		case input[i] == '>':
+			return tag, i + 1, scanOk, nil
+		case strings.HasPrefix(input[i:], "/>"):
+			tag.selfClosing = true
+			return tag, i + 2, scanOk, nil
+		case input[i] == '/':
+			if i+1 >= len(input) {
+				return needMore()
+			}
+			return xmlTag{}, 0, scanOk, newParseError(input, i, fmt.Sprintf("unexpected '/' in <%s> tag", tag.name))
+		}
+
+		nameStart := i
+		for i < len(input) && !isTagSpace(input[i]) && !strings.ContainsRune("=>/", rune(input[i])) {
+			i++
+		}
+		attrName := input[nameStart:i]
+
+		for i < len(input) && isTagSpace(input[i]) {
+			i++
+		}
+		if i >= len(input) {
+			return needMore()
+		}
+		if input[i] != '=' {
+			// Attribute without a value
+			tag.attrs[attrName] = ""
+			continue
+		}
+		i++
+
+		for i < len(input) && isTagSpace(input[i]) {
+			i++
+		}
+		if i >= len(input) {
+			return needMore()
+		}
+
+		var value string
+		if quote := input[i]; quote == '"' || quote == '\'' {
+			end := strings.IndexByte(input[i+1:], quote)
+			if end == -1 {
+				if eof {
+					return xmlTag{}, 0, scanOk, newParseError(input, i, fmt.Sprintf("unterminated value for attribute %q", attrName))
+				}
+				return xmlTag{}, 0, scanNeedMore, nil
+			}
+			value = input[i+1 : i+1+end]
+			i += end + 2
+		} else {
+			valueStart := i
+			for i < len(input) && !isTagSpace(input[i]) && input[i] != '>' {
+				i++
+			}
+			value = input[valueStart:i]
+		}
+
+		tag.attrs[attrName] = xmlUnescaper.Replace(value)
+	}
+}
+
+var xmlUnescaper = strings.NewReplacer("&quot;", `"`, "&apos;", "'", "&lt;", "<", "&gt;", ">", "&amp;", "&")
+
+func isTagSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
@@ -0,0 +1,266 @@
+// Package codemod mechanically fixes common mistakes in generated tool code.
+// Every codemod is a safe rewrite: it only changes code when the intent is
+// unambiguous, and it reports each change it makes.
+package codemod
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+type File struct {
+	Name    string
+	Content string
+}
+
+// Change describes one rewrite. Line is 1-based and refers to the file as it
+// was before the codemod ran.
+type Change struct {
+	Codemod     string `json:"codemod"`
+	File        string `json:"file"`
+	Line        int    `json:"line"`
+	Description string `json:"description"`
+}
+
+type Codemod struct {
+	Id string
+	// Files are path.Match patterns of the file names the codemod applies to.
+	Files []string
+	Apply func(name, src string) (string, []Change)
+}
+
+// Pipeline runs codemods in order, each one seeing the output of the last.
+type Pipeline []Codemod
+
+// Default returns the codemods for the rules in the system prompt.
+func Default() Pipeline {
+	return Pipeline{
+		{Id: "tldraw-import", Files: []string{"*.ts", "*.tsx"}, Apply: fixTldrawImport},
+		{Id: "default-export", Files: []string{"tool.ts", "util.tsx"}, Apply: addDefaultExport},
+		{Id: "pointer-events", Files: []string{"util.tsx"}, Apply: addPointerEvents},
+	}
+}
+
+// Run applies the pipeline to files and returns the rewritten files along with
+// every change made.
+func (p Pipeline) Run(files []File) ([]File, []Change) {
+	out := make([]File, len(files))
+	copy(out, files)
+	changes := []Change{}
+
+	for _, codemod := range p {
+		for i, file := range out {
+			if !matchesAny(codemod.Files, file.Name) {
+				continue
+			}
+
+			content, fileChanges := codemod.Apply(file.Name, file.Content)
+			for _, change := range fileChanges {
+				change.Codemod = codemod.Id
+				change.File = file.Name
+				changes = append(changes, change)
+			}
+			out[i].Content = content
+		}
+	}
+
+	return out, changes
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func lineAt(src string, offset int) int {
+	return strings.Count(src[:offset], "\n") + 1
+}
+
+var tldrawImportPattern = regexp.MustCompile(`(['"])@tldraw/tldraw(/[^'"]*)?(['"])`)
+
+var importContextPattern = regexp.MustCompile(`(\bfrom|\bimport\(?|\brequire\()\s*$`)
+
+// fixTldrawImport points imports of the old @tldraw/tldraw package at tldraw.
+func fixTldrawImport(name, src string) (string, []Change) {
+	changes := []Change{}
+	var b strings.Builder
+	last := 0
+
+	for _, m := range tldrawImportPattern.FindAllStringSubmatchIndex(src, -1) {
+		if src[m[2]:m[3]] != src[m[6]:m[7]] || !importContextPattern.MatchString(src[:m[0]]) {
+			continue
+		}
+
+		b.WriteString(src[last:m[0]])
+		b.WriteString(src[m[2]:m[3]] + "tldraw")
+		if m[4] != -1 {
+			b.WriteString(src[m[4]:m[5]])
+		}
+		b.WriteString(src[m[6]:m[7]])
+		last = m[1]
+
+		changes = append(changes, Change{
+			Line:        lineAt(src, m[0]),
+			Description: `replaced "@tldraw/tldraw" import with "tldraw"`,
+		})
+	}
+	b.WriteString(src[last:])
+
+	return b.String(), changes
+}
+
+var (
+	defaultExportPattern = regexp.MustCompile(`\bexport\s+default\s`)
+	classPattern         = regexp.MustCompile(`(?m)^(export\s+)?class\s+(\w+)(?:<[^>{]*>)?\s+extends\s+(\w+)`)
+)
+
+// addDefaultExport adds `export default X` when a file has no default export
+// but exactly one class that looks like the tool or shape util. The change is
+// reported on the line of the class.
+func addDefaultExport(name, src string) (string, []Change) {
+	if defaultExportPattern.MatchString(src) {
+		return src, nil
+	}
+
+	suffixes := []string{"Tool", "StateNode"}
+	if name == "util.tsx" {
+		suffixes = []string{"Util"}
+	}
+
+	var classes []string
+	line := 0
+	for _, m := range classPattern.FindAllStringSubmatchIndex(src, -1) {
+		for _, suffix := range suffixes {
+			if strings.HasSuffix(src[m[6]:m[7]], suffix) {
+				classes = append(classes, src[m[4]:m[5]])
+				line = lineAt(src, m[0])
+				break
+			}
+		}
+	}
+	if len(classes) != 1 {
+		return src, nil
+	}
+
+	if !strings.HasSuffix(src, "\n") {
+		src += "\n"
+	}
+	src += fmt.Sprintf("\nexport default %s\n", classes[0])
+
+	return src, []Change{{
+		Line:        line,
+		Description: fmt.Sprintf("added default export for %s", classes[0]),
+	}}
+}
+
+var pointerEventsPattern = regexp.MustCompile(`pointerEvents\s*:`)
+
+// addPointerEvents sets pointerEvents: 'all' on every HTMLContainer when the
+// file does not set pointerEvents anywhere.
+func addPointerEvents(name, src string) (string, []Change) {
+	if pointerEventsPattern.MatchString(src) {
+		return src, nil
+	}
+
+	const tag = "<HTMLContainer"
+	changes := []Change{}
+	var b strings.Builder
+	last := 0
+
+	for pos := 0; ; {
+		idx := strings.Index(src[pos:], tag)
+		if idx == -1 {
+			break
+		}
+		start := pos + idx
+		pos = start + len(tag)
+
+		if pos < len(src) && !strings.ContainsRune(" \t\r\n/>", rune(src[pos])) {
+			continue
+		}
+
+		end := openingTagEnd(src, pos)
+		if end == -1 {
+			break
+		}
+
+		var insertAt int
+		var insert string
+		if style := topLevelIndex(src[pos:end], "style={{"); style != -1 {
+			insertAt = pos + style + len("style={{")
+			insert = " pointerEvents: 'all',"
+		} else if topLevelIndex(src[pos:end], "style=") != -1 {
+			// A style object from a variable is left alone
+			continue
+		} else {
+			insertAt = pos
+			insert = " style={{ pointerEvents: 'all' }}"
+		}
+
+		b.WriteString(src[last:insertAt])
+		b.WriteString(insert)
+		last = insertAt
+
+		changes = append(changes, Change{
+			Line:        lineAt(src, start),
+			Description: `set pointerEvents to "all" on HTMLContainer`,
+		})
+		pos = end
+	}
+	b.WriteString(src[last:])
+
+	return b.String(), changes
+}
+
+// openingTagEnd returns the offset of the '>' that ends the JSX opening tag
+// whose attributes start at pos, skipping '>' inside braces and strings.
+func openingTagEnd(src string, pos int) int {
+	depth := 0
+	var quote byte
+
+	for i := pos; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+		case c == '>' && depth == 0:
+			return i
+		}
+	}
+
+	return -1
+}
+
+// topLevelIndex finds substr in the attributes of a JSX tag outside any
+// braces, or returns -1.
+func topLevelIndex(attrs, substr string) int {
+	depth := 0
+	for i := 0; i < len(attrs); i++ {
+		if depth == 0 && strings.HasPrefix(attrs[i:], substr) {
+			return i
+		}
+		switch attrs[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,134 @@
+package codemod
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFixTldrawImport(t *testing.T) {
+	src := "import { ShapeUtil } from '@tldraw/tldraw'\nimport \"@tldraw/tldraw/tldraw.css\"\nconst x = '@tldraw/tldraw'\n"
+	want := "import { ShapeUtil } from 'tldraw'\nimport \"tldraw/tldraw.css\"\nconst x = '@tldraw/tldraw'\n"
+
+	got, changes := fixTldrawImport("util.tsx", src)
+	if got != want {
+		t.Errorf("Expected %q\nbut got %q", want, got)
+	}
+	if len(changes) != 2 || changes[0].Line != 1 || changes[1].Line != 2 {
+		t.Errorf("Expected changes on lines 1 and 2 but got %+v", changes)
+	}
+}
+
+func TestAddDefaultExport(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		src  string
+		want string
+	}{
+		{
+			name: "Named tool class",
+			file: "tool.ts",
+			src:  "export class CounterTool extends BaseBoxShapeTool {\n}\n",
+			want: "export class CounterTool extends BaseBoxShapeTool {\n}\n\nexport default CounterTool\n",
+		},
+		{
+			name: "Generic util class",
+			file: "util.tsx",
+			src:  "class Helper extends Base {}\nexport class CounterUtil extends ShapeUtil<ICounter> {}",
+			want: "class Helper extends Base {}\nexport class CounterUtil extends ShapeUtil<ICounter> {}\n\nexport default CounterUtil\n",
+		},
+		{
+			name: "Already exported",
+			file: "tool.ts",
+			src:  "export default class CounterTool extends BaseBoxShapeTool {}\n",
+			want: "export default class CounterTool extends BaseBoxShapeTool {}\n",
+		},
+		{
+			name: "Ambiguous",
+			file: "tool.ts",
+			src:  "export class ATool extends BaseBoxShapeTool {}\nexport class BTool extends StateNode {}\n",
+			want: "export class ATool extends BaseBoxShapeTool {}\nexport class BTool extends StateNode {}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, _ := addDefaultExport(test.file, test.src)
+			if got != test.want {
+				t.Errorf("Expected %q\nbut got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestAddPointerEvents(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "Existing style object",
+			src:  "<HTMLContainer id={shape.id} onClick={() => a > b} style={{ color: 'red' }}>",
+			want: "<HTMLContainer id={shape.id} onClick={() => a > b} style={{ pointerEvents: 'all', color: 'red' }}>",
+		},
+		{
+			name: "No style",
+			src:  "<HTMLContainer\n\tid={shape.id}\n>",
+			want: "<HTMLContainer style={{ pointerEvents: 'all' }}\n\tid={shape.id}\n>",
+		},
+		{
+			name: "Style variable",
+			src:  "<HTMLContainer style={styles}>",
+			want: "<HTMLContainer style={styles}>",
+		},
+		{
+			name: "Already set",
+			src:  "<HTMLContainer style={{ pointerEvents: 'none' }}>",
+			want: "<HTMLContainer style={{ pointerEvents: 'none' }}>",
+		},
+		{
+			name: "Other component",
+			src:  "<HTMLContainerish id='x'>",
+			want: "<HTMLContainerish id='x'>",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, _ := addPointerEvents("util.tsx", test.src)
+			if got != test.want {
+				t.Errorf("Expected %q\nbut got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	files := []File{
+		{"tool.ts", "import { BaseBoxShapeTool } from '@tldraw/tldraw'\nexport class CounterTool extends BaseBoxShapeTool {}\n"},
+		{"icon.svg", "<svg>'@tldraw/tldraw'</svg>"},
+	}
+
+	got, changes := Default().Run(files)
+
+	want := []File{
+		{"tool.ts", "import { BaseBoxShapeTool } from 'tldraw'\nexport class CounterTool extends BaseBoxShapeTool {}\n\nexport default CounterTool\n"},
+		{"icon.svg", "<svg>'@tldraw/tldraw'</svg>"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q\nbut got %q", want, got)
+	}
+
+	wantChanges := []Change{
+		{Codemod: "tldraw-import", File: "tool.ts", Line: 1, Description: `replaced "@tldraw/tldraw" import with "tldraw"`},
+		{Codemod: "default-export", File: "tool.ts", Line: 2, Description: "added default export for CounterTool"},
+	}
+	if !reflect.DeepEqual(changes, wantChanges) {
+		t.Errorf("Expected %+v\nbut got %+v", wantChanges, changes)
+	}
+
+	if files[0].Content == got[0].Content {
+		t.Error("Expected the input files to be left untouched")
+	}
+}
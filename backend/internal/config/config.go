@@ -0,0 +1,307 @@
+// Package config loads the workspaces tools are installed into. A workspace
+// is a frontend app with a directory for the tool sources and one for their
+// icons, or a database the server serves tools from. Settings come from a
+// JSON config file, then environment variables, then command line flags,
+// each overriding the one before.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+)
+
+const (
+	DefaultWorkspaceName = "default"
+	DefaultToolsDir      = "components/tldraw-custom-tools"
+	DefaultIconsDir      = "public/custom-tool-icons"
+)
+
+// Stores a workspace can keep its tools in
+const (
+	StoreFiles  = "files"
+	StoreMemory = "memory"
+	StoreSQLite = "sqlite"
+)
+
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Workspace is a frontend app tools are installed into. ToolsDir and IconsDir
+// are relative to Root. Store picks where the tools are kept: the source tree
+// of the app, memory, or the SQLite file at Database, in which case Root is
+// only needed for type checking.
+type Workspace struct {
+	Name     string `json:"name"`
+	Root     string `json:"root,omitempty"`
+	ToolsDir string `json:"toolsDir,omitempty"`
+	IconsDir string `json:"iconsDir,omitempty"`
+	Store    string `json:"store,omitempty"`
+	Database string `json:"database,omitempty"`
+}
+
+// NewWorkspace returns a workspace at root with the default layout of the
+// frontend.
+func NewWorkspace(name, root string) Workspace {
+	return Workspace{Name: name, Root: root, ToolsDir: DefaultToolsDir, IconsDir: DefaultIconsDir, Store: StoreFiles}
+}
+
+// ToolsPath is the directory holding tools.json and a folder per tool.
+func (w Workspace) ToolsPath() string {
+	return filepath.Join(w.Root, w.ToolsDir)
+}
+
+// IconsPath is the directory holding the icon of each tool.
+func (w Workspace) IconsPath() string {
+	return filepath.Join(w.Root, w.IconsDir)
+}
+
+// Validate checks the store of the workspace, that Root is an existing
+// directory and that the tools and icons directories are inside it. Those two
+// are created by the first install, so they only have to be directories if
+// they exist.
+func (w Workspace) Validate() error {
+	if !validName.MatchString(w.Name) {
+		return fmt.Errorf("invalid workspace name %q", w.Name)
+	}
+
+	switch w.Store {
+	case StoreFiles:
+		if w.Root == "" {
+			return fmt.Errorf("workspace %s: the files store needs a root", w.Name)
+		}
+	case StoreMemory:
+	case StoreSQLite:
+		if !filepath.IsAbs(w.Database) {
+			return fmt.Errorf("workspace %s: database %q is not an absolute path", w.Name, w.Database)
+		}
+	default:
+		return fmt.Errorf("workspace %s: unknown store %q", w.Name, w.Store)
+	}
+
+	if w.Root == "" {
+		return nil
+	}
+	if !filepath.IsAbs(w.Root) {
+		return fmt.Errorf("workspace %s: root %q is not an absolute path", w.Name, w.Root)
+	}
+	info, err := os.Stat(w.Root)
+	if err != nil {
+		return fmt.Errorf("workspace %s: %w", w.Name, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("workspace %s: root %s is not a directory", w.Name, w.Root)
+	}
+
+	for _, dir := range []struct{ name, path string }{{"tools", w.ToolsDir}, {"icons", w.IconsDir}} {
+		if !filepath.IsLocal(dir.path) {
+			return fmt.Errorf("workspace %s: %s directory %q is not inside the root", w.Name, dir.name, dir.path)
+		}
+
+		info, err := os.Stat(filepath.Join(w.Root, dir.path))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("workspace %s: %w", w.Name, err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("workspace %s: %s directory %s is not a directory", w.Name, dir.name, dir.path)
+		}
+	}
+
+	return nil
+}
+
+// Config is the set of workspaces the server can install tools into, and
+// the settings of the generator. Requests that do not pick a workspace use
+// DefaultWorkspace.
+type Config struct {
+	DefaultWorkspace string      `json:"defaultWorkspace,omitempty"`
+	Workspaces       []Workspace `json:"workspaces"`
+	Generator        Generator   `json:"generator"`
+}
+
+// Workspace returns the workspace called name, or the default one when name
+// is empty.
+func (c *Config) Workspace(name string) (Workspace, bool) {
+	if name == "" {
+		name = c.DefaultWorkspace
+	}
+
+	i := slices.IndexFunc(c.Workspaces, func(w Workspace) bool { return w.Name == name })
+	if i < 0 {
+		return Workspace{}, false
+	}
+
+	return c.Workspaces[i], true
+}
+
+// Validate checks every workspace and reports all the problems at once.
+func (c *Config) Validate() error {
+	if len(c.Workspaces) == 0 {
+		return errors.New("no workspace configured: set WORKSPACE_ROOT, -workspace-root or a config file")
+	}
+
+	errs := []error{}
+	seen := map[string]bool{}
+	for _, w := range c.Workspaces {
+		if seen[w.Name] {
+			errs = append(errs, fmt.Errorf("duplicate workspace %q", w.Name))
+			continue
+		}
+		seen[w.Name] = true
+
+		if err := w.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if !seen[c.DefaultWorkspace] {
+		errs = append(errs, fmt.Errorf("default workspace %q is not configured", c.DefaultWorkspace))
+	}
+
+	if err := c.Generator.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Load reads the config from the file given by -config or CONFIG_FILE, then
+// applies the environment and args to the default workspace and the
+// generator settings and validates the result.
+func Load(args []string, getenv func(string) string) (*Config, error) {
+	// The environment provides the defaults of the flags, so flags win
+	flags := flag.NewFlagSet("tlcrazy", flag.ContinueOnError)
+	file := flags.String("config", getenv("CONFIG_FILE"), "JSON config file with the workspaces")
+	name := flags.String("workspace", getenv("WORKSPACE"), "name of the default workspace")
+	root := flags.String("workspace-root", getenv("WORKSPACE_ROOT"), "frontend app of the default workspace")
+	toolsDir := flags.String("tools-dir", getenv("TOOLS_DIR"), "tools directory, relative to the workspace root")
+	iconsDir := flags.String("icons-dir", getenv("ICONS_DIR"), "icons directory, relative to the workspace root")
+	store := flags.String("store", getenv("TOOL_STORE"), "where the default workspace keeps its tools: files, memory or sqlite")
+	database := flags.String("database", getenv("TOOL_DATABASE"), "SQLite database of the default workspace")
+	generator := generatorFlags(flags, getenv)
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	if *file != "" {
+		loaded, err := LoadFile(*file)
+		if err != nil {
+			return nil, err
+		}
+		cfg = loaded
+	}
+
+	if err := applyGeneratorFlags(&cfg.Generator, generator); err != nil {
+		return nil, err
+	}
+
+	if *name != "" {
+		cfg.DefaultWorkspace = *name
+	}
+	if cfg.DefaultWorkspace == "" {
+		cfg.DefaultWorkspace = DefaultWorkspaceName
+		if len(cfg.Workspaces) > 0 {
+			cfg.DefaultWorkspace = cfg.Workspaces[0].Name
+		}
+	}
+
+	if *root != "" || *toolsDir != "" || *iconsDir != "" || *store != "" || *database != "" {
+		i := slices.IndexFunc(cfg.Workspaces, func(w Workspace) bool { return w.Name == cfg.DefaultWorkspace })
+		if i < 0 {
+			cfg.Workspaces = append(cfg.Workspaces, Workspace{Name: cfg.DefaultWorkspace})
+			i = len(cfg.Workspaces) - 1
+		}
+
+		w := &cfg.Workspaces[i]
+		if *root != "" {
+			abs, err := filepath.Abs(*root)
+			if err != nil {
+				return nil, err
+			}
+			w.Root = abs
+		}
+		if *toolsDir != "" {
+			w.ToolsDir = *toolsDir
+		}
+		if *iconsDir != "" {
+			w.IconsDir = *iconsDir
+		}
+		if *store != "" {
+			w.Store = *store
+		}
+		if *database != "" {
+			abs, err := filepath.Abs(*database)
+			if err != nil {
+				return nil, err
+			}
+			w.Database = abs
+		}
+	}
+
+	cfg.setDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// LoadFile reads a config file. Relative paths are relative to the directory
+// of the file.
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	cfg := &Config{}
+	if err := decoder.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	cfg.Generator.resolve(dir)
+	for i := range cfg.Workspaces {
+		w := &cfg.Workspaces[i]
+		if w.Root != "" && !filepath.IsAbs(w.Root) {
+			w.Root = filepath.Join(dir, w.Root)
+		}
+		if w.Database != "" && !filepath.IsAbs(w.Database) {
+			w.Database = filepath.Join(dir, w.Database)
+		}
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) setDefaults() {
+	for i := range c.Workspaces {
+		w := &c.Workspaces[i]
+		if w.ToolsDir == "" {
+			w.ToolsDir = DefaultToolsDir
+		}
+		if w.IconsDir == "" {
+			w.IconsDir = DefaultIconsDir
+		}
+		if w.Store == "" {
+			w.Store = StoreFiles
+		}
+		w.ToolsDir = filepath.Clean(w.ToolsDir)
+		w.IconsDir = filepath.Clean(w.IconsDir)
+	}
+}
@@ -0,0 +1,217 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestRoot(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, DefaultToolsDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return root
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "tlcrazy.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestLoad(t *testing.T) {
+	app, other := newTestRoot(t), newTestRoot(t)
+
+	t.Run("Environment", func(t *testing.T) {
+		cfg, err := Load(nil, env(map[string]string{"WORKSPACE_ROOT": app, "TOOLS_DIR": "src/tools"}))
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		want := &Config{
+			DefaultWorkspace: DefaultWorkspaceName,
+			Workspaces:       []Workspace{{Name: "default", Root: app, ToolsDir: "src/tools", IconsDir: DefaultIconsDir, Store: StoreFiles}},
+		}
+		if !reflect.DeepEqual(cfg, want) {
+			t.Errorf("Expected %+v\nbut got %+v", want, cfg)
+		}
+	})
+
+	t.Run("Config file", func(t *testing.T) {
+		file := writeConfigFile(t, `{
+			"defaultWorkspace": "other",
+			"workspaces": [
+				{"name": "app", "root": "`+app+`"},
+				{"name": "other", "root": "`+other+`", "iconsDir": "static/icons"}
+			]
+		}`)
+
+		cfg, err := Load([]string{"-config", file}, env(nil))
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		workspace, ok := cfg.Workspace("")
+		if !ok || workspace.Name != "other" || workspace.IconsPath() != filepath.Join(other, "static/icons") {
+			t.Errorf("Expected the other workspace by default but got %+v", workspace)
+		}
+		if workspace, ok := cfg.Workspace("app"); !ok || workspace.ToolsDir != DefaultToolsDir {
+			t.Errorf("Expected the app workspace with the default tools dir but got %+v", workspace)
+		}
+		if _, ok := cfg.Workspace("missing"); ok {
+			t.Error("Expected no missing workspace")
+		}
+	})
+
+	t.Run("Flags override the environment", func(t *testing.T) {
+		file := writeConfigFile(t, `{"workspaces": [{"name": "app", "root": "`+app+`"}]}`)
+
+		cfg, err := Load(
+			[]string{"-workspace", "app", "-workspace-root", other},
+			env(map[string]string{"CONFIG_FILE": file, "WORKSPACE_ROOT": app, "ICONS_DIR": "icons"}),
+		)
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+
+		want := []Workspace{{Name: "app", Root: other, ToolsDir: DefaultToolsDir, IconsDir: "icons", Store: StoreFiles}}
+		if !reflect.DeepEqual(cfg.Workspaces, want) {
+			t.Errorf("Expected %+v\nbut got %+v", want, cfg.Workspaces)
+		}
+	})
+
+	t.Run("Relative roots", func(t *testing.T) {
+		file := writeConfigFile(t, `{"workspaces": [{"name": "app", "root": "frontend"}]}`)
+		if err := os.Mkdir(filepath.Join(filepath.Dir(file), "frontend"), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		cfg, err := Load([]string{"-config", file}, env(nil))
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		if root := cfg.Workspaces[0].Root; root != filepath.Join(filepath.Dir(file), "frontend") {
+			t.Errorf("Expected the root next to the config file but got %s", root)
+		}
+	})
+
+	t.Run("Stores", func(t *testing.T) {
+		file := writeConfigFile(t, `{"workspaces": [{"name": "app", "store": "sqlite", "database": "tools.db"}]}`)
+
+		cfg, err := Load([]string{"-config", file}, env(nil))
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		if database := cfg.Workspaces[0].Database; database != filepath.Join(filepath.Dir(file), "tools.db") {
+			t.Errorf("Expected the database next to the config file but got %s", database)
+		}
+
+		cfg, err = Load([]string{"-store", "memory"}, env(nil))
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		want := []Workspace{{Name: "default", ToolsDir: DefaultToolsDir, IconsDir: DefaultIconsDir, Store: StoreMemory}}
+		if !reflect.DeepEqual(cfg.Workspaces, want) {
+			t.Errorf("Expected %+v\nbut got %+v", want, cfg.Workspaces)
+		}
+	})
+}
+
+func TestLoadGenerator(t *testing.T) {
+	app := newTestRoot(t)
+	file := writeConfigFile(t, `{
+		"workspaces": [{"name": "app", "root": "`+app+`"}],
+		"generator": {"maxTokens": 8000, "maxRepairs": 3, "generateTimeout": "2m", "auditLog": "audit.jsonl"}
+	}`)
+
+	cfg, err := Load(
+		[]string{"-max-repairs", "0", "-mode", "tool_use"},
+		env(map[string]string{"CONFIG_FILE": file, "MAX_REPAIR_ATTEMPTS": "5", "WRITE_TIMEOUT": "10s", "TYPECHECK": "true"}),
+	)
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+
+	zero, maxTokens := 0, 8000
+	want := Generator{
+		MaxRepairs:      &zero,
+		MaxTokens:       &maxTokens,
+		Mode:            "tool_use",
+		GenerateTimeout: Duration(2 * time.Minute),
+		WriteTimeout:    Duration(10 * time.Second),
+		TypeCheck:       true,
+		AuditLog:        filepath.Join(filepath.Dir(file), "audit.jsonl"),
+	}
+	if !reflect.DeepEqual(cfg.Generator, want) {
+		t.Errorf("Expected %+v\nbut got %+v", want, cfg.Generator)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	app := newTestRoot(t)
+	notDir := filepath.Join(app, "file")
+	if err := os.WriteFile(notDir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(app, "public"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		file string
+		vars map[string]string
+		want string
+	}{
+		{"Nothing configured", "", nil, "no workspace configured"},
+		{"Missing root", "", map[string]string{"WORKSPACE_ROOT": filepath.Join(app, "missing")}, "no such file"},
+		{"Root is a file", "", map[string]string{"WORKSPACE_ROOT": notDir}, "is not a directory"},
+		{"Tools dir outside root", "", map[string]string{"WORKSPACE_ROOT": app, "TOOLS_DIR": "../tools"}, "is not inside the root"},
+		{"Icons dir is a file", "", map[string]string{"WORKSPACE_ROOT": app, "ICONS_DIR": "public"}, "is not a directory"},
+		{"Invalid name", `{"workspaces": [{"name": "My App", "root": "` + app + `"}]}`, nil, "invalid workspace name"},
+		{"Duplicate name", `{"workspaces": [{"name": "app", "root": "` + app + `"}, {"name": "app", "root": "` + app + `"}]}`, nil, "duplicate workspace"},
+		{"Unknown default", `{"defaultWorkspace": "other", "workspaces": [{"name": "app", "root": "` + app + `"}]}`, nil, `default workspace "other"`},
+		{"Files store without root", "", map[string]string{"TOOL_STORE": "files"}, "needs a root"},
+		{"Unknown store", "", map[string]string{"WORKSPACE_ROOT": app, "TOOL_STORE": "s3"}, `unknown store "s3"`},
+		{"SQLite without database", "", map[string]string{"TOOL_STORE": "sqlite"}, "database"},
+		{"Unparsable setting", "", map[string]string{"WORKSPACE_ROOT": app, "MAX_TOKENS": "lots"}, `invalid MAX_TOKENS "lots"`},
+		{"Unknown mode", "", map[string]string{"WORKSPACE_ROOT": app, "GENERATION_MODE": "yaml"}, `unknown mode "yaml"`},
+		{"Limit out of range", "", map[string]string{"WORKSPACE_ROOT": app, "MAX_CONCURRENCY": "0"}, "maxConcurrency must be at least 1"},
+		{"Negative timeout", "", map[string]string{"WORKSPACE_ROOT": app, "WRITE_TIMEOUT": "-1s"}, "writeTimeout must not be negative"},
+		{"Missing policy file", "", map[string]string{"WORKSPACE_ROOT": app, "POLICY_FILE": filepath.Join(app, "policy.json")}, "policyFile"},
+		{"Unknown field", `{"workspaces": [], "root": "` + app + `"}`, nil, "unknown field"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vars := map[string]string{}
+			for key, value := range test.vars {
+				vars[key] = value
+			}
+			if test.file != "" {
+				vars["CONFIG_FILE"] = writeConfigFile(t, test.file)
+			}
+
+			_, err := Load(nil, env(vars))
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("Expected an error containing %q but got %v", test.want, err)
+			}
+		})
+	}
+}
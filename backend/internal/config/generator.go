@@ -0,0 +1,235 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// GenerationMode is the output format tools are generated in. It is defined
+// here rather than in the ai package so the config can check it on load.
+type GenerationMode string
+
+const (
+	// ModeXML asks for the <tool>/<file> format described in the system prompt.
+	ModeXML GenerationMode = "xml"
+	// ModeToolUse asks the model to call a tool that returns the same data as
+	// structured JSON.
+	ModeToolUse GenerationMode = "tool_use"
+)
+
+// GenerationModes are the modes the generator supports.
+var GenerationModes = []GenerationMode{ModeXML, ModeToolUse}
+
+// Valid reports whether m is a supported mode or empty for the default.
+func (m GenerationMode) Valid() bool {
+	return m == "" || slices.Contains(GenerationModes, m)
+}
+
+// Generator holds the settings of tool generation shared by all workspaces.
+// Unset fields keep the defaults of the generator.
+type Generator struct {
+	SessionsDir string `json:"sessionsDir,omitempty"`
+	HistoryDir  string `json:"historyDir,omitempty"`
+
+	MaxRepairs       *int `json:"maxRepairs,omitempty"`
+	MaxTokens        *int `json:"maxTokens,omitempty"`
+	MaxContinuations *int `json:"maxContinuations,omitempty"`
+	MaxCandidates    *int `json:"maxCandidates,omitempty"`
+	MaxConcurrency   *int `json:"maxConcurrency,omitempty"`
+
+	Mode GenerationMode `json:"mode,omitempty"`
+
+	GenerateTimeout Duration `json:"generateTimeout,omitempty"`
+	WriteTimeout    Duration `json:"writeTimeout,omitempty"`
+
+	TypeCheck        bool     `json:"typeCheck,omitempty"`
+	TypeCheckTimeout Duration `json:"typeCheckTimeout,omitempty"`
+	MaxTypeFixes     *int     `json:"maxTypeFixes,omitempty"`
+
+	ValidatorRules string `json:"validatorRules,omitempty"`
+	PolicyFile     string `json:"policyFile,omitempty"`
+	AuditLog       string `json:"auditLog,omitempty"`
+}
+
+// Duration is a time.Duration written like "30s" in config files.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+
+	return nil
+}
+
+// generatorSetting is a generator setting that can be given as a flag or an
+// environment variable.
+type generatorSetting struct {
+	flag, env, usage string
+	set              func(g *Generator, value string) error
+}
+
+var generatorSettings = []generatorSetting{
+	{"sessions-dir", "SESSIONS_DIR", "directory of the refine sessions", func(g *Generator, v string) error {
+		g.SessionsDir = v
+		return nil
+	}},
+	{"history-dir", "HISTORY_DIR", "directory of the tool version history", func(g *Generator, v string) error {
+		g.HistoryDir = v
+		return nil
+	}},
+	{"max-repairs", "MAX_REPAIR_ATTEMPTS", "repairs of an unusable model output", func(g *Generator, v string) error {
+		return setInt(&g.MaxRepairs, v)
+	}},
+	{"max-tokens", "MAX_TOKENS", "output token ceiling per request", func(g *Generator, v string) error {
+		return setInt(&g.MaxTokens, v)
+	}},
+	{"max-continuations", "MAX_CONTINUATIONS", "continuations of an output cut off at the token ceiling", func(g *Generator, v string) error {
+		return setInt(&g.MaxContinuations, v)
+	}},
+	{"max-candidates", "MAX_CANDIDATES", "candidates a request may ask for", func(g *Generator, v string) error {
+		return setInt(&g.MaxCandidates, v)
+	}},
+	{"max-concurrency", "MAX_CONCURRENCY", "candidates generated at the same time", func(g *Generator, v string) error {
+		return setInt(&g.MaxConcurrency, v)
+	}},
+	{"mode", "GENERATION_MODE", "default generation mode: xml or tool_use", func(g *Generator, v string) error {
+		g.Mode = GenerationMode(v)
+		return nil
+	}},
+	{"generate-timeout", "GENERATE_TIMEOUT", "timeout of the LLM requests for a tool", func(g *Generator, v string) error {
+		return g.GenerateTimeout.UnmarshalText([]byte(v))
+	}},
+	{"write-timeout", "WRITE_TIMEOUT", "timeout of installing a tool", func(g *Generator, v string) error {
+		return g.WriteTimeout.UnmarshalText([]byte(v))
+	}},
+	{"typecheck", "TYPECHECK", "compile tools before installing them", func(g *Generator, v string) (err error) {
+		g.TypeCheck, err = strconv.ParseBool(v)
+		return err
+	}},
+	{"typecheck-timeout", "TYPECHECK_TIMEOUT", "timeout of compiling a tool", func(g *Generator, v string) error {
+		return g.TypeCheckTimeout.UnmarshalText([]byte(v))
+	}},
+	{"max-type-fixes", "MAX_TYPE_FIXES", "times type errors are sent back to the model", func(g *Generator, v string) error {
+		return setInt(&g.MaxTypeFixes, v)
+	}},
+	{"validator-rules", "VALIDATOR_RULES", "JSON file with the validator rules", func(g *Generator, v string) error {
+		g.ValidatorRules = v
+		return nil
+	}},
+	{"policy-file", "POLICY_FILE", "JSON file with the security policy", func(g *Generator, v string) error {
+		g.PolicyFile = v
+		return nil
+	}},
+	{"audit-log", "AUDIT_LOG", "file the policy verdicts are appended to", func(g *Generator, v string) error {
+		g.AuditLog = v
+		return nil
+	}},
+}
+
+func setInt(target **int, value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	*target = &n
+
+	return nil
+}
+
+// generatorFlags defines a flag for every generator setting, defaulting to
+// its environment variable.
+func generatorFlags(flags *flag.FlagSet, getenv func(string) string) []*string {
+	values := make([]*string, len(generatorSettings))
+	for i, s := range generatorSettings {
+		values[i] = flags.String(s.flag, getenv(s.env), fmt.Sprintf("%s (%s)", s.usage, s.env))
+	}
+
+	return values
+}
+
+// applyGeneratorFlags sets the generator settings that were given.
+func applyGeneratorFlags(g *Generator, values []*string) error {
+	errs := []error{}
+	for i, s := range generatorSettings {
+		if *values[i] == "" {
+			continue
+		}
+		if err := s.set(g, *values[i]); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s %q: %w", s.env, *values[i], err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// resolve makes the paths of a config file relative to its directory.
+func (g *Generator) resolve(dir string) {
+	for _, path := range []*string{&g.SessionsDir, &g.HistoryDir, &g.ValidatorRules, &g.PolicyFile, &g.AuditLog} {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(dir, *path)
+		}
+	}
+}
+
+// Validate checks the limits are in range and the rule files exist.
+func (g Generator) Validate() error {
+	errs := []error{}
+
+	for _, limit := range []struct {
+		name  string
+		value *int
+		min   int
+	}{
+		{"maxRepairs", g.MaxRepairs, 0},
+		{"maxTokens", g.MaxTokens, 1},
+		{"maxContinuations", g.MaxContinuations, 0},
+		{"maxCandidates", g.MaxCandidates, 1},
+		{"maxConcurrency", g.MaxConcurrency, 1},
+		{"maxTypeFixes", g.MaxTypeFixes, 0},
+	} {
+		if limit.value != nil && *limit.value < limit.min {
+			errs = append(errs, fmt.Errorf("generator: %s must be at least %d but is %d", limit.name, limit.min, *limit.value))
+		}
+	}
+
+	if !g.Mode.Valid() {
+		errs = append(errs, fmt.Errorf("generator: unknown mode %q, use one of %q", g.Mode, GenerationModes))
+	}
+
+	for _, timeout := range []struct {
+		name  string
+		value Duration
+	}{
+		{"generateTimeout", g.GenerateTimeout},
+		{"writeTimeout", g.WriteTimeout},
+		{"typeCheckTimeout", g.TypeCheckTimeout},
+	} {
+		if timeout.value < 0 {
+			errs = append(errs, fmt.Errorf("generator: %s must not be negative", timeout.name))
+		}
+	}
+
+	for _, file := range []struct{ name, path string }{{"validatorRules", g.ValidatorRules}, {"policyFile", g.PolicyFile}} {
+		if file.path == "" {
+			continue
+		}
+		if _, err := os.Stat(file.path); err != nil {
+			errs = append(errs, fmt.Errorf("generator: %s: %w", file.name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,138 @@
+package icon
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// glyphs is a tiny stroke font on a 4x6 grid. Each glyph is a list of
+// polylines.
+var glyphs = map[rune][][][2]float64{
+	'A': {{{0, 6}, {2, 0}, {4, 6}}, {{1, 4}, {3, 4}}},
+	'B': {{{0, 0}, {0, 6}, {3, 6}, {4, 5}, {4, 4}, {3, 3}, {0, 3}}, {{0, 0}, {3, 0}, {4, 1}, {4, 2}, {3, 3}}},
+	'C': {{{4, 1}, {3, 0}, {1, 0}, {0, 1}, {0, 5}, {1, 6}, {3, 6}, {4, 5}}},
+	'D': {{{0, 0}, {0, 6}, {3, 6}, {4, 5}, {4, 1}, {3, 0}, {0, 0}}},
+	'E': {{{4, 0}, {0, 0}, {0, 6}, {4, 6}}, {{0, 3}, {3, 3}}},
+	'F': {{{4, 0}, {0, 0}, {0, 6}}, {{0, 3}, {3, 3}}},
+	'G': {{{4, 1}, {3, 0}, {1, 0}, {0, 1}, {0, 5}, {1, 6}, {3, 6}, {4, 5}, {4, 3}, {2, 3}}},
+	'H': {{{0, 0}, {0, 6}}, {{4, 0}, {4, 6}}, {{0, 3}, {4, 3}}},
+	'I': {{{1, 0}, {3, 0}}, {{2, 0}, {2, 6}}, {{1, 6}, {3, 6}}},
+	'J': {{{4, 0}, {4, 5}, {3, 6}, {1, 6}, {0, 5}}},
+	'K': {{{0, 0}, {0, 6}}, {{4, 0}, {0, 4}}, {{1, 3}, {4, 6}}},
+	'L': {{{0, 0}, {0, 6}, {4, 6}}},
+	'M': {{{0, 6}, {0, 0}, {2, 3}, {4, 0}, {4, 6}}},
+	'N': {{{0, 6}, {0, 0}, {4, 6}, {4, 0}}},
+	'O': {{{1, 0}, {3, 0}, {4, 1}, {4, 5}, {3, 6}, {1, 6}, {0, 5}, {0, 1}, {1, 0}}},
+	'P': {{{0, 6}, {0, 0}, {3, 0}, {4, 1}, {4, 2}, {3, 3}, {0, 3}}},
+	'Q': {{{1, 0}, {3, 0}, {4, 1}, {4, 5}, {3, 6}, {1, 6}, {0, 5}, {0, 1}, {1, 0}}, {{2, 4}, {4, 6}}},
+	'R': {{{0, 6}, {0, 0}, {3, 0}, {4, 1}, {4, 2}, {3, 3}, {0, 3}}, {{2, 3}, {4, 6}}},
+	'S': {{{4, 1}, {3, 0}, {1, 0}, {0, 1}, {0, 2}, {1, 3}, {3, 3}, {4, 4}, {4, 5}, {3, 6}, {1, 6}, {0, 5}}},
+	'T': {{{0, 0}, {4, 0}}, {{2, 0}, {2, 6}}},
+	'U': {{{0, 0}, {0, 5}, {1, 6}, {3, 6}, {4, 5}, {4, 0}}},
+	'V': {{{0, 0}, {2, 6}, {4, 0}}},
+	'W': {{{0, 0}, {1, 6}, {2, 3}, {3, 6}, {4, 0}}},
+	'X': {{{0, 0}, {4, 6}}, {{4, 0}, {0, 6}}},
+	'Y': {{{0, 0}, {2, 3}, {4, 0}}, {{2, 3}, {2, 6}}},
+	'Z': {{{0, 0}, {4, 0}, {0, 6}, {4, 6}}},
+	'0': {{{1, 0}, {3, 0}, {4, 1}, {4, 5}, {3, 6}, {1, 6}, {0, 5}, {0, 1}, {1, 0}}, {{3, 1}, {1, 5}}},
+	'1': {{{1, 1}, {2, 0}, {2, 6}}, {{1, 6}, {3, 6}}},
+	'2': {{{0, 1}, {1, 0}, {3, 0}, {4, 1}, {4, 2}, {0, 6}, {4, 6}}},
+	'3': {{{0, 1}, {1, 0}, {3, 0}, {4, 1}, {4, 2}, {3, 3}, {4, 4}, {4, 5}, {3, 6}, {1, 6}, {0, 5}}, {{1, 3}, {3, 3}}},
+	'4': {{{3, 6}, {3, 0}, {0, 4}, {4, 4}}},
+	'5': {{{4, 0}, {0, 0}, {0, 3}, {3, 3}, {4, 4}, {4, 5}, {3, 6}, {0, 6}}},
+	'6': {{{3, 0}, {1, 0}, {0, 1}, {0, 5}, {1, 6}, {3, 6}, {4, 5}, {4, 4}, {3, 3}, {0, 3}}},
+	'7': {{{0, 0}, {4, 0}, {1, 6}}},
+	'8': {{{1, 3}, {0, 2}, {0, 1}, {1, 0}, {3, 0}, {4, 1}, {4, 2}, {3, 3}, {1, 3}, {0, 4}, {0, 5}, {1, 6}, {3, 6}, {4, 5}, {4, 4}, {3, 3}}},
+	'9': {{{4, 3}, {1, 3}, {0, 2}, {0, 1}, {1, 0}, {3, 0}, {4, 1}, {4, 5}, {3, 6}, {1, 6}}},
+}
+
+// Fallback draws an outlined monogram icon from the initials of the tool's
+// name, or of its id when the name has no usable letters. The same id and
+// name always give the same icon, and the result passes Sanitize unchanged.
+func Fallback(id, name string) string {
+	letters := initials(name)
+	if len(letters) == 0 {
+		letters = initials(id)
+	}
+
+	children := []*node{{
+		name: "rect",
+		attrs: []xml.Attr{
+			attr("x", "3"), attr("y", "3"), attr("width", "18"), attr("height", "18"), attr("rx", "3"),
+		},
+	}}
+
+	// One glyph is 6x10, two are 4x8 each with a gap of 2, centered in the
+	// frame.
+	scaleX, scaleY, left, top, advance := 1.5, 10.0/6, 9.0, 7.0, 0.0
+	if len(letters) == 2 {
+		scaleX, scaleY, left, top, advance = 1, 8.0/6, 7, 8, 6
+	}
+
+	for i, letter := range letters {
+		var d strings.Builder
+		for _, line := range glyphs[letter] {
+			for j, point := range line {
+				command := "L"
+				if j == 0 {
+					command = "M"
+				}
+				if d.Len() > 0 {
+					d.WriteString(" ")
+				}
+				x := left + float64(i)*advance + point[0]*scaleX
+				y := top + point[1]*scaleY
+				fmt.Fprintf(&d, "%s%s %s", command, formatNumber(x), formatNumber(y))
+			}
+		}
+
+		children = append(children, &node{
+			name:  "path",
+			attrs: []xml.Attr{attr("d", d.String()), attr("stroke-width", "1.5")},
+		})
+	}
+
+	result, err := Sanitize(render(children))
+	if err != nil {
+		panic(fmt.Sprintf("fallback icon for %q is invalid: %s", id, err))
+	}
+
+	return result.SVG
+}
+
+// initials returns up to two glyphs: the first letter or digit of the first
+// two words of s.
+func initials(s string) []rune {
+	words := strings.FieldsFunc(strings.ToUpper(s), func(r rune) bool {
+		_, ok := glyphs[r]
+		return !ok && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	letters := []rune{}
+	for _, word := range words {
+		for _, r := range word {
+			if _, ok := glyphs[r]; ok {
+				letters = append(letters, r)
+				break
+			}
+		}
+		if len(letters) == 2 {
+			break
+		}
+	}
+
+	return letters
+}
+
+func render(children []*node) string {
+	var b strings.Builder
+	write(&b, &node{
+		name:     "svg",
+		attrs:    []xml.Attr{attr("viewBox", fmt.Sprintf("0 0 %d %d", Size, Size))},
+		children: children,
+	}, 0)
+
+	return b.String()
+}
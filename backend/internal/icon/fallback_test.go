@@ -0,0 +1,70 @@
+package icon
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInitials(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"Click Counter", "CC"},
+		{"youtube-player", "YP"},
+		{"timer", "T"},
+		{"3d cube viewer", "3C"},
+		{"  ", ""},
+		{"émoji picker", "MP"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			if got := string(initials(test.s)); got != test.want {
+				t.Errorf("Expected %q\nbut got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestFallback(t *testing.T) {
+	got := Fallback("counter", "")
+	want := `<svg xmlns="http://www.w3.org/2000/svg" width="24" height="24" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round">
+  <rect x="3" y="3" width="18" height="18" rx="3" />
+  <path d="M15 8.667 L13.5 7 L10.5 7 L9 8.667 L9 15.333 L10.5 17 L13.5 17 L15 15.333" stroke-width="1.5" />
+</svg>
+`
+	if got != want {
+		t.Errorf("Expected %q\nbut got %q", want, got)
+	}
+
+	if Fallback("counter", "") != got {
+		t.Error("Expected the same icon for the same tool")
+	}
+	if Fallback("click-counter", "Click Counter") == got {
+		t.Error("Expected a different icon for different initials")
+	}
+
+	t.Run("Every glyph sanitizes unchanged", func(t *testing.T) {
+		for letter := range glyphs {
+			svg := Fallback(string(letter)+" "+string(letter), "")
+			result, err := Sanitize(svg)
+			if err != nil {
+				t.Fatalf("Got an error for %q but didn't expect one: %s", letter, err)
+			}
+			if result.SVG != svg || len(result.Removed) != 0 {
+				t.Errorf("Expected the icon for %q to be unchanged by Sanitize", letter)
+			}
+			if strings.Count(svg, "<path") != 2 {
+				t.Errorf("Expected 2 glyphs for %q", letter)
+			}
+		}
+	})
+
+	t.Run("No usable letters", func(t *testing.T) {
+		svg := Fallback("", "✨")
+		if strings.Contains(svg, "<path") || !strings.Contains(svg, "<rect") {
+			t.Errorf("Expected only the frame but got %q", svg)
+		}
+	})
+}
@@ -0,0 +1,297 @@
+// Package icon cleans up the toolbar icons of generated tools.
+package icon
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const Size = 24
+
+// allowedElements are the SVG elements kept in an icon. Anything else is
+// removed together with its children.
+var allowedElements = map[string]bool{
+	"svg": true, "g": true, "path": true, "circle": true, "ellipse": true,
+	"line": true, "polyline": true, "polygon": true, "rect": true,
+	"title": true, "desc": true,
+}
+
+// allowedAttrs are the attributes kept on allowed elements. Fill, stroke
+// color, styles, ids, hrefs and event handlers are all dropped.
+var allowedAttrs = map[string]bool{
+	"d": true, "cx": true, "cy": true, "r": true, "rx": true, "ry": true,
+	"x": true, "y": true, "x1": true, "y1": true, "x2": true, "y2": true,
+	"width": true, "height": true, "points": true, "transform": true,
+	"stroke-width": true, "stroke-linecap": true, "stroke-linejoin": true,
+	"stroke-miterlimit": true, "stroke-dasharray": true, "stroke-dashoffset": true,
+	"fill-rule": true, "clip-rule": true, "opacity": true, "pathLength": true,
+}
+
+var drawableElements = map[string]bool{
+	"path": true, "circle": true, "ellipse": true, "line": true,
+	"polyline": true, "polygon": true, "rect": true,
+}
+
+type node struct {
+	name     string
+	attrs    []xml.Attr
+	children []*node
+	text     string
+}
+
+type Result struct {
+	SVG string
+	// Removed lists the elements and attributes that were stripped.
+	Removed []string
+}
+
+// Sanitize parses an SVG icon and rewrites it into a safe outlined icon:
+// unknown elements, scripts, event handlers, styles and links are removed,
+// every shape is drawn with a currentColor stroke and no fill, and the
+// drawing is scaled into a 24x24 viewBox. Icons that do not parse, or have
+// nothing left to draw, are rejected.
+func Sanitize(src string) (Result, error) {
+	root, err := parse(src)
+	if err != nil {
+		return Result{}, err
+	}
+	if root.name != "svg" {
+		return Result{}, fmt.Errorf("root element is <%s>, not <svg>", root.name)
+	}
+
+	minX, minY, width, height, err := viewBox(root)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var removed []string
+	children := clean(root.children, &removed)
+	if !hasDrawable(children) {
+		return Result{}, errors.New("icon has nothing to draw")
+	}
+
+	out := &node{
+		name: "svg",
+		attrs: []xml.Attr{
+			attr("xmlns", "http://www.w3.org/2000/svg"),
+			attr("width", strconv.Itoa(Size)),
+			attr("height", strconv.Itoa(Size)),
+			attr("viewBox", fmt.Sprintf("0 0 %d %d", Size, Size)),
+			attr("fill", "none"),
+			attr("stroke", "currentColor"),
+			attr("stroke-width", "2"),
+			attr("stroke-linecap", "round"),
+			attr("stroke-linejoin", "round"),
+		},
+		children: children,
+	}
+
+	if minX != 0 || minY != 0 || width != Size || height != Size {
+		scale := min(Size/width, Size/height)
+		tx := (Size-width*scale)/2 - minX*scale
+		ty := (Size-height*scale)/2 - minY*scale
+
+		// The stroke width is scaled back so lines stay 2 units wide in the
+		// normalized icon.
+		out.children = []*node{{
+			name: "g",
+			attrs: []xml.Attr{
+				attr("transform", fmt.Sprintf("translate(%s %s) scale(%s)", formatNumber(tx), formatNumber(ty), formatNumber(scale))),
+				attr("stroke-width", formatNumber(2/scale)),
+			},
+			children: children,
+		}}
+	}
+
+	var b strings.Builder
+	write(&b, out, 0)
+
+	return Result{SVG: b.String(), Removed: removed}, nil
+}
+
+func parse(src string) (*node, error) {
+	decoder := xml.NewDecoder(strings.NewReader(src))
+	decoder.Entity = xml.HTMLEntity
+
+	var root *node
+	var stack []*node
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid SVG: %v", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			n := &node{name: t.Name.Local, attrs: t.Attr}
+			if len(stack) == 0 {
+				if root != nil {
+					return nil, errors.New("invalid SVG: more than one root element")
+				}
+				root = n
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, errors.New("invalid SVG: no root element")
+	}
+
+	return root, nil
+}
+
+// viewBox returns the drawing area of the icon from its viewBox, falling
+// back to width and height, and finally to 24x24.
+func viewBox(root *node) (float64, float64, float64, float64, error) {
+	if value, ok := attrValue(root, "viewBox"); ok {
+		fields := strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == ',' || r == '\t' || r == '\n' })
+		if len(fields) != 4 {
+			return 0, 0, 0, 0, fmt.Errorf("invalid viewBox %q", value)
+		}
+
+		var numbers [4]float64
+		for i, field := range fields {
+			n, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return 0, 0, 0, 0, fmt.Errorf("invalid viewBox %q", value)
+			}
+			numbers[i] = n
+		}
+		if numbers[2] <= 0 || numbers[3] <= 0 {
+			return 0, 0, 0, 0, fmt.Errorf("invalid viewBox %q", value)
+		}
+
+		return numbers[0], numbers[1], numbers[2], numbers[3], nil
+	}
+
+	width, errW := parseLength(root, "width")
+	height, errH := parseLength(root, "height")
+	if errW == nil && errH == nil && width > 0 && height > 0 {
+		return 0, 0, width, height, nil
+	}
+
+	return 0, 0, Size, Size, nil
+}
+
+func parseLength(n *node, name string) (float64, error) {
+	value, ok := attrValue(n, name)
+	if !ok {
+		return 0, errors.New("missing")
+	}
+
+	return strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "px"), 64)
+}
+
+// clean drops disallowed elements and attributes, recording what it removed.
+func clean(nodes []*node, removed *[]string) []*node {
+	cleaned := []*node{}
+	for _, n := range nodes {
+		if !allowedElements[n.name] || n.name == "svg" {
+			*removed = append(*removed, fmt.Sprintf("<%s>", n.name))
+			continue
+		}
+
+		attrs := []xml.Attr{}
+		for _, a := range n.attrs {
+			if a.Name.Space == "" && allowedAttrs[a.Name.Local] {
+				attrs = append(attrs, a)
+				continue
+			}
+			*removed = append(*removed, fmt.Sprintf("%s on <%s>", attrName(a), n.name))
+		}
+
+		cleaned = append(cleaned, &node{
+			name:     n.name,
+			attrs:    attrs,
+			children: clean(n.children, removed),
+			text:     n.text,
+		})
+	}
+
+	return cleaned
+}
+
+func hasDrawable(nodes []*node) bool {
+	for _, n := range nodes {
+		if drawableElements[n.name] || hasDrawable(n.children) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// write serializes n with every element on its own line, indented by depth.
+func write(b *strings.Builder, n *node, depth int) {
+	b.WriteString(strings.Repeat("  ", depth) + "<" + n.name)
+	for _, a := range n.attrs {
+		b.WriteString(" " + a.Name.Local + `="`)
+		xml.EscapeText(b, []byte(a.Value))
+		b.WriteString(`"`)
+	}
+
+	text := ""
+	if n.name == "title" || n.name == "desc" {
+		text = strings.TrimSpace(n.text)
+	}
+	if len(n.children) == 0 && text == "" {
+		b.WriteString(" />\n")
+		return
+	}
+
+	b.WriteString(">")
+	xml.EscapeText(b, []byte(text))
+	if len(n.children) > 0 {
+		b.WriteString("\n")
+		for _, child := range n.children {
+			write(b, child, depth+1)
+		}
+		b.WriteString(strings.Repeat("  ", depth))
+	}
+	b.WriteString("</" + n.name + ">\n")
+}
+
+func attr(name, value string) xml.Attr {
+	return xml.Attr{Name: xml.Name{Local: name}, Value: value}
+}
+
+func attrValue(n *node, name string) (string, bool) {
+	for _, a := range n.attrs {
+		if a.Name.Space == "" && a.Name.Local == name {
+			return a.Value, true
+		}
+	}
+
+	return "", false
+}
+
+func attrName(a xml.Attr) string {
+	if a.Name.Space == "" {
+		return a.Name.Local
+	}
+
+	return a.Name.Space + ":" + a.Name.Local
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(math.Round(n*1000)/1000, 'f', -1, 64)
+}
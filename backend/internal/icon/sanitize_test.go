@@ -0,0 +1,106 @@
+package icon
+
+import (
+	"strings"
+	"testing"
+)
+
+const cleanIcon = `<svg xmlns="http://www.w3.org/2000/svg" width="24" height="24" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round">
+  <rect x="3" y="6" width="18" height="12" rx="2" />
+</svg>
+`
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "Already clean",
+			src:  cleanIcon,
+			want: cleanIcon,
+		},
+		{
+			name: "Unsafe content",
+			src: `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" viewBox="0 0 24 24" onload="alert(1)">
+				<script>alert(1)</script>
+				<foreignObject><div>hi</div></foreignObject>
+				<use xlink:href="https://evil.example/icon.svg#x" />
+				<image href="https://evil.example/track.png" />
+				<rect x="3" y="6" width="18" height="12" rx="2" onclick="steal()" style="fill:red" href="javascript:alert(1)" />
+			</svg>`,
+			want: cleanIcon,
+		},
+		{
+			name: "Filled and colored",
+			src:  `<svg viewBox="0 0 24 24"><rect x="3" y="6" width="18" height="12" rx="2" fill="#f00" stroke="blue" /></svg>`,
+			want: cleanIcon,
+		},
+		{
+			name: "Other viewBox",
+			src:  `<svg viewBox="0 0 48 24"><line x1="0" y1="12" x2="48" y2="12" /></svg>`,
+			want: `<svg xmlns="http://www.w3.org/2000/svg" width="24" height="24" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round">
+  <g transform="translate(0 6) scale(0.5)" stroke-width="4">
+    <line x1="0" y1="12" x2="48" y2="12" />
+  </g>
+</svg>
+`,
+		},
+		{
+			name: "Size without viewBox",
+			src:  `<svg width="12px" height="12px"><circle cx="6" cy="6" r="4" /></svg>`,
+			want: `<svg xmlns="http://www.w3.org/2000/svg" width="24" height="24" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round">
+  <g transform="translate(0 0) scale(2)" stroke-width="1">
+    <circle cx="6" cy="6" r="4" />
+  </g>
+</svg>
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Sanitize(test.src)
+			if err != nil {
+				t.Fatal("Got an error but didn't expect one", err)
+			}
+			if got.SVG != test.want {
+				t.Errorf("Expected %q\nbut got %q", test.want, got.SVG)
+			}
+		})
+	}
+}
+
+func TestSanitizeRecordsRemovals(t *testing.T) {
+	got, err := Sanitize(`<svg viewBox="0 0 24 24"><script>x</script><path d="M0 0h24" onclick="x()" /></svg>`)
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+
+	removed := strings.Join(got.Removed, ", ")
+	if removed != "<script>, onclick on <path>" {
+		t.Errorf("Expected %q\nbut got %q", "<script>, onclick on <path>", removed)
+	}
+}
+
+func TestSanitizeRejects(t *testing.T) {
+	tests := map[string]string{
+		"Empty":            "",
+		"Not XML":          "a pencil icon",
+		"Unclosed":         `<svg viewBox="0 0 24 24"><path d="M0 0h24" />`,
+		"Not an SVG":       `<html><path d="M0 0h24" /></html>`,
+		"Nothing to draw":  `<svg viewBox="0 0 24 24"><script>alert(1)</script></svg>`,
+		"Bad viewBox":      `<svg viewBox="0 0 0 24"><path d="M0 0h24" /></svg>`,
+		"Unknown entity":   `<svg viewBox="0 0 24 24"><title>&xxe;</title><path d="M0 0h24" /></svg>`,
+		"Two root element": `<svg><path d="M0 0h24" /></svg><svg />`,
+	}
+
+	for name, src := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Sanitize(src); err == nil {
+				t.Error("Expected an error but didn't get one")
+			}
+		})
+	}
+}
@@ -1,9 +1,18 @@
 package server
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	"tlcrazy-backend/internal/ai"
 
@@ -16,19 +25,87 @@ func (s *Server) RegisterRoutes() http.Handler {
 	r := chi.NewRouter()
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins: []string{"http://localhost:3000"},
+		AllowedMethods: []string{"GET", "POST", "PATCH", "DELETE"},
 	}))
 	r.Use(middleware.Logger)
 
 	r.Post("/tldraw-tool", s.GenerateToolHandler)
+	r.Post("/tldraw-tool/stream", s.GenerateToolStreamHandler)
+	r.Post("/tldraw-tool/{id}/refine", s.RefineToolHandler)
+
+	r.Get("/workspaces", s.ListWorkspacesHandler)
+
+	r.Get("/tldraw-tools", s.ListToolsHandler)
+	r.Get("/tldraw-tools/{id}", s.GetToolHandler)
+	r.Get("/tldraw-tools/{id}/files/{name}", s.GetToolFileHandler)
+	r.Patch("/tldraw-tools/{id}", s.UpdateToolHandler)
+	r.Delete("/tldraw-tools/{id}", s.DeleteToolHandler)
+	r.Get("/tldraw-tools/{id}/versions", s.ListToolVersionsHandler)
+	r.Get("/tldraw-tools/{id}/versions/diff", s.DiffToolVersionsHandler)
+	r.Post("/tldraw-tools/{id}/versions/{version}/rollback", s.RollbackToolHandler)
 
 	return r
 }
 
+// StatusClientClosedRequest is the non-standard status nginx uses when the
+// client goes away before the response is ready.
+const StatusClientClosedRequest = 499
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return StatusClientClosedRequest
+	default:
+		return 500
+	}
+}
+
+// generator returns the generator of the workspace picked by the workspace
+// query parameter, or of the default workspace. Unknown workspaces get a 404.
+func (s *Server) generator(w http.ResponseWriter, r *http.Request) (*ai.Generator, bool) {
+	name := r.URL.Query().Get("workspace")
+	if name == "" {
+		name = s.config.DefaultWorkspace
+	}
+
+	generator, ok := s.generators[name]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown workspace %q", name), http.StatusNotFound)
+		return nil, false
+	}
+
+	return generator, true
+}
+
+// WorkspaceResponse leaves out the paths of the workspace, which are of no
+// use to clients and would reveal the layout of the server.
+type WorkspaceResponse struct {
+	Name    string `json:"name"`
+	Default bool   `json:"default"`
+}
+
+func (s *Server) ListWorkspacesHandler(w http.ResponseWriter, r *http.Request) {
+	workspaces := []WorkspaceResponse{}
+	for _, workspace := range s.config.Workspaces {
+		workspaces = append(workspaces, WorkspaceResponse{workspace.Name, workspace.Name == s.config.DefaultWorkspace})
+	}
+
+	writeJSON(w, workspaces)
+}
+
 type GenerateToolRequest struct {
 	Query string `json:"query"`
+	ai.GenerateOptions
 }
 
 func (s *Server) GenerateToolHandler(w http.ResponseWriter, r *http.Request) {
+	generator, ok := s.generator(w, r)
+	if !ok {
+		return
+	}
+
 	decoder := json.NewDecoder(r.Body)
 
 	body := GenerateToolRequest{}
@@ -38,13 +115,79 @@ func (s *Server) GenerateToolHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tool, err := ai.GenTldrawTool(body.Query)
+	tool, err := generator.GenTldrawTool(r.Context(), body.Query, body.GenerateOptions)
+	if errors.Is(err, ai.ErrInvalidOptions) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, ai.ErrPolicyBlocked) {
+		writePolicyBlocked(w, tool)
+		return
+	}
+	if errors.Is(err, ai.ErrWriteFailed) {
+		writeWriteFailed(w, err, tool)
+		return
+	}
 	if err != nil {
 		log.Printf("Error generating tool: %s", err)
+		w.WriteHeader(errorStatus(err))
+		return
+	}
+
+	resp, err := json.Marshal(tool)
+	if err != nil {
+		log.Printf("Error marshalling JSON: %s", err)
 		w.WriteHeader(500)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(resp)
+}
+
+type RefineToolRequest struct {
+	Query string `json:"query"`
+}
+
+func (s *Server) RefineToolHandler(w http.ResponseWriter, r *http.Request) {
+	generator, ok := s.generator(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+
+	body := RefineToolRequest{}
+	err := decoder.Decode(&body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	tool, err := generator.RefineTldrawTool(r.Context(), chi.URLParam(r, "id"), body.Query)
+	if errors.Is(err, ai.ErrInvalidToolId) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, ai.ErrToolNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ai.ErrPolicyBlocked) {
+		writePolicyBlocked(w, tool)
+		return
+	}
+	if errors.Is(err, ai.ErrWriteFailed) {
+		writeWriteFailed(w, err, nil)
+		return
+	}
+	if err != nil {
+		log.Printf("Error refining tool: %s", err)
+		w.WriteHeader(errorStatus(err))
+		return
+	}
+
 	resp, err := json.Marshal(tool)
 	if err != nil {
 		log.Printf("Error marshalling JSON: %s", err)
@@ -56,3 +199,316 @@ func (s *Server) GenerateToolHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(200)
 	w.Write(resp)
 }
+
+// writePolicyBlocked responds with the rejected tool so the client can show
+// the policy verdict.
+func writePolicyBlocked(w http.ResponseWriter, tool any) {
+	resp, err := json.Marshal(tool)
+	if err != nil {
+		log.Printf("Error marshalling JSON: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	w.Write(resp)
+}
+
+type WriteFailedResponse struct {
+	Error string `json:"error"`
+	Tool  any    `json:"tool,omitempty"`
+}
+
+// writeWriteFailed responds with why a tool could not be written, along with
+// the generated tool when there is one, so the client can still show it.
+func writeWriteFailed(w http.ResponseWriter, err error, tool any) {
+	log.Printf("Error writing tool: %s", err)
+
+	resp, marshalErr := json.Marshal(WriteFailedResponse{Error: err.Error(), Tool: tool})
+	if marshalErr != nil {
+		log.Printf("Error marshalling JSON: %s", marshalErr)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(errorStatus(err))
+	w.Write(resp)
+}
+
+func writeJSON(w http.ResponseWriter, data any) {
+	resp, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Error marshalling JSON: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(resp)
+}
+
+func (s *Server) ListToolVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	generator, ok := s.generator(w, r)
+	if !ok {
+		return
+	}
+
+	versions, err := generator.ToolVersions(chi.URLParam(r, "id"))
+	if errors.Is(err, ai.ErrInvalidToolId) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error listing tool versions: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	writeJSON(w, versions)
+}
+
+func (s *Server) DiffToolVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	generator, ok := s.generator(w, r)
+	if !ok {
+		return
+	}
+
+	from, fromErr := strconv.Atoi(r.URL.Query().Get("from"))
+	to, toErr := strconv.Atoi(r.URL.Query().Get("to"))
+	if fromErr != nil || toErr != nil {
+		http.Error(w, "from and to must be version numbers", http.StatusBadRequest)
+		return
+	}
+
+	diffs, err := generator.DiffToolVersions(chi.URLParam(r, "id"), from, to)
+	if errors.Is(err, ai.ErrInvalidToolId) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, ai.ErrVersionNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error diffing tool versions: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	writeJSON(w, diffs)
+}
+
+func (s *Server) RollbackToolHandler(w http.ResponseWriter, r *http.Request) {
+	generator, ok := s.generator(w, r)
+	if !ok {
+		return
+	}
+
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		http.Error(w, "version must be a number", http.StatusBadRequest)
+		return
+	}
+
+	rolledBack, err := generator.RollbackTool(r.Context(), chi.URLParam(r, "id"), version)
+	if errors.Is(err, ai.ErrInvalidToolId) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, ai.ErrVersionNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ai.ErrWriteFailed) {
+		writeWriteFailed(w, err, nil)
+		return
+	}
+	if err != nil {
+		log.Printf("Error rolling back tool: %s", err)
+		w.WriteHeader(errorStatus(err))
+		return
+	}
+
+	writeJSON(w, rolledBack)
+}
+
+func (s *Server) ListToolsHandler(w http.ResponseWriter, r *http.Request) {
+	generator, ok := s.generator(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	opts := ai.ListToolsOptions{Query: query.Get("q")}
+
+	offset, offsetErr := intParam(query.Get("offset"))
+	limit, limitErr := intParam(query.Get("limit"))
+	if offsetErr != nil || limitErr != nil {
+		http.Error(w, "offset and limit must be numbers", http.StatusBadRequest)
+		return
+	}
+	opts.Offset, opts.Limit = offset, limit
+
+	if raw := query.Get("enabled"); raw != "" {
+		enabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			http.Error(w, "enabled must be true or false", http.StatusBadRequest)
+			return
+		}
+		opts.Enabled = &enabled
+	}
+
+	tools, err := generator.ListTools(r.Context(), opts)
+	if errors.Is(err, ai.ErrInvalidOptions) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error listing tools: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	writeJSON(w, tools)
+}
+
+func (s *Server) GetToolHandler(w http.ResponseWriter, r *http.Request) {
+	generator, ok := s.generator(w, r)
+	if !ok {
+		return
+	}
+
+	tool, err := generator.GetTool(r.Context(), chi.URLParam(r, "id"))
+	if errors.Is(err, ai.ErrInvalidToolId) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, ai.ErrToolNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading tool: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	writeJSON(w, tool)
+}
+
+// GetToolFileHandler serves a file of an installed tool, so that clients can
+// load tools from the server instead of bundling them. Files are generated
+// code, so they are served as text that browsers will not sniff or run.
+func (s *Server) GetToolFileHandler(w http.ResponseWriter, r *http.Request) {
+	generator, ok := s.generator(w, r)
+	if !ok {
+		return
+	}
+
+	file, err := generator.ToolFile(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "name"))
+	if errors.Is(err, ai.ErrInvalidToolId) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, ai.ErrToolNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading tool file: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	sum := sha256.Sum256([]byte(file.Content))
+
+	w.Header().Set("Content-Type", fileContentType(file.Name))
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox; default-src 'none'; style-src 'unsafe-inline'")
+	http.ServeContent(w, r, "", time.Time{}, strings.NewReader(file.Content))
+}
+
+func fileContentType(name string) string {
+	switch path.Ext(name) {
+	case ".svg":
+		return "image/svg+xml"
+	case ".css":
+		return "text/css; charset=utf-8"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+func (s *Server) UpdateToolHandler(w http.ResponseWriter, r *http.Request) {
+	generator, ok := s.generator(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	patch := ai.ToolPatch{}
+	if err := decoder.Decode(&patch); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	tool, err := generator.UpdateTool(r.Context(), chi.URLParam(r, "id"), patch)
+	if errors.Is(err, ai.ErrInvalidToolId) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, ai.ErrToolNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating tool: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	writeJSON(w, tool)
+}
+
+func (s *Server) DeleteToolHandler(w http.ResponseWriter, r *http.Request) {
+	generator, ok := s.generator(w, r)
+	if !ok {
+		return
+	}
+
+	err := generator.DeleteTool(r.Context(), chi.URLParam(r, "id"))
+	if errors.Is(err, ai.ErrInvalidToolId) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, ai.ErrToolNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ai.ErrWriteFailed) {
+		writeWriteFailed(w, err, nil)
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting tool: %s", err)
+		w.WriteHeader(errorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// intParam parses an optional integer query parameter.
+func intParam(raw string) (int, error) {
+	if raw == "" {
+		return 0, nil
+	}
+
+	return strconv.Atoi(raw)
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"tlcrazy-backend/internal/ai"
+)
+
+// installTools generates the counter tool and installs copies of it as the
+// other ids, in toolbar order.
+func installTools(t *testing.T, generator *ai.Generator, ids ...string) {
+	t.Helper()
+
+	out, err := generator.GenTldrawTool(context.Background(), "a counter button", ai.GenerateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range ids {
+		tool := out.TldrawToolOutput
+		tool.Id = id
+		if _, err := generator.Store.Install(context.Background(), tool, ai.ToolEntry{Name: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func decode[T any](t *testing.T, body string) T {
+	t.Helper()
+
+	var v T
+	if err := json.Unmarshal([]byte(body), &v); err != nil {
+		t.Fatalf("Cannot decode %q: %s", body, err)
+	}
+
+	return v
+}
+
+func TestToolHandlers(t *testing.T) {
+	handler, generator := newTestServer(t, nil)
+	installTools(t, generator, "timer", "clock")
+
+	t.Run("List", func(t *testing.T) {
+		list := decode[ai.ToolList](t, serve(handler, "GET", "/tldraw-tools", "").Body.String())
+		if list.Total != 3 || len(list.Tools) != 3 || list.Limit != 50 {
+			t.Errorf("Expected all 3 tools with the default limit but got %+v", list)
+		}
+
+		list = decode[ai.ToolList](t, serve(handler, "GET", "/tldraw-tools?offset=1&limit=1", "").Body.String())
+		if list.Total != 3 || len(list.Tools) != 1 || list.Tools[0].Id != "timer" || list.Offset != 1 || list.Limit != 1 {
+			t.Errorf("Expected the second tool only but got %+v", list)
+		}
+
+		list = decode[ai.ToolList](t, serve(handler, "GET", "/tldraw-tools?q=CLO&enabled=true", "").Body.String())
+		if list.Total != 1 || list.Tools[0].Id != "clock" {
+			t.Errorf("Expected the clock tool but got %+v", list)
+		}
+
+		for _, query := range []string{"offset=one", "limit=1.5", "offset=-1", "enabled=maybe"} {
+			if rec := serve(handler, "GET", "/tldraw-tools?"+query, ""); rec.Code != 400 {
+				t.Errorf("Expected status 400 for %s but got %d", query, rec.Code)
+			}
+		}
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		rec := serve(handler, "GET", "/tldraw-tools/counter", "")
+		tool := decode[ai.InstalledTool](t, rec.Body.String())
+		if rec.Code != 200 || tool.Id != "counter" || tool.Version != 1 || len(tool.Files) != 3 {
+			t.Errorf("Expected the counter tool with its files but got %d %+v", rec.Code, tool.ToolEntry)
+		}
+
+		if rec := serve(handler, "GET", "/tldraw-tools/missing", ""); rec.Code != 404 {
+			t.Errorf("Expected status 404 but got %d", rec.Code)
+		}
+		if rec := serve(handler, "GET", "/tldraw-tools/Bad..Id", ""); rec.Code != 400 {
+			t.Errorf("Expected status 400 but got %d", rec.Code)
+		}
+	})
+
+	t.Run("Patch", func(t *testing.T) {
+		rec := serve(handler, "PATCH", "/tldraw-tools/clock", `{"name": "Clock", "enabled": false, "order": 0}`)
+		entry := decode[ai.ToolEntry](t, rec.Body.String())
+		if rec.Code != 200 || entry.Name != "Clock" || entry.Enabled || entry.Order != 0 || entry.Description != "" {
+			t.Errorf("Expected the patched entry but got %d %+v", rec.Code, entry)
+		}
+
+		list := decode[ai.ToolList](t, serve(handler, "GET", "/tldraw-tools?enabled=false", "").Body.String())
+		if list.Total != 1 || list.Tools[0].Id != "clock" {
+			t.Errorf("Expected clock to be disabled but got %+v", list)
+		}
+		list = decode[ai.ToolList](t, serve(handler, "GET", "/tldraw-tools", "").Body.String())
+		if list.Tools[0].Id != "clock" {
+			t.Errorf("Expected clock to move first but got %+v", list.Tools)
+		}
+
+		for _, test := range []struct {
+			target, body string
+			want         int
+		}{
+			{"/tldraw-tools/clock", `{"color": "red"}`, 400},
+			{"/tldraw-tools/clock", `{"name": `, 400},
+			{"/tldraw-tools/clock", `{"enabled": "no"}`, 400},
+			{"/tldraw-tools/missing", `{"name": "Missing"}`, 404},
+			{"/tldraw-tools/Bad..Id", `{"name": "Bad"}`, 400},
+		} {
+			if rec := serve(handler, "PATCH", test.target, test.body); rec.Code != test.want {
+				t.Errorf("Expected status %d for %s %s but got %d", test.want, test.target, test.body, rec.Code)
+			}
+		}
+	})
+
+	t.Run("Files", func(t *testing.T) {
+		rec := serve(handler, "GET", "/tldraw-tools/counter/files/icon.svg", "")
+		if rec.Code != 200 || rec.Header().Get("Content-Type") != "image/svg+xml" || !strings.HasPrefix(rec.Body.String(), "<svg") {
+			t.Errorf("Expected the icon but got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+		}
+		if rec.Header().Get("X-Content-Type-Options") != "nosniff" || !strings.HasPrefix(rec.Header().Get("Content-Security-Policy"), "sandbox") {
+			t.Errorf("Expected the file to be sandboxed but got %v", rec.Header())
+		}
+
+		rec = serve(handler, "GET", "/tldraw-tools/counter/files/util.tsx", "")
+		if rec.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+			t.Errorf("Expected code to be served as text but got %s", rec.Header().Get("Content-Type"))
+		}
+
+		etag := rec.Header().Get("ETag")
+		cached := newRequest("GET", "/tldraw-tools/counter/files/util.tsx")
+		cached.Header.Set("If-None-Match", etag)
+		if rec := serveRequest(handler, cached); etag == "" || rec.Code != 304 {
+			t.Errorf("Expected status 304 for the ETag %q but got %d", etag, rec.Code)
+		}
+
+		if rec := serve(handler, "GET", "/tldraw-tools/counter/files/missing.ts", ""); rec.Code != 404 {
+			t.Errorf("Expected status 404 but got %d", rec.Code)
+		}
+		if rec := serve(handler, "GET", "/tldraw-tools/Bad..Id/files/util.tsx", ""); rec.Code != 400 {
+			t.Errorf("Expected status 400 but got %d", rec.Code)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		if rec := serve(handler, "DELETE", "/tldraw-tools/timer", ""); rec.Code != 204 {
+			t.Errorf("Expected status 204 but got %d", rec.Code)
+		}
+		if rec := serve(handler, "DELETE", "/tldraw-tools/timer", ""); rec.Code != 404 {
+			t.Errorf("Expected status 404 after the delete but got %d", rec.Code)
+		}
+		if rec := serve(handler, "GET", "/tldraw-tools/timer", ""); rec.Code != 404 {
+			t.Errorf("Expected status 404 after the delete but got %d", rec.Code)
+		}
+		if rec := serve(handler, "DELETE", "/tldraw-tools/Bad..Id", ""); rec.Code != 400 {
+			t.Errorf("Expected status 400 but got %d", rec.Code)
+		}
+	})
+}
+
+func TestToolVersionHandlers(t *testing.T) {
+	handler, generator := newTestServer(t, nil)
+	installTools(t, generator)
+
+	tool, err := generator.Store.Tool(context.Background(), "counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tool.Util += "\n// changed\n"
+	if _, err := generator.History.Add(tool, ai.ToolVersion{Action: "refine"}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("List", func(t *testing.T) {
+		rec := serve(handler, "GET", "/tldraw-tools/counter/versions", "")
+		versions := decode[[]ai.ToolVersion](t, rec.Body.String())
+		if rec.Code != 200 || len(versions) != 2 || versions[0].Action != "generate" || versions[1].Version != 2 {
+			t.Errorf("Expected the generate and refine versions but got %d %+v", rec.Code, versions)
+		}
+
+		versions = decode[[]ai.ToolVersion](t, serve(handler, "GET", "/tldraw-tools/missing/versions", "").Body.String())
+		if len(versions) != 0 {
+			t.Errorf("Expected no versions but got %+v", versions)
+		}
+
+		if rec := serve(handler, "GET", "/tldraw-tools/Bad..Id/versions", ""); rec.Code != 400 {
+			t.Errorf("Expected status 400 but got %d", rec.Code)
+		}
+	})
+
+	t.Run("Diff", func(t *testing.T) {
+		rec := serve(handler, "GET", "/tldraw-tools/counter/versions/diff?from=1&to=2", "")
+		diffs := decode[[]ai.FileDiff](t, rec.Body.String())
+		if rec.Code != 200 || len(diffs) != 1 || diffs[0].File != "util.tsx" || diffs[0].Status != "modified" || !strings.Contains(diffs[0].Diff, "+// changed") {
+			t.Errorf("Expected util.tsx to be modified but got %d %+v", rec.Code, diffs)
+		}
+
+		for _, test := range []struct {
+			query string
+			want  int
+		}{
+			{"from=1&to=9", 404},
+			{"from=1", 400},
+			{"from=one&to=2", 400},
+		} {
+			if rec := serve(handler, "GET", "/tldraw-tools/counter/versions/diff?"+test.query, ""); rec.Code != test.want {
+				t.Errorf("Expected status %d for %s but got %d", test.want, test.query, rec.Code)
+			}
+		}
+		if rec := serve(handler, "GET", "/tldraw-tools/Bad..Id/versions/diff?from=1&to=2", ""); rec.Code != 400 {
+			t.Errorf("Expected status 400 but got %d", rec.Code)
+		}
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		for _, test := range []struct {
+			target string
+			want   int
+		}{
+			{"/tldraw-tools/counter/versions/9/rollback", 404},
+			{"/tldraw-tools/missing/versions/1/rollback", 404},
+			{"/tldraw-tools/counter/versions/latest/rollback", 400},
+			{"/tldraw-tools/Bad..Id/versions/1/rollback", 400},
+		} {
+			if rec := serve(handler, "POST", test.target, ""); rec.Code != test.want {
+				t.Errorf("Expected status %d for %s but got %d", test.want, test.target, rec.Code)
+			}
+		}
+
+		rec := serve(handler, "POST", "/tldraw-tools/counter/versions/2/rollback", "")
+		version := decode[ai.ToolVersion](t, rec.Body.String())
+		if rec.Code != 200 || version.Version != 3 || version.Action != "rollback" || version.RolledBackTo != 2 || len(version.Files) != 3 {
+			t.Errorf("Expected version 3 rolling back to 2 but got %d %+v", rec.Code, version)
+		}
+
+		file := serve(handler, "GET", "/tldraw-tools/counter/files/util.tsx", "").Body.String()
+		if !strings.HasSuffix(file, "// changed\n") {
+			t.Errorf("Expected the rolled back util.tsx to be installed but got %q", file)
+		}
+	})
+}
@@ -4,19 +4,46 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
+	"time"
+
+	"tlcrazy-backend/internal/ai"
+	"tlcrazy-backend/internal/config"
+	"tlcrazy-backend/internal/typecheck"
+	"tlcrazy-backend/internal/validator"
 
 	_ "github.com/joho/godotenv/autoload"
 )
 
 type Server struct {
 	port int
+
+	config *config.Config
+
+	// generators holds a generator per workspace by name
+	generators map[string]*ai.Generator
 }
 
-func NewServer() *http.Server {
+func NewServer(cfg *config.Config) *http.Server {
 	port, _ := strconv.Atoi(os.Getenv("PORT"))
+
+	provider, err := ai.NewProviderFromEnv()
+	if err != nil {
+		panic(fmt.Sprintf("cannot create LLM provider: %s", err))
+	}
+
+	generator := newGenerator(provider, cfg.Generator)
+
+	generators := map[string]*ai.Generator{}
+	for _, workspace := range cfg.Workspaces {
+		generators[workspace.Name] = newWorkspaceGenerator(generator, workspace, workspace.Name == cfg.DefaultWorkspace)
+	}
+
 	NewServer := &Server{
-		port: port,
+		port:       port,
+		config:     cfg,
+		generators: generators,
 	}
 
 	// Declare Server config
@@ -27,3 +54,104 @@ func NewServer() *http.Server {
 
 	return server
 }
+
+// newGenerator applies the settings in cfg, which were validated when the
+// config was loaded, to a generator for provider.
+func newGenerator(provider ai.Provider, cfg config.Generator) *ai.Generator {
+	generator := ai.NewGenerator(provider)
+	if cfg.SessionsDir != "" {
+		generator.Sessions = ai.NewSessionStore(cfg.SessionsDir)
+	}
+	if cfg.HistoryDir != "" {
+		generator.History = ai.NewHistoryStore(cfg.HistoryDir)
+	}
+
+	for _, limit := range []struct {
+		value  *int
+		target *int
+	}{
+		{cfg.MaxRepairs, &generator.MaxRepairs},
+		{cfg.MaxTokens, &generator.MaxTokens},
+		{cfg.MaxContinuations, &generator.MaxContinuations},
+		{cfg.MaxCandidates, &generator.MaxCandidates},
+		{cfg.MaxConcurrency, &generator.MaxConcurrency},
+		{cfg.MaxTypeFixes, &generator.MaxTypeFixes},
+	} {
+		if limit.value != nil {
+			*limit.target = *limit.value
+		}
+	}
+
+	if cfg.Mode != "" {
+		generator.DefaultMode = cfg.Mode
+	}
+	generator.Timeouts.Generate = time.Duration(cfg.GenerateTimeout)
+	generator.Timeouts.Write = time.Duration(cfg.WriteTimeout)
+
+	if cfg.TypeCheck {
+		// The app path is set per workspace
+		generator.TypeChecker = typecheck.NewChecker("")
+		if cfg.TypeCheckTimeout > 0 {
+			generator.TypeChecker.Timeout = time.Duration(cfg.TypeCheckTimeout)
+		}
+	}
+
+	if cfg.ValidatorRules != "" {
+		rules, err := validator.LoadFile(cfg.ValidatorRules)
+		if err != nil {
+			panic(fmt.Sprintf("cannot load validator rules: %s", err))
+		}
+		generator.Validator = rules
+	}
+	if cfg.PolicyFile != "" {
+		policy, err := ai.LoadPolicyFile(cfg.PolicyFile)
+		if err != nil {
+			panic(fmt.Sprintf("cannot load security policy: %s", err))
+		}
+		generator.Policy = policy
+	}
+	if cfg.AuditLog != "" {
+		generator.Audit = ai.NewAuditLog(cfg.AuditLog)
+	}
+
+	return generator
+}
+
+// newWorkspaceGenerator copies base for workspace. Tool ids are only unique
+// within a workspace, so each one other than the default keeps its sessions
+// and history in a directory of its own.
+func newWorkspaceGenerator(base *ai.Generator, workspace config.Workspace, isDefault bool) *ai.Generator {
+	generator := *base
+	generator.Workspace = workspace
+
+	switch workspace.Store {
+	case config.StoreMemory:
+		generator.Store = ai.NewMemoryToolStore()
+	case config.StoreSQLite:
+		store, err := ai.OpenSQLiteToolStore(workspace.Database)
+		if err != nil {
+			panic(fmt.Sprintf("cannot open tool store: %s", err))
+		}
+		generator.Store = store
+	}
+
+	// Type checking needs the frontend app
+	generator.TypeChecker = nil
+	if base.TypeChecker != nil && workspace.Root != "" {
+		checker := *base.TypeChecker
+		checker.AppPath = workspace.Root
+		checker.ToolsDir = workspace.ToolsDir
+		generator.TypeChecker = &checker
+	}
+
+	if !isDefault {
+		if base.Sessions != nil {
+			generator.Sessions = ai.NewSessionStore(filepath.Join(base.Sessions.Dir, "workspaces", workspace.Name))
+		}
+		if base.History != nil {
+			generator.History = ai.NewHistoryStore(filepath.Join(base.History.Dir, "workspaces", workspace.Name))
+		}
+	}
+
+	return &generator
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"tlcrazy-backend/internal/ai"
+	"tlcrazy-backend/internal/config"
+)
+
+// newTestServer serves a default and an other workspace, both keeping their
+// tools in memory. The default one generates with provider, or with the
+// output of the fake provider when provider is nil.
+func newTestServer(t *testing.T, provider ai.Provider) (http.Handler, *ai.Generator) {
+	t.Helper()
+
+	if provider == nil {
+		t.Setenv("LLM_PROVIDER", "fake")
+		t.Setenv("FAKE_PROVIDER_OUTPUT", "")
+
+		var err error
+		provider, err = ai.NewProviderFromEnv()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := &config.Config{
+		DefaultWorkspace: "default",
+		Workspaces: []config.Workspace{
+			{Name: "default", Root: "/srv/app", Store: config.StoreMemory},
+			{Name: "other", Store: config.StoreMemory},
+		},
+	}
+
+	generators := map[string]*ai.Generator{}
+	for _, workspace := range cfg.Workspaces {
+		generator := ai.NewGenerator(provider)
+		generator.Workspace = workspace
+		generator.Store = ai.NewMemoryToolStore()
+		generator.Sessions = ai.NewSessionStore(t.TempDir())
+		generator.History = ai.NewHistoryStore(t.TempDir())
+		generator.Audit = nil
+		generators[workspace.Name] = generator
+	}
+
+	s := &Server{config: cfg, generators: generators}
+	return s.RegisterRoutes(), generators["default"]
+}
+
+// serve sends a request with an optional JSON body to handler.
+func serve(handler http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	return serveRequest(handler, httptest.NewRequest(method, target, strings.NewReader(body)))
+}
+
+func newRequest(method, target string) *http.Request {
+	return httptest.NewRequest(method, target, nil)
+}
+
+func serveRequest(handler http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestListWorkspaces(t *testing.T) {
+	handler, _ := newTestServer(t, nil)
+
+	rec := serve(handler, "GET", "/workspaces", "")
+	if rec.Code != 200 {
+		t.Fatalf("Expected status 200 but got %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "/srv/app") {
+		t.Errorf("Expected no paths in the response but got %s", rec.Body)
+	}
+
+	var workspaces []WorkspaceResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &workspaces); err != nil {
+		t.Fatal(err)
+	}
+	want := []WorkspaceResponse{{Name: "default", Default: true}, {Name: "other"}}
+	if !reflect.DeepEqual(workspaces, want) {
+		t.Errorf("Expected %+v\nbut got %+v", want, workspaces)
+	}
+
+	if rec := serve(handler, "GET", "/tldraw-tools?workspace=missing", ""); rec.Code != 404 {
+		t.Errorf("Expected status 404 for an unknown workspace but got %d", rec.Code)
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"tlcrazy-backend/internal/ai"
+)
+
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (s *sseWriter) send(event string, data any) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Error marshalling SSE data: %s", err)
+		return
+	}
+
+	fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, payload)
+	s.flusher.Flush()
+}
+
+type streamErrorData struct {
+	Error string `json:"error"`
+}
+
+func (s *Server) GenerateToolStreamHandler(w http.ResponseWriter, r *http.Request) {
+	generator, ok := s.generator(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+
+	body := GenerateToolRequest{}
+	err := decoder.Decode(&body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		log.Println("Error streaming tool: response writer does not support flushing")
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(200)
+	flusher.Flush()
+
+	sse := &sseWriter{w: w, flusher: flusher}
+
+	_, err = generator.GenTldrawToolStream(r.Context(), body.Query, body.GenerateOptions, func(event ai.StreamEvent) {
+		sse.send(string(event.Type), event.Data)
+	})
+	if err != nil {
+		log.Printf("Error generating tool: %s", err)
+		sse.send("error", streamErrorData{Error: err.Error()})
+	}
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"tlcrazy-backend/internal/ai"
+)
+
+type sseEvent struct {
+	event string
+	data  string
+}
+
+func readEvents(t *testing.T, body string) []sseEvent {
+	t.Helper()
+
+	events := []sseEvent{}
+	current := sseEvent{}
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			events = append(events, current)
+			current = sseEvent{}
+		case strings.HasPrefix(line, "event: "):
+			current.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			current.data = strings.TrimPrefix(line, "data: ")
+		default:
+			t.Fatalf("Unexpected line %q in the stream", line)
+		}
+	}
+
+	return events
+}
+
+func TestGenerateToolStream(t *testing.T) {
+	t.Run("Event sequence", func(t *testing.T) {
+		handler, generator := newTestServer(t, nil)
+
+		rec := serve(handler, "POST", "/tldraw-tool/stream", `{"query": "a counter button"}`)
+		if rec.Code != 200 || rec.Header().Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("Expected an event stream but got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+		}
+
+		events := readEvents(t, rec.Body.String())
+		if len(events) < 6 {
+			t.Fatalf("Expected at least 6 events but got %+v", events)
+		}
+
+		// Deltas and the tool and file events interleave while streaming,
+		// validation and done come last
+		if events[0].event != "delta" {
+			t.Errorf("Expected the stream to start with a delta but got %q", events[0].event)
+		}
+		kinds := map[string]int{}
+		files := []string{}
+		text := ""
+		for i, event := range events[:len(events)-2] {
+			kinds[event.event]++
+			switch event.event {
+			case "delta":
+				var delta ai.DeltaEventData
+				if err := json.Unmarshal([]byte(event.data), &delta); err != nil {
+					t.Fatal(err)
+				}
+				text += delta.Text
+			case "tool":
+				if event.data != `{"id":"counter"}` || len(files) > 0 {
+					t.Errorf("Expected the tool event before the files but got %q at %d", event.data, i)
+				}
+			case "file":
+				var file ai.TldrawXMLFile
+				if err := json.Unmarshal([]byte(event.data), &file); err != nil {
+					t.Fatal(err)
+				}
+				files = append(files, file.Name)
+			default:
+				t.Errorf("Unexpected %q event before validation", event.event)
+			}
+		}
+		if kinds["tool"] != 1 || strings.Join(files, ",") != "tool.ts,util.tsx,icon.svg" {
+			t.Errorf("Expected one tool event and a file event per file but got %v and %q", kinds, files)
+		}
+		if !strings.Contains(text, `<tool id="counter">`) {
+			t.Error("Expected the deltas to add up to the model output")
+		}
+
+		validation, done := events[len(events)-2], events[len(events)-1]
+		var result ai.ValidationResult
+		if err := json.Unmarshal([]byte(validation.data), &result); validation.event != "validation" || err != nil || !result.Valid {
+			t.Errorf("Expected a valid validation event but got %+v", validation)
+		}
+		var out ai.GenerateOutput
+		if err := json.Unmarshal([]byte(done.data), &out); done.event != "done" || err != nil || out.Id != "counter" {
+			t.Errorf("Expected a done event with the tool but got %+v", done)
+		}
+
+		if _, err := generator.GetTool(context.Background(), "counter"); err != nil {
+			t.Error("Expected the tool to be installed", err)
+		}
+	})
+
+	t.Run("Generation error", func(t *testing.T) {
+		handler, _ := newTestServer(t, ai.NewFakeProviderWithResponses())
+
+		rec := serve(handler, "POST", "/tldraw-tool/stream", `{"query": "a counter button"}`)
+		events := readEvents(t, rec.Body.String())
+		if len(events) != 1 || events[0].event != "error" {
+			t.Fatalf("Expected a single error event but got %+v", events)
+		}
+
+		var data streamErrorData
+		if err := json.Unmarshal([]byte(events[0].data), &data); err != nil || !strings.Contains(data.Error, "no responses") {
+			t.Errorf("Expected the error of the provider but got %q", events[0].data)
+		}
+	})
+
+	t.Run("Invalid body", func(t *testing.T) {
+		handler, _ := newTestServer(t, nil)
+
+		if rec := serve(handler, "POST", "/tldraw-tool/stream", `{"query": `); rec.Code != 400 {
+			t.Errorf("Expected status 400 but got %d", rec.Code)
+		}
+	})
+}
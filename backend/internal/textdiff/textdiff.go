@@ -0,0 +1,125 @@
+// Package textdiff renders line diffs between versions of a generated file in
+// the unified format.
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Context is how many unchanged lines surround each change.
+const Context = 3
+
+type op struct {
+	kind byte // ' ', '-' or '+'
+	text string
+	// a and b count the lines of each side before this op
+	a, b int
+}
+
+// Unified returns the unified diff turning a into b, or "" when their lines
+// are the same.
+func Unified(fromName, toName, a, b string) string {
+	ops := diff(splitLines(a), splitLines(b))
+
+	changes := []int{}
+	for i, o := range ops {
+		if o.kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+
+	for i := 0; i < len(changes); {
+		start := max(changes[i]-Context, 0)
+		last := changes[i]
+		i++
+		for i < len(changes) && changes[i]-last-1 <= 2*Context {
+			last = changes[i]
+			i++
+		}
+		hunk := ops[start:min(last+Context+1, len(ops))]
+
+		aCount, bCount := 0, 0
+		for _, o := range hunk {
+			if o.kind != '+' {
+				aCount++
+			}
+			if o.kind != '-' {
+				bCount++
+			}
+		}
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", formatRange(hunk[0].a, aCount), formatRange(hunk[0].b, bCount))
+		for _, o := range hunk {
+			out.WriteByte(o.kind)
+			out.WriteString(o.text)
+			out.WriteByte('\n')
+		}
+	}
+
+	return out.String()
+}
+
+// formatRange formats a hunk range like GNU diff, where start counts the
+// lines before the hunk.
+func formatRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, count)
+	}
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diff finds the edit script through the longest common subsequence of the
+// lines. Generated files are small enough for the quadratic table.
+func diff(a, b []string) []op {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]op, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, op{' ', a[i], i, j})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, op{'-', a[i], i, j})
+			i++
+		default:
+			ops = append(ops, op{'+', b[j], i, j})
+			j++
+		}
+	}
+
+	return ops
+}
@@ -0,0 +1,252 @@
+// Package typecheck compiles a generated tool with the frontend's TypeScript
+// compiler without touching the frontend itself.
+package typecheck
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnavailable is returned when Node or the TypeScript compiler cannot be
+// found, in which case the check should be skipped.
+var ErrUnavailable = errors.New("typescript compiler unavailable")
+
+const (
+	defaultTimeout  = 60 * time.Second
+	defaultToolsDir = "components/tldraw-custom-tools"
+	configName      = "tsconfig.tlcrazy-check.json"
+)
+
+type File struct {
+	Name    string
+	Content string
+}
+
+type Diagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s(%d,%d): %s %s: %s", d.File, d.Line, d.Column, d.Severity, d.Code, d.Message)
+}
+
+// Checker type checks tools against the frontend at AppPath. Tools live in
+// ToolsDir, relative to AppPath.
+type Checker struct {
+	AppPath  string
+	ToolsDir string
+	Timeout  time.Duration
+
+	// Command runs the compiler. It defaults to the frontend's own tsc
+	// through node; the project flags are appended to it.
+	Command []string
+}
+
+func NewChecker(appPath string) *Checker {
+	return &Checker{AppPath: appPath, ToolsDir: defaultToolsDir, Timeout: defaultTimeout}
+}
+
+func (c *Checker) toolsDir() string {
+	if c.ToolsDir == "" {
+		return defaultToolsDir
+	}
+
+	return filepath.Clean(c.ToolsDir)
+}
+
+func (c *Checker) command() ([]string, error) {
+	if len(c.Command) > 0 {
+		return c.Command, nil
+	}
+
+	node, err := exec.LookPath("node")
+	if err != nil {
+		return nil, fmt.Errorf("%w: node not found", ErrUnavailable)
+	}
+
+	tsc := filepath.Join(c.AppPath, "node_modules/typescript/bin/tsc")
+	if _, err := os.Stat(tsc); err != nil {
+		return nil, fmt.Errorf("%w: %s not found", ErrUnavailable, tsc)
+	}
+
+	return []string{node, tsc}, nil
+}
+
+// Check writes files as the tool toolId into a scratch copy of the frontend
+// and runs tsc --noEmit on them. Only diagnostics in the tool's own files are
+// returned, with File set to the tool file name.
+func (c *Checker) Check(ctx context.Context, toolId string, files []File) ([]Diagnostic, error) {
+	command, err := c.command()
+	if err != nil {
+		return nil, err
+	}
+
+	scratch, err := os.MkdirTemp("", "tlcrazy-typecheck-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(scratch)
+
+	if err := c.prepare(scratch, toolId, files); err != nil {
+		return nil, fmt.Errorf("cannot prepare scratch copy: %w", err)
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	args := append(command[1:len(command):len(command)], "--noEmit", "--pretty", "false", "-p", configName)
+	cmd := exec.CommandContext(ctx, command[0], args...)
+	cmd.Dir = scratch
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	runErr := cmd.Run()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("tsc did not finish: %w", ctx.Err())
+	}
+
+	diagnostics := parseOutput(output.String(), filepath.ToSlash(filepath.Join(c.toolsDir(), toolId))+"/")
+
+	// tsc also exits non-zero when it reports diagnostics
+	if runErr != nil && !hasDiagnostics(output.String()) {
+		return nil, fmt.Errorf("tsc failed: %v: %s", runErr, strings.TrimSpace(output.String()))
+	}
+
+	return diagnostics, nil
+}
+
+// prepare lays out scratch as the frontend by symlinking everything except
+// the path down to the tool folder, which is recreated with the new files.
+func (c *Checker) prepare(scratch, toolId string, files []File) error {
+	toolsDir := c.toolsDir()
+	toolDir := filepath.Join(scratch, toolsDir, toolId)
+
+	dirs := []string{""}
+	for dir := toolsDir; dir != "."; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(filepath.Join(c.AppPath, dir))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(filepath.Join(scratch, dir), 0755); err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			rel := filepath.Join(dir, entry.Name())
+			if isAncestor(rel, filepath.Join(toolsDir, toolId)) || entry.Name() == configName {
+				continue
+			}
+			if err := os.Symlink(filepath.Join(c.AppPath, rel), filepath.Join(scratch, rel)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := os.MkdirAll(toolDir, 0755); err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := os.WriteFile(filepath.Join(toolDir, file.Name), []byte(file.Content), 0644); err != nil {
+			return err
+		}
+	}
+
+	config := map[string]any{
+		"compilerOptions": map[string]any{"noEmit": true, "incremental": false},
+		"include":         []string{"*.d.ts", filepath.ToSlash(filepath.Join(toolsDir, toolId)) + "/**/*"},
+	}
+	if _, err := os.Stat(filepath.Join(c.AppPath, "tsconfig.json")); err == nil {
+		config["extends"] = "./tsconfig.json"
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(scratch, configName), data, 0644)
+}
+
+func isAncestor(dir, path string) bool {
+	return dir == path || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+var diagnosticPattern = regexp.MustCompile(`^(.+?)\((\d+),(\d+)\): (error|warning|message) (TS\d+): (.*)$`)
+
+func hasDiagnostics(output string) bool {
+	for _, line := range strings.Split(output, "\n") {
+		if diagnosticPattern.MatchString(line) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseOutput reads tsc's non-pretty output and keeps the diagnostics of
+// files under prefix. Indented lines continue the previous message.
+func parseOutput(output, prefix string) []Diagnostic {
+	diagnostics := []Diagnostic{}
+	keep := false
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		m := diagnosticPattern.FindStringSubmatch(line)
+		if m == nil {
+			if keep && strings.HasPrefix(line, " ") && len(diagnostics) > 0 {
+				diagnostics[len(diagnostics)-1].Message += "\n" + strings.TrimSpace(line)
+			}
+			continue
+		}
+
+		file := filepath.ToSlash(m[1])
+		keep = strings.HasPrefix(file, prefix)
+		if !keep {
+			continue
+		}
+
+		lineNo, _ := strconv.Atoi(m[2])
+		column, _ := strconv.Atoi(m[3])
+		diagnostics = append(diagnostics, Diagnostic{
+			File:     strings.TrimPrefix(file, prefix),
+			Line:     lineNo,
+			Column:   column,
+			Severity: m[4],
+			Code:     m[5],
+			Message:  m[6],
+		})
+	}
+
+	return diagnostics
+}
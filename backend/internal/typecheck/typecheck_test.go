@@ -0,0 +1,147 @@
+package typecheck
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseOutput(t *testing.T) {
+	output := `components/tldraw-custom-tools/counter/util.tsx(12,5): error TS2322: Type 'string' is not assignable to type 'number'.
+  The expected type comes from property 'count'.
+components/other/index.ts(1,1): error TS2307: Cannot find module 'x'.
+  Unrelated continuation.
+components/tldraw-custom-tools/counter/tool.ts(3,1): warning TS6133: 'x' is declared but its value is never read.
+`
+
+	got := parseOutput(output, "components/tldraw-custom-tools/counter/")
+	want := []Diagnostic{
+		{File: "util.tsx", Line: 12, Column: 5, Severity: "error", Code: "TS2322", Message: "Type 'string' is not assignable to type 'number'.\nThe expected type comes from property 'count'."},
+		{File: "tool.ts", Line: 3, Column: 1, Severity: "warning", Code: "TS6133", Message: "'x' is declared but its value is never read."},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v\nbut got %+v", want, got)
+	}
+}
+
+// newFakeTsc writes a shell script standing in for tsc. It runs in the
+// scratch copy, so it can check the layout and the files it was given.
+func newFakeTsc(t *testing.T, script string) []string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "tsc.sh")
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return []string{"sh", path}
+}
+
+func newTestApp(t *testing.T) string {
+	t.Helper()
+
+	appPath := t.TempDir()
+	for _, dir := range []string{"node_modules/tldraw", "components/tldraw-custom-tools/existing", "components/ui"} {
+		if err := os.MkdirAll(filepath.Join(appPath, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(appPath, "tsconfig.json"), []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return appPath
+}
+
+func TestCheck(t *testing.T) {
+	appPath := newTestApp(t)
+
+	checker := NewChecker(appPath)
+	checker.Command = newFakeTsc(t, `
+test -L node_modules || { echo "node_modules is not linked"; exit 1; }
+test -L components/ui || { echo "components/ui is not linked"; exit 1; }
+test -L components/tldraw-custom-tools/existing || { echo "other tools are not linked"; exit 1; }
+grep -q '"extends":"./tsconfig.json"' tsconfig.tlcrazy-check.json || { echo "config does not extend the app"; exit 1; }
+if grep -q BROKEN components/tldraw-custom-tools/counter/util.tsx; then
+	echo "components/tldraw-custom-tools/counter/util.tsx(1,7): error TS2322: Type 'string' is not assignable to type 'number'."
+	exit 2
+fi
+`)
+
+	files := []File{{"tool.ts", "export default class {}"}, {"util.tsx", "const BROKEN: number = ''"}}
+	got, err := checker.Check(context.Background(), "counter", files)
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+	if len(got) != 1 || got[0].File != "util.tsx" || got[0].Code != "TS2322" {
+		t.Errorf("Expected a TS2322 error in util.tsx but got %+v", got)
+	}
+
+	files[1].Content = "const count: number = 0"
+	got, err = checker.Check(context.Background(), "counter", files)
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Expected no diagnostics but got %+v", got)
+	}
+
+	if _, err := os.Stat(filepath.Join(appPath, "components/tldraw-custom-tools/counter")); !os.IsNotExist(err) {
+		t.Error("Expected the app to be left untouched")
+	}
+
+	t.Run("Custom tools dir", func(t *testing.T) {
+		checker := NewChecker(appPath)
+		checker.ToolsDir = "src/tools"
+		checker.Command = newFakeTsc(t, `
+test -f src/tools/counter/util.tsx || { echo "tool is not in src/tools"; exit 1; }
+echo "src/tools/counter/util.tsx(1,7): error TS2322: Type 'string' is not assignable to type 'number'."
+exit 2
+`)
+
+		got, err := checker.Check(context.Background(), "counter", files)
+		if err != nil {
+			t.Fatal("Got an error but didn't expect one", err)
+		}
+		if len(got) != 1 || got[0].File != "util.tsx" {
+			t.Errorf("Expected an error in util.tsx but got %+v", got)
+		}
+	})
+}
+
+func TestCheckFailures(t *testing.T) {
+	appPath := newTestApp(t)
+
+	t.Run("Compiler unavailable", func(t *testing.T) {
+		_, err := NewChecker(appPath).Check(context.Background(), "counter", nil)
+		if !errors.Is(err, ErrUnavailable) {
+			t.Errorf("Expected ErrUnavailable but got %v", err)
+		}
+	})
+
+	t.Run("Compiler crash", func(t *testing.T) {
+		checker := NewChecker(appPath)
+		checker.Command = newFakeTsc(t, "echo 'Cannot read file tsconfig.json'\nexit 1\n")
+
+		_, err := checker.Check(context.Background(), "counter", nil)
+		if err == nil || !strings.Contains(err.Error(), "Cannot read file") {
+			t.Errorf("Expected the compiler output in the error but got %v", err)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		checker := NewChecker(appPath)
+		checker.Command = newFakeTsc(t, "exec sleep 5\n")
+		checker.Timeout = 50 * time.Millisecond
+
+		_, err := checker.Check(context.Background(), "counter", nil)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected a deadline error but got %v", err)
+		}
+	})
+}
@@ -0,0 +1,208 @@
+// Package validator statically checks generated tool code against the rules
+// the model is asked to follow. Rules are data: a pattern, the files it
+// applies to and whether a match is required or forbidden.
+package validator
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+type Rule struct {
+	Id       string   `json:"id"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	// Files are path.Match patterns of the file names the rule applies to.
+	Files   []string `json:"files"`
+	Pattern string   `json:"pattern"`
+	// Require flags files where the pattern is missing. Otherwise every
+	// match of the pattern is flagged.
+	Require bool `json:"require,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// Diagnostic is one rule violation. Line is 1-based and 0 when the rule is
+// about the file as a whole.
+type Diagnostic struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	File     string   `json:"file"`
+	Line     int      `json:"line,omitempty"`
+}
+
+func (d Diagnostic) String() string {
+	if d.Line == 0 {
+		return fmt.Sprintf("%s: %s [%s]", d.File, d.Message, d.Rule)
+	}
+
+	return fmt.Sprintf("%s:%d: %s [%s]", d.File, d.Line, d.Message, d.Rule)
+}
+
+type File struct {
+	Name    string
+	Content string
+}
+
+type Validator struct {
+	rules []Rule
+}
+
+//go:embed rules.json
+var defaultRules []byte
+
+var defaultValidator *Validator
+
+func init() {
+	var err error
+	defaultValidator, err = Parse(defaultRules)
+	if err != nil {
+		panic(fmt.Sprintf("cannot load default validator rules: %s", err))
+	}
+}
+
+// Default returns the validator for the rules embedded in the binary.
+func Default() *Validator {
+	return defaultValidator
+}
+
+// New compiles rules into a validator.
+func New(rules []Rule) (*Validator, error) {
+	seen := map[string]bool{}
+	compiled := make([]Rule, 0, len(rules))
+
+	for i, rule := range rules {
+		if rule.Id == "" {
+			return nil, fmt.Errorf("rule %d has no id", i)
+		}
+		if seen[rule.Id] {
+			return nil, fmt.Errorf("duplicate rule %q", rule.Id)
+		}
+		seen[rule.Id] = true
+
+		switch rule.Severity {
+		case SeverityError, SeverityWarning, SeverityInfo:
+		case "":
+			rule.Severity = SeverityError
+		default:
+			return nil, fmt.Errorf("rule %q has unknown severity %q", rule.Id, rule.Severity)
+		}
+
+		if len(rule.Files) == 0 {
+			return nil, fmt.Errorf("rule %q applies to no files", rule.Id)
+		}
+		for _, pattern := range rule.Files {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("rule %q has invalid file pattern %q: %v", rule.Id, pattern, err)
+			}
+		}
+
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q has invalid pattern: %v", rule.Id, err)
+		}
+		rule.re = re
+
+		compiled = append(compiled, rule)
+	}
+
+	return &Validator{rules: compiled}, nil
+}
+
+// Parse reads rules from their JSON form, a list of Rule objects.
+func Parse(data []byte) (*Validator, error) {
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid rules: %v", err)
+	}
+
+	return New(rules)
+}
+
+// LoadFile reads rules from a JSON file, so rules can change without a new
+// build.
+func LoadFile(name string) (*Validator, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
+
+func (v *Validator) Rules() []Rule {
+	return v.rules
+}
+
+// Check runs every rule against the files it applies to. Diagnostics are
+// ordered by rule, then file, then line.
+func (v *Validator) Check(files []File) []Diagnostic {
+	diagnostics := []Diagnostic{}
+
+	for _, rule := range v.rules {
+		for _, file := range files {
+			if !rule.appliesTo(file.Name) {
+				continue
+			}
+
+			if rule.Require {
+				if !rule.re.MatchString(file.Content) {
+					diagnostics = append(diagnostics, rule.diagnostic(file.Name, 0))
+				}
+				continue
+			}
+
+			for _, match := range rule.re.FindAllStringIndex(file.Content, -1) {
+				line := strings.Count(file.Content[:match[0]], "\n") + 1
+				diagnostics = append(diagnostics, rule.diagnostic(file.Name, line))
+			}
+		}
+	}
+
+	return diagnostics
+}
+
+func (r Rule) appliesTo(name string) bool {
+	for _, pattern := range r.Files {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r Rule) diagnostic(file string, line int) Diagnostic {
+	return Diagnostic{
+		Rule:     r.Id,
+		Severity: r.Severity,
+		Message:  r.Message,
+		File:     file,
+		Line:     line,
+	}
+}
+
+// HasErrors reports whether any diagnostic has error severity.
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+
+	return false
+}
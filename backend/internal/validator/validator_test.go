@@ -0,0 +1,90 @@
+package validator
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDefaultRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []File
+		want  []Diagnostic
+	}{
+		{
+			name: "Clean tool",
+			files: []File{
+				{"tool.ts", "import { BaseBoxShapeTool } from 'tldraw'\nexport default class CounterTool extends BaseBoxShapeTool {}\n"},
+				{"util.tsx", "import { HTMLContainer } from 'tldraw'\nexport default class CounterUtil {\n\tstyle = { pointerEvents: 'all' }\n\tinc() { this.editor.updateShape({ props: { count: shape.props.count + 1 } }) }\n}\n"},
+			},
+			want: []Diagnostic{},
+		},
+		{
+			name: "Broken tool",
+			files: []File{
+				{"tool.ts", "import { BaseBoxShapeTool } from '@tldraw/tldraw'\nexport class CounterTool extends BaseBoxShapeTool {}\n"},
+				{"util.tsx", "export default class CounterUtil {\n\tinc() {\n\t\tshape.props.count += 1\n\t\tif (shape.props.count == 2) {}\n\t}\n\ttheme = getDefaultColorTheme()\n}\n"},
+			},
+			want: []Diagnostic{
+				{Rule: "tldraw-import", Severity: SeverityError, Message: `import from "tldraw", not "@tldraw/tldraw"`, File: "tool.ts", Line: 1},
+				{Rule: "tool-default-export", Severity: SeverityError, Message: "tool.ts must have a default export", File: "tool.ts"},
+				{Rule: "pointer-events-all", Severity: SeverityError, Message: `set pointerEvents to "all" on the HTMLContainer`, File: "util.tsx"},
+				{Rule: "update-shape", Severity: SeverityError, Message: "update shape data with this.editor.updateShape instead of mutating props", File: "util.tsx", Line: 3},
+				{Rule: "no-theme-variables", Severity: SeverityWarning, Message: "use tailwind for styles and colors instead of tldraw theme variables", File: "util.tsx", Line: 6},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Default().Check(test.files)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Expected %+v\nbut got %+v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	rulesFile := filepath.Join(t.TempDir(), "rules.json")
+	rules := `[{"id": "no-console", "severity": "warning", "message": "remove console.log", "files": ["*.tsx"], "pattern": "console\\.log"}]`
+	if err := os.WriteFile(rulesFile, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := LoadFile(rulesFile)
+	if err != nil {
+		t.Fatal("Got an error but didn't expect one", err)
+	}
+
+	got := v.Check([]File{
+		{"tool.ts", "console.log('ignored')"},
+		{"util.tsx", "\nconsole.log('flagged')"},
+	})
+	want := []Diagnostic{{Rule: "no-console", Severity: SeverityWarning, Message: "remove console.log", File: "util.tsx", Line: 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v\nbut got %+v", want, got)
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	tests := map[string]string{
+		"Bad JSON":         `{`,
+		"Missing id":       `[{"files": ["*.ts"], "pattern": "x"}]`,
+		"Duplicate id":     `[{"id": "a", "files": ["*.ts"], "pattern": "x"}, {"id": "a", "files": ["*.ts"], "pattern": "y"}]`,
+		"Unknown severity": `[{"id": "a", "severity": "fatal", "files": ["*.ts"], "pattern": "x"}]`,
+		"No files":         `[{"id": "a", "pattern": "x"}]`,
+		"Bad file pattern": `[{"id": "a", "files": ["["], "pattern": "x"}]`,
+		"Bad pattern":      `[{"id": "a", "files": ["*.ts"], "pattern": "("}]`,
+	}
+
+	for name, rules := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Parse([]byte(rules)); err == nil {
+				t.Error("Expected an error but didn't get one")
+			}
+		})
+	}
+}